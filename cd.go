@@ -2,7 +2,6 @@ package cd
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 
@@ -20,25 +19,29 @@ const (
 )
 
 var (
-	osStat = os.Stat
-
 	upFlag       = commander.Flag[int]("up", 'u', "Number of directories to go up when cd-ing", commander.Default(0), commander.NonNegative[int]())
 	parentDirArg = commander.Arg[string]("PARENT_DIR", "Name of the parent directory to go up to",
 		&commander.Complexecute[string]{Lenient: true},
 		commander.CompleterFromFunc(func(s string, d *command.Data) (*command.Completion, error) {
 			var r []string
-			prev := commander.Getwd.Get(d)
+			dirs := map[string]string{}
+			prev := workingDir(d)
 			for pwd := filepath.Dir(prev); pwd != prev; prev, pwd = pwd, filepath.Dir(pwd) {
 				base := filepath.Base(pwd)
-				if base != `/` && base != `\` {
+				if _, ok := dirs[base]; ok || base == `/` || base == `\` {
+					continue
+				}
+				if strings.HasPrefix(strings.ToLower(base), strings.ToLower(s)) {
 					r = append(r, base)
+					dirs[base] = pwd
 				}
 			}
 
-			return &command.Completion{
+			c := &command.Completion{
 				CaseInsensitive: true,
 				Suggestions:     r,
-			}, nil
+			}
+			return keepOrder(d, rankSuggestions(d, c, func(s string) string { return dirs[s] })), nil
 		}),
 	)
 )
@@ -46,8 +49,38 @@ var (
 type Dot struct {
 	// Shortcuts is a map from shortcut type to shortcuts to absolute directory path.
 	Shortcuts map[string]map[string][]string
+	// Profiles is a map from profile name (a hostname or username) to shortcuts
+	// that override the default shortcuts when that profile is active.
+	Profiles map[string]map[string][]string
+	// DisabledNamespaces is a map from hostname to the shortcut namespaces
+	// that are disabled on that host.
+	DisabledNamespaces map[string][]string
+	// Sessions is a map from session name to a saved shell working set.
+	Sessions map[string]*Session
+	// Terminal configures terminal integration (directory reporting and titles).
+	Terminal *Terminal
+	// ListFormat is how directories are listed after changing to them ("ls",
+	// "summary", or empty for no listing).
+	ListFormat string
+	// Env is whether project environment files (`.venv`, `.nvmrc`,
+	// `.tool-versions`, and `.env`) are activated when changing directories.
+	Env bool
+	// PathMode is whether symbolic links are kept ("logical", the default) or
+	// resolved ("physical") when resolving directories.
+	PathMode string
+	// SearchRoots are the directories searched for relative paths that don't
+	// exist in the current directory (like `$CDPATH`, which is used if empty).
+	SearchRoots []string
+	// Completion configures which directories are suggested when completing
+	// paths.
+	Completion *CompletionFilter
 
 	changed bool
+	// fsys is the filesystem that directories are resolved and completed in
+	// (the operating system's filesystem if nil).
+	fsys FS
+	// sources contribute candidate destinations (see WithSources).
+	sources []Source
 }
 
 func (d *Dot) ShortcutMap() map[string]map[string][]string {
@@ -63,6 +96,12 @@ func (*Dot) Setup() []string { return nil }
 func (d *Dot) Name() string  { return dotName }
 
 func getDirectory(data *command.Data, extra ...string) string {
+	// Absolute paths (e.g. from an expanded shortcut) are already rooted, so
+	// the up flag doesn't apply to them.
+	if len(extra) > 0 && filepath.IsAbs(extra[0]) {
+		return filepath.Join(extra...)
+	}
+
 	upTo := upFlag.Get(data)
 	path := make([]string, upTo)
 	for i := 0; i < upTo; i++ {
@@ -73,6 +112,9 @@ func getDirectory(data *command.Data, extra ...string) string {
 }
 
 func (d *Dot) getHistory(data *command.Data) (*cache.Cache, *History, error) {
+	if ros, ok := data.OS.(*resolvingOS); ok {
+		return nil, ros.history, nil
+	}
 	c := cache.ShellFromData(data)
 
 	h := &History{}
@@ -84,6 +126,11 @@ func (d *Dot) getHistory(data *command.Data) (*cache.Cache, *History, error) {
 }
 
 func (d *Dot) updateHistory(output command.Output, data *command.Data) error {
+	// Printing the destination doesn't change directories.
+	if printMode(data) {
+		return nil
+	}
+
 	// Get the cache data
 	c, h, err := d.getHistory(data)
 	if err != nil {
@@ -99,7 +146,7 @@ type History struct {
 }
 
 func (h *History) append(c *cache.Cache, data *command.Data) error {
-	dir := commander.Getwd.Get(data)
+	dir := workingDir(data)
 
 	// No need to update if previous directory is the same.
 	if len(h.PrevDirs) > 0 && h.PrevDirs[len(h.PrevDirs)-1] == dir {
@@ -117,128 +164,280 @@ func (h *History) append(c *cache.Cache, data *command.Data) error {
 	return nil
 }
 
+// previous returns the most recent directory that isn't the provided working
+// directory, or an empty string if there isn't one.
+func (h *History) previous(wd string) string {
+	for i := len(h.PrevDirs) - 1; i >= 0; i-- {
+		if h.PrevDirs[i] != wd {
+			return h.PrevDirs[i]
+		}
+	}
+	return ""
+}
+
 func (d *Dot) cd(output command.Output, data *command.Data) ([]string, error) {
 	if !data.Has(pathArg) {
-		if dir := getDirectory(data); dir != "" {
-			return []string{fmt.Sprintf("cd %q", dir)}, nil
-		}
-		return []string{"cd"}, nil
+		return d.changeDirectory(output, data, getDirectory(data))
 	}
+	if dest, ok := resolving(data); ok {
+		dest.SubPaths = data.StringList(subPathArg)
+	}
+
+	return d.changeDirectory(output, data, destination(data, data.String(pathArg), data.StringList(subPathArg)))
+}
 
-	path := data.String(pathArg)
-	if fi, err := osStat(path); err == nil && !fi.IsDir() {
+// destination returns the directory for the provided path and sub paths. If
+// the path is a file, then its directory is used.
+func destination(data *command.Data, path string, subPaths []string) string {
+	if fi, err := filesystem(data).Stat(path); err == nil && !fi.IsDir() {
 		path = filepath.Dir(path)
 	}
-
-	subPaths := append([]string{path}, data.StringList(subPathArg)...)
-	return []string{fmt.Sprintf("cd %q", filepath.Join(subPaths...))}, nil
+	return filepath.Join(append([]string{path}, subPaths...)...)
 }
 
-func relativeFetcher() commander.Completer[string] {
+func relativeFetcher(d *Dot) commander.Completer[string] {
 	return commander.CompleterFromFunc(func(s string, data *command.Data) (*command.Completion, error) {
-		f := &commander.FileCompleter[string]{
-			Directory:   getDirectory(data),
-			IgnoreFiles: true,
-			ExcludePwd:  true,
-		}
-		return f.Complete(s, data)
+		c, err := d.relativeCompletion(s, data)
+		return keepOrder(data, c), err
 	})
 }
 
+// relativeCompletion completes a path relative to the working directory (or
+// a shortcut, search root, or source).
+func (d *Dot) relativeCompletion(s string, data *command.Data) (*command.Completion, error) {
+	if c, err := d.namespaceCompletion(s, data); c != nil || err != nil {
+		d.describeShortcuts(data, c)
+		return c, err
+	}
+	// Complete `.../fo` as `../../fo` and then restore the typed dots.
+	dots, up, rest, ok := cutDots(s)
+	if !ok || !strings.ContainsAny(s, `/\`) {
+		c, err := d.dirCompleter(getDirectory(data), s, true).Complete(s, data)
+		if err != nil {
+			// The directory may only exist in a search root (or a source).
+			if rc, rerr := d.rootsCompletion(s, data, nil); rerr == nil && rc != nil {
+				return d.sourcesCompletion(s, data, rc), nil
+			}
+			if sc := d.sourcesCompletion(s, data, nil); sc != nil {
+				return sc, nil
+			}
+			return nil, err
+		}
+		rc, err := d.rootsCompletion(s, data, rankDirs(data, c, getDirectory(data), s))
+		if err != nil {
+			return nil, err
+		}
+		return d.sourcesCompletion(s, data, rc), nil
+	}
+	c, err := d.dirCompleter(getDirectory(data), rest, true).Complete(up+rest, data)
+	if c == nil || err != nil {
+		return c, err
+	}
+	c = rankDirs(data, c, getDirectory(data), up+rest)
+	for i, sg := range c.Suggestions {
+		if r, ok := strings.CutPrefix(sg, up); ok {
+			c.Suggestions[i] = dots + "/" + r
+			moveDescription(data, sg, c.Suggestions[i])
+		}
+	}
+	return c, nil
+}
+
 type relativeTransformer struct {
 }
 
-func (d *Dot) Node() command.Node {
-	opts := []commander.ArgumentOption[string]{
-		relativeFetcher(),
+// pathOpts returns the options for an argument that resolves a directory.
+func (d *Dot) pathOpts() []commander.ArgumentOption[string] {
+	return []commander.ArgumentOption[string]{
+		relativeFetcher(d),
 		&commander.Complexecute[string]{Lenient: true},
 		&commander.Transformer[string]{F: func(v string, data *command.Data) (string, error) {
-			return filepath.Abs(getDirectory(data, v))
+			if rp, ok := d.searchRoot(data, v); ok {
+				resolvedAs(data, DestinationSearchRoot)
+				return resolvePath(data, rp), nil
+			}
+			if sd, ok := d.sourceDestination(data, resolvePath(data, v), v); ok {
+				resolvedAs(data, DestinationSource)
+				return resolvePath(data, sd), nil
+			}
+			return resolvePath(data, getDirectory(data, expandDots(v))), nil
 		}},
 	}
+}
+
+func (d *Dot) Node() command.Node {
+	opts := d.pathOpts()
 
 	subOpts := []commander.ArgumentOption[[]string]{
 		&commander.Complexecute[[]string]{Lenient: true},
-		subPathFetcher(),
+		d.subPathFetcher(pathArg),
 	}
 
-	dfltNode := commander.ShortcutNode(dirShortcutName, d, commander.SerialNodes(
+	shortcutNode := commander.ShortcutNode(dirShortcutName, d, commander.SerialNodes(
 		commander.Description("Changes directories"),
+		d.getwd(),
+		d.projectShortcutTransformer(),
 		commander.EchoExecuteData(),
-		cache.ShellProcessor(),
+		shellProcessor(),
 		commander.FlagProcessor(
 			upFlag,
+			printFlag,
+			lsFlag,
+			physicalFlag,
+			logicalFlag,
 		),
 		commander.OptionalArg(pathArg, "destination directory", opts...),
 		commander.ListArg(subPathArg, "subdirectories to continue to", 0, command.UnboundedList, subOpts...),
-		commander.Getwd,
 		commander.ExecutableProcessor(d.cd),
 		&commander.ExecutorProcessor{F: d.updateHistory},
 	))
+	sb := shortcutBranches(shortcutNode)
+	sb.Branches["add a"] = prependProcessors(sb.Branches["add a"], shortcutNameValidator())
+	sb.Branches["export"] = d.exportNode()
+	sb.Branches["import"] = d.importNode(sb)
+	sb.Branches["project"] = d.projectShortcutsNode()
+	sb.Branches["namespaces ns"] = d.namespacesNode()
+	sb.Branches["enable"] = d.namespaceToggleNode(true)
+	sb.Branches["disable"] = d.namespaceToggleNode(false)
+	sb.Branches["list l"] = d.listNode()
+	sb.Branches["profile"] = &commander.BranchNode{
+		Branches: map[string]command.Node{
+			"set":      d.profileSetNode(),
+			"delete d": d.profileDeleteNode(),
+		},
+	}
+
+	dfltNode := prependProcessors(shortcutNode,
+		d.profileProcessor(),
+		d.namespaceTransformer(),
+		d.shortcutRecorder(),
+	)
 
-	return &commander.BranchNode{
+	bn := &commander.BranchNode{
 		Branches: map[string]command.Node{
 			"parent": commander.SerialNodes(
-				commander.Getwd,
+				d.getwd(),
+				commander.FlagProcessor(
+					physicalFlag,
+					logicalFlag,
+				),
+				shellProcessor(),
 				parentDirArg,
-				cache.ShellProcessor(),
-				commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-					dir := parentDirArg.Get(d)
-					prev := commander.Getwd.Get(d)
+				commander.ExecutableProcessor(func(o command.Output, data *command.Data) ([]string, error) {
+					dir := parentDirArg.Get(data)
+					prev := workingDir(data)
 					for pwd := filepath.Dir(prev); pwd != prev; prev, pwd = pwd, filepath.Dir(pwd) {
 						if filepath.Base(pwd) == dir {
-							return []string{
-								fmt.Sprintf("cd %q", pwd),
-							}, nil
+							resolvedAs(data, DestinationParent)
+							return d.changeDirectory(o, data, pwd)
 						}
 					}
 					return nil, o.Stderrf("%s must be a parent directory\n", parentDirArg.Name())
 				}),
 				&commander.ExecutorProcessor{F: d.updateHistory},
 			),
-			"hist": commander.SerialNodes(
-				cache.ShellProcessor(),
-				&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
-					c, h, err := d.getHistory(data)
-					if err != nil {
-						return o.Err(err)
-					}
-					o.Stdoutln("WD: ", commander.Getwd.Get(data))
-					o.Stdoutln("HISTORY: ", h)
-					o.Stdoutln("CACHE: ", c.Dir, c)
-					return nil
-				}},
-			),
 			"-": commander.SerialNodes(
 				commander.Description("Go to the previous directory"),
-				commander.Getwd,
-				cache.ShellProcessor(),
+				d.getwd(),
+				shellProcessor(),
 				commander.ExecutableProcessor(func(output command.Output, data *command.Data) ([]string, error) {
 					c, h, err := d.getHistory(data)
 					if err != nil {
 						return nil, output.Err(err)
 					}
-					wd := commander.Getwd.Get(data)
-					pd := wd
-					for i := len(h.PrevDirs) - 1; pd == wd && i >= 0; i-- {
-						pd = h.PrevDirs[i]
-					}
-					cmd := "cd"
-					if pd != wd {
-						cmd = fmt.Sprintf("cd %q", pd)
+					resolvedAs(data, DestinationPrevious)
+					sl, err := d.changeDirectory(output, data, h.previous(workingDir(data)))
+					if err != nil || printMode(data) {
+						return sl, err
 					}
-
-					return []string{cmd}, output.Err(h.append(c, data))
+					return sl, output.Err(h.append(c, data))
 				}),
 			),
 		},
 		Default:           dfltNode,
 		DefaultCompletion: true,
 	}
+	for name, n := range d.commandBranches() {
+		bn.Branches[name] = n
+	}
+	// The watcher's configuration is never saved (it runs until it is stopped,
+	// and other shells change the configuration meanwhile), so every other
+	// command applies the renames that it saw.
+	for name, n := range bn.Branches {
+		if name != "watch" {
+			bn.Branches[name] = prependProcessors(n, d.renameProcessor())
+		}
+	}
+	bn.Default = prependProcessors(bn.Default, d.renameProcessor())
+	return prependProcessors(bn, d.fsProcessor(), printProcessor(), d.pathModeProcessor())
+}
+
+// commandBranches returns the branches that run commands other than changing
+// directories.
+func (d *Dot) commandBranches() map[string]command.Node {
+	return map[string]command.Node{
+		"completion": d.completionNode(),
+		"describe":   d.describeNode(),
+		"env":        d.envNode(),
+		"exec":       d.execNode(),
+		"index":      d.indexNode(),
+		"jump":       d.jumpNode(),
+		"listing":    d.listingNode(),
+		"session":    d.sessionNode(),
+		"terminal":   d.terminalNode(),
+		"push":       d.pushNode(),
+		"roots":      d.rootsNode(),
+		"pop":        d.popNode(),
+		"stack":      d.stackNode(),
+		"swap-top":   d.swapTopNode(),
+		"symlinks":   d.pathModeNode(),
+		"watch":      d.watchNode(),
+		"hist": commander.SerialNodes(
+			cache.ShellProcessor(),
+			&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+				c, h, err := d.getHistory(data)
+				if err != nil {
+					return o.Err(err)
+				}
+				o.Stdoutln("WD: ", commander.Getwd.Get(data))
+				o.Stdoutln("HISTORY: ", h)
+				o.Stdoutln("CACHE: ", c.Dir, c)
+				return nil
+			}},
+		),
+	}
 }
 
-func DotCLI() *Dot {
-	return &Dot{}
+// shellProcessor sets the shell-level cache (except when a Resolver runs the
+// command, since it provides the history itself).
+func shellProcessor() command.Processor {
+	p := cache.ShellProcessor()
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		if _, ok := resolving(data); ok {
+			return nil
+		}
+		return p.Execute(i, o, data, ed)
+	}, p.Complete)
+}
+
+// prependProcessors returns a node that runs the provided processors before
+// continuing on to the provided node.
+func prependProcessors(n command.Node, ps ...command.Processor) command.Node {
+	for j := len(ps) - 1; j >= 0; j-- {
+		n = &commander.SimpleNode{
+			Processor: ps[j],
+			Edge:      &commander.SimpleEdge{N: n},
+		}
+	}
+	return n
+}
+
+func DotCLI(opts ...Option) *Dot {
+	d := &Dot{}
+	for _, o := range opts {
+		o(d)
+	}
+	return d
 }
 
 var (
@@ -271,19 +470,18 @@ func DotAliasersUpTo(prefix, suffix string, n int) sourcerer.Option {
 	return sourcerer.Aliasers(m)
 }
 
-func subPathFetcher() commander.Completer[[]string] {
-	return commander.CompleterFromFunc(func(sl []string, d *command.Data) (*command.Completion, error) {
+func (d *Dot) subPathFetcher(pathKey string) commander.Completer[[]string] {
+	return commander.CompleterFromFunc(func(sl []string, data *command.Data) (*command.Completion, error) {
 		base := filepath.Join(append(
-			[]string{getDirectory(d, d.String(pathArg))},
+			[]string{getDirectory(data, data.String(pathKey))},
 			// Remove last file/directory part from provided path
 			sl[:len(sl)-1]...,
 		)...)
 
-		ff := &commander.FileCompleter[[]string]{
-			Directory:   base,
-			IgnoreFiles: true,
-			ExcludePwd:  true,
+		c, err := d.dirCompleter(base, sl[len(sl)-1], true).Complete(sl[len(sl)-1], data)
+		if err != nil {
+			return nil, err
 		}
-		return ff.Complete(sl, d)
+		return keepOrder(data, rankDirs(data, c, base, sl[len(sl)-1])), nil
 	})
 }
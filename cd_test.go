@@ -1,986 +1,1243 @@
-package cd
-
-import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
-	"testing"
-	"time"
-
-	"github.com/google/go-cmp/cmp"
-	"github.com/google/go-cmp/cmp/cmpopts"
-	"github.com/leep-frog/command/cache"
-	"github.com/leep-frog/command/cache/cachetest"
-	"github.com/leep-frog/command/command"
-	"github.com/leep-frog/command/commander"
-	"github.com/leep-frog/command/commandertest"
-	"github.com/leep-frog/command/commandtest"
-)
-
-func filepathAbs(t *testing.T, path string) string {
-	t.Helper()
-	a, err := filepath.Abs(path)
-	if err != nil {
-		t.Fatalf("Failed to get absolute file path: %v", err)
-	}
-	return a
-}
-
-func TestLoad(t *testing.T) {
-	for _, test := range []struct {
-		name string
-		json string
-	}{
-		{
-			name: "handles valid json",
-			json: `{"Field": "Value"}`,
-		},
-		{
-			name: "ignores NumRecurs",
-			json: `{"NumRecurs": 6}`,
-		},
-	} {
-		t.Run(test.name, func(t *testing.T) {
-			d := DotCLI()
-			if err := json.Unmarshal([]byte(test.json), d); err != nil {
-				t.Fatalf("UnmarshalJSON(%v) should return nil; got %v", test.json, err)
-			}
-		})
-	}
-}
-
-type fakeFileInfo struct {
-	isDir bool
-}
-
-func (*fakeFileInfo) Name() string       { return "" }
-func (*fakeFileInfo) Size() int64        { return 0 }
-func (*fakeFileInfo) Mode() os.FileMode  { return 0 }
-func (*fakeFileInfo) ModTime() time.Time { return time.Now() }
-func (ffi *fakeFileInfo) IsDir() bool    { return ffi.isDir }
-func (*fakeFileInfo) Sys() interface{}   { return nil }
-
-var (
-	fileType = &fakeFileInfo{}
-	dirType  = &fakeFileInfo{true}
-)
-
-func TestExecute(t *testing.T) {
-	cwd := "prev/dir/1"
-	wdHist := &History{[]string{cwd}}
-
-	commandtest.StubValue(t, &dotName, ".")
-
-	for _, test := range []struct {
-		name               string
-		d                  *Dot
-		want               *Dot
-		etc                *commandtest.ExecuteTestCase
-		osStatFI           os.FileInfo
-		osStatErr          error
-		shellCache         *cache.Cache
-		ignoreHistoryCheck bool
-		wantHistory        *History
-		cwdOverride        string
-		noShellDataKey     bool
-	}{
-		{
-			name:        "handles nil arguments",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{"cd"},
-				},
-				WantData: &command.Data{
-					Values: map[string]interface{}{
-						upFlag.Name():      0,
-						commander.GetwdKey: cwd,
-					},
-				},
-			},
-		},
-		{
-			name:     "error if GetStruct error",
-			osStatFI: dirType,
-			d:        DotCLI(),
-			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
-				shellCacheKey: "} invalid json {",
-			}),
-			ignoreHistoryCheck: true,
-			wantHistory:        &History{},
-			etc: &commandtest.ExecuteTestCase{
-				WantErr:    fmt.Errorf("failed to get struct data: failed to unmarshal cache data: invalid character '}' looking for beginning of value"),
-				WantStderr: "failed to get struct data: failed to unmarshal cache data: invalid character '}' looking for beginning of value\n",
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{"cd"},
-				},
-				WantData: &command.Data{
-					Values: map[string]interface{}{
-						upFlag.Name():      0,
-						commander.GetwdKey: cwd,
-					},
-				},
-			},
-		},
-		{
-			name:        "complete for execute",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: &History{PrevDirs: []string{filepathAbs(t, ".")}},
-			cwdOverride: filepathAbs(t, "."),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"c"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{fmt.Sprintf("cd %q", filepathAbs(t, "cmd"))},
-				},
-				WantData: &command.Data{
-					Values: map[string]interface{}{
-						upFlag.Name():      0,
-						"PATH":             filepathAbs(t, "cmd"),
-						commander.GetwdKey: filepathAbs(t, "."),
-					},
-				},
-			},
-		},
-		{
-			name:        "handles basic dot",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{"cd"},
-				},
-				WantData: &command.Data{
-					Values: map[string]interface{}{
-						upFlag.Name():      0,
-						commander.GetwdKey: cwd,
-					},
-				},
-			},
-		},
-		{
-			name:        "handles empty arguments",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{"cd"},
-				},
-				WantData: &command.Data{
-					Values: map[string]interface{}{
-						upFlag.Name():      0,
-						commander.GetwdKey: cwd,
-					},
-				},
-			},
-		},
-		{
-			name:        "handles directory with spaces arguments",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"some thing"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						fmt.Sprintf("cd %q", filepathAbs(t, "some thing")),
-					},
-				},
-				WantData: &command.Data{
-					Values: map[string]interface{}{
-						pathArg:            filepathAbs(t, "some thing"),
-						upFlag.Name():      0,
-						commander.GetwdKey: cwd,
-					},
-				},
-			},
-		},
-		{
-			name:        "handles -u flag",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"-u", "2"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						fmt.Sprintf("cd %q", filepath.Join("..", "..")),
-					},
-				},
-				WantData: &command.Data{
-					Values: map[string]interface{}{
-						upFlag.Name():      2,
-						commander.GetwdKey: cwd,
-					},
-				},
-			},
-		},
-		{
-			name:        "handles absolute path",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{filepathAbs(t, "../../..")},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						fmt.Sprintf("cd %q", filepathAbs(t, filepath.Join("..", "..", ".."))),
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					pathArg:            filepathAbs(t, filepath.Join("..", "..", "..")),
-					upFlag.Name():      0,
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		{
-			name:        "cds into directory of a file",
-			osStatFI:    fileType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"something/somewhere.txt", "--up", "3"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						fmt.Sprintf("cd %q", filepathAbs(t, filepath.Join("..", "..", "..", "something"))),
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					pathArg:            filepathAbs(t, filepath.Join("..", "..", "..", "something", "somewhere.txt")),
-					upFlag.Name():      3,
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		{
-			name:        "cds into directory with spaces",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"some where/"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						fmt.Sprintf("cd %q", filepathAbs(t, filepath.Join("some where"))),
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					pathArg:            filepathAbs(t, filepath.Join("some where")),
-					upFlag.Name():      0,
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		{
-			name:        "0-dot cds down multiple paths",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"some", "thing", "some", "where"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						fmt.Sprintf("cd %q", filepathAbs(t, filepath.Join("some", "thing", "some", "where"))),
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					pathArg:            filepathAbs(t, filepath.Join("some")),
-					subPathArg:         []string{"thing", "some", "where"},
-					upFlag.Name():      0,
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		{
-			name:        "1-dot cds down multiple paths",
-			osStatFI:    dirType,
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"some", "thing", "-u", "1", "some", "where"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						fmt.Sprintf("cd %q", filepathAbs(t, filepath.Join("..", "some", "thing", "some", "where"))),
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					pathArg:            filepathAbs(t, filepath.Join("..", "some")),
-					subPathArg:         []string{"thing", "some", "where"},
-					upFlag.Name():      1,
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		// Minus tests
-		{
-			name: "minus goes to the previous directory",
-			d:    DotCLI(),
-			wantHistory: &History{[]string{
-				"old/dir",
-				cwd,
-			}},
-			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
-				shellCacheKey: &History{
-					PrevDirs: []string{
-						"old/dir",
-					},
-				},
-			}),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"-"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						`cd "old/dir"`,
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		{
-			name:        "minus goes home if no history",
-			d:           DotCLI(),
-			wantHistory: wdHist,
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"-"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						`cd`,
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		// History tests
-		{
-			name:     "dot history gets truncated",
-			d:        DotCLI(),
-			osStatFI: dirType,
-			wantHistory: &History{[]string{
-				"old/dir/5",
-				cwd,
-			}},
-			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
-				shellCacheKey: &History{
-					PrevDirs: []string{
-						"old/dir/1",
-						"old/dir/2",
-						"old/dir/3",
-						"old/dir/4",
-						"old/dir/5",
-					},
-				},
-			}),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"somewhere"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{fmt.Sprintf("cd %q", filepathAbs(t, "somewhere"))},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					commander.GetwdKey: cwd,
-					"PATH":             filepathAbs(t, "somewhere"),
-					upFlag.Name():      0,
-				}},
-			},
-		},
-		{
-			name: "minus history gets truncated",
-			d:    DotCLI(),
-			wantHistory: &History{[]string{
-				"old/dir/5",
-				cwd,
-			}},
-			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
-				shellCacheKey: &History{
-					PrevDirs: []string{
-						"old/dir/1",
-						"old/dir/2",
-						"old/dir/3",
-						"old/dir/4",
-						"old/dir/5",
-					},
-				},
-			}),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"-"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						`cd "old/dir/5"`,
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		{
-			name:     "dot history skips current directory",
-			d:        DotCLI(),
-			osStatFI: dirType,
-			wantHistory: &History{[]string{
-				"old/dir/1",
-				cwd,
-				"old/dir/2",
-				cwd,
-				cwd,
-				cwd,
-			}},
-			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
-				shellCacheKey: &History{
-					PrevDirs: []string{
-						"old/dir/1",
-						cwd,
-						"old/dir/2",
-						cwd,
-						cwd,
-						cwd,
-					},
-				},
-			}),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"somewhere"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{fmt.Sprintf("cd %q", filepathAbs(t, "somewhere"))},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					commander.GetwdKey: cwd,
-					"PATH":             filepathAbs(t, "somewhere"),
-					upFlag.Name():      0,
-				}},
-			},
-		},
-		{
-			name: "minus history skips current directory",
-			d:    DotCLI(),
-			wantHistory: &History{[]string{
-				"old/dir/1",
-				cwd,
-				"old/dir/2",
-				cwd,
-				cwd,
-				cwd,
-			}},
-			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
-				shellCacheKey: &History{
-					PrevDirs: []string{
-						"old/dir/1",
-						cwd,
-						"old/dir/2",
-						cwd,
-						cwd,
-						cwd,
-					},
-				},
-			}),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"-"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						`cd "old/dir/2"`,
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		{
-			name: "dot history doesn't change if in working dir",
-			d:    DotCLI(),
-			wantHistory: &History{[]string{
-				"old/dir/1",
-				cwd,
-			}},
-			osStatFI: dirType,
-			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
-				shellCacheKey: &History{
-					PrevDirs: []string{
-						"old/dir/1",
-						cwd,
-					},
-				},
-			}),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"somewhere"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{fmt.Sprintf("cd %q", filepathAbs(t, "somewhere"))},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					commander.GetwdKey: cwd,
-					"PATH":             filepathAbs(t, "somewhere"),
-					upFlag.Name():      0,
-				}},
-			},
-		},
-		{
-			name: "minus history doesn't change if in working dir",
-			d:    DotCLI(),
-			wantHistory: &History{[]string{
-				"old/dir/1",
-				cwd,
-			}},
-			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
-				shellCacheKey: &History{
-					PrevDirs: []string{
-						"old/dir/1",
-						cwd,
-					},
-				},
-			}),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"-"},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{
-						`cd "old/dir/1"`,
-					},
-				},
-				WantData: &command.Data{Values: map[string]interface{}{
-					commander.GetwdKey: cwd,
-				}},
-			},
-		},
-		// parent tests
-		{
-			name:           "parent fails if no arg",
-			d:              &Dot{},
-			wantHistory:    &History{},
-			cwdOverride:    "/abc/def/ghi",
-			noShellDataKey: true,
-			etc: &commandtest.ExecuteTestCase{
-				Args:       []string{"parent"},
-				WantErr:    fmt.Errorf("Argument \"PARENT_DIR\" requires at least 1 argument, got 0"),
-				WantStderr: "Argument \"PARENT_DIR\" requires at least 1 argument, got 0\n",
-				WantData: &command.Data{Values: map[string]interface{}{
-					commander.GetwdKey: filepath.FromSlash("/abc/def/ghi"),
-				}},
-			},
-		},
-		{
-			name:        "parent fails if empty arg",
-			d:           &Dot{},
-			wantHistory: &History{},
-			cwdOverride: "/abc/def/ghi",
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"parent", ""},
-				WantData: &command.Data{Values: map[string]interface{}{
-					parentDirArg.Name(): "",
-					commander.GetwdKey:  filepath.FromSlash("/abc/def/ghi"),
-				}},
-				WantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
-				WantStderr: "PARENT_DIR must be a parent directory\n",
-			},
-		},
-		{
-			name:        "parent fails if doesn't match",
-			d:           &Dot{},
-			wantHistory: &History{},
-			cwdOverride: "/abc/def/ghi",
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"parent", "jkl"},
-				WantData: &command.Data{Values: map[string]interface{}{
-					parentDirArg.Name(): "jkl",
-					commander.GetwdKey:  filepath.FromSlash("/abc/def/ghi"),
-				}},
-				WantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
-				WantStderr: "PARENT_DIR must be a parent directory\n",
-			},
-		},
-		{
-			name:        "parent fails if last directory",
-			d:           &Dot{},
-			wantHistory: &History{},
-			cwdOverride: "/abc/def/ghi",
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"parent", "ghi"},
-				WantData: &command.Data{Values: map[string]interface{}{
-					parentDirArg.Name(): "ghi",
-					commander.GetwdKey:  filepath.FromSlash("/abc/def/ghi"),
-				}},
-				WantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
-				WantStderr: "PARENT_DIR must be a parent directory\n",
-			},
-		},
-		{
-			name:        "parent fails if only one directory",
-			d:           &Dot{},
-			wantHistory: &History{},
-			cwdOverride: "ghi",
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"parent", "ghi"},
-				WantData: &command.Data{Values: map[string]interface{}{
-					parentDirArg.Name(): "ghi",
-					commander.GetwdKey:  filepath.FromSlash("ghi"),
-				}},
-				WantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
-				WantStderr: "PARENT_DIR must be a parent directory\n",
-			},
-		},
-		{
-			name: "parent succeeds",
-			d:    &Dot{},
-			wantHistory: &History{
-				PrevDirs: []string{commandtest.FilepathAbs(t, "abc", "def", "ghi")},
-			},
-			cwdOverride: commandtest.FilepathAbs(t, "abc", "def", "ghi"),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"parent", "def"},
-				WantData: &command.Data{Values: map[string]interface{}{
-					parentDirArg.Name(): "def",
-					commander.GetwdKey:  commandtest.FilepathAbs(t, "abc", "def", "ghi"),
-				}},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{fmt.Sprintf(`cd %q`, commandtest.FilepathAbs(t, "abc", "def"))},
-				},
-			},
-		},
-		{
-			name: "parent uses highest level directory if duplciates",
-			d:    &Dot{},
-			wantHistory: &History{
-				PrevDirs: []string{commandtest.FilepathAbs(t, "abc", "def", "ghi", "def", "jkl")},
-			},
-			cwdOverride: commandtest.FilepathAbs(t, "abc", "def", "ghi", "def", "jkl"),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"parent", "def"},
-				WantData: &command.Data{Values: map[string]interface{}{
-					parentDirArg.Name(): "def",
-					commander.GetwdKey:  commandtest.FilepathAbs(t, "abc", "def", "ghi", "def", "jkl"),
-				}},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{fmt.Sprintf(`cd %q`, commandtest.FilepathAbs(t, "abc", "def", "ghi", "def"))},
-				},
-			},
-		},
-		{
-			name: "parent complexecutes",
-			d:    &Dot{},
-			wantHistory: &History{
-				PrevDirs: []string{commandtest.FilepathAbs(t, "abc", "def", "ghi", "jkl")},
-			},
-			cwdOverride: commandtest.FilepathAbs(t, "abc", "def", "ghi", "jkl"),
-			etc: &commandtest.ExecuteTestCase{
-				Args: []string{"parent", "abc"},
-				WantData: &command.Data{Values: map[string]interface{}{
-					parentDirArg.Name(): "abc",
-					commander.GetwdKey:  commandtest.FilepathAbs(t, "abc", "def", "ghi", "jkl"),
-				}},
-				WantExecuteData: &command.ExecuteData{
-					Executable: []string{fmt.Sprintf(`cd %q`, commandtest.FilepathAbs(t, "abc"))},
-				},
-			},
-		},
-		/* Useful for commenting out tests. */
-	} {
-		t.Run(test.name, func(t *testing.T) {
-			test.cwdOverride = filepath.FromSlash(test.cwdOverride)
-			c := test.shellCache
-			if c == nil {
-				c = cachetest.NewTestCache(t)
-			}
-			if test.etc.WantData == nil {
-				test.etc.WantData = &command.Data{Values: map[string]interface{}{}}
-			}
-			if !test.noShellDataKey {
-				test.etc.WantData.Values[cache.ShellDataKey] = c
-			}
-			if test.cwdOverride != "" {
-				commandtest.StubGetwd(t, test.cwdOverride, nil)
-			} else {
-				commandtest.StubGetwd(t, cwd, nil)
-			}
-
-			commandtest.StubValue(t, &osStat, func(path string) (os.FileInfo, error) { return test.osStatFI, test.osStatErr })
-			cache.StubShellCache(t, c)
-
-			test.etc.Node = test.d.Node()
-			test.etc.OS = &commandtest.FakeOS{}
-			test.etc.DataCmpOpts = []cmp.Option{
-				cmp.AllowUnexported(cache.Cache{}),
-			}
-			commandertest.ExecuteTest(t, test.etc)
-			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
-
-			if !test.ignoreHistoryCheck {
-				newH := &History{}
-				if _, err := c.GetStruct(shellCacheKey, newH); err != nil {
-					t.Fatalf("Failed to read history from cache: %v", err)
-				}
-				if diff := cmp.Diff(test.wantHistory, newH); diff != "" {
-					t.Errorf("Execute(%v) produced incorrect history (-want, +got):\n%s", test.etc.Args, diff)
-				}
-			}
-		})
-	}
-}
-
-func TestAutocomplete(t *testing.T) {
-	for _, test := range []struct {
-		name        string
-		ctc         *commandtest.CompleteTestCase
-		cwdOverride string
-	}{
-		{
-			name: "dot completes all directories",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						".git/",
-						"cmd/",
-						"testing/",
-						" ",
-					},
-				},
-			},
-		},
-		{
-			name: "dot completes all directories with command",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd ",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						".git/",
-						"cmd/",
-						"testing/",
-						" ",
-					},
-				},
-			},
-		},
-		{
-			name: "dot completes simple directory",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd c",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"cmd/",
-					},
-					SpacelessCompletion: true,
-				},
-			},
-		},
-		{
-			name: "dot handles no match",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd uhh",
-			},
-		},
-		{
-			name: "dot completes directories that match",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd te",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"testing/",
-					},
-					SpacelessCompletion: true,
-				},
-			},
-		},
-		{
-			name: "dot completes nested directories",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd testing/o",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"testing/other/",
-					},
-					SpacelessCompletion: true,
-				},
-			},
-		},
-		{
-			name: "dot completes sub directories",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd testing ",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"dir1/",
-						"dir2/",
-						"other/",
-						" ",
-					},
-				},
-			},
-		},
-		{
-			name: "dot completes sub nested directories",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd testing dir1/",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"another/",
-						"folderA/",
-						"folderB/",
-						" ",
-					},
-				},
-			},
-		},
-		{
-			name: "dot completes partial sub nested directories",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd testing dir1/fold",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"dir1/folder",
-					},
-					SpacelessCompletion: true,
-				},
-			},
-		},
-		{
-			name: "dot completes partial sub directories",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd testing d",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"dir",
-					},
-					SpacelessCompletion: true,
-				},
-			},
-		},
-		{
-			name: "dot completes partial sub directories",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd testing d",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"dir",
-					},
-					SpacelessCompletion: true,
-				},
-			},
-		},
-		{
-			name: "dot completion handles no match for sub directories",
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd testing um",
-			},
-		},
-		{
-			name:        "sub directory completion ignores current dir",
-			cwdOverride: commandtest.FilepathAbs(t, "testing", "dir1"),
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd testing ",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"dir2/",
-						"other/",
-						" ",
-					},
-				},
-			},
-		},
-		{
-			name:        "sub directory completion ignores current dir if nested",
-			cwdOverride: commandtest.FilepathAbs(t, "testing", "dir2", "something", "else"),
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd testing ",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"dir1/",
-						"other/",
-						" ",
-					},
-				},
-			},
-		},
-		{
-			name:        "parent autocompletes",
-			cwdOverride: filepath.FromSlash("/abc/def/ghi/jkl"),
-			ctc: &commandtest.CompleteTestCase{
-				Node: DotCLI().Node(),
-				Args: "cmd parent ",
-				Want: &command.Autocompletion{
-					Suggestions: []string{
-						"abc",
-						"def",
-						"ghi",
-					},
-				},
-			},
-		},
-		/* Useful for commenting out tests. */
-	} {
-		t.Run(test.name, func(t *testing.T) {
-			if test.cwdOverride != "" {
-				commandtest.StubGetwd(t, test.cwdOverride, nil)
-			}
-
-			if test.ctc.Want != nil {
-				for i, v := range test.ctc.Want.Suggestions {
-					test.ctc.Want.Suggestions[i] = filepath.FromSlash(v)
-				}
-			}
-			test.ctc.SkipDataCheck = true
-			test.ctc.OS = &commandtest.FakeOS{}
-			commandertest.AutocompleteTest(t, test.ctc)
-		})
-	}
-}
-
-func TestMetadata(t *testing.T) {
-	commandtest.StubValue(t, &dotName, ".")
-	wantName := "."
-	if got := DotCLI().Name(); got != wantName {
-		t.Errorf("Name() returned %q; want %q", got, wantName)
-	}
-}
-
-func TestUsage(t *testing.T) {
-	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
-		Node: DotCLI().Node(),
-		Args: []string{"--help"},
-		WantStdout: strings.Join([]string{
-			"Changes directories",
-			"┳ { shortcuts } [ PATH ] [ SUB_PATH ... ] --up|-u UP",
-			"┃",
-			"┃   Go to the previous directory",
-			"┣━━ -",
-			"┃",
-			"┣━━ hist",
-			"┃",
-			"┗━━ parent PARENT_DIR",
-			"",
-			"Arguments:",
-			"  PARENT_DIR: Name of the parent directory to go up to",
-			"  PATH: destination directory",
-			"  SUB_PATH: subdirectories to continue to",
-			"",
-			"Flags:",
-			"  [u] up: Number of directories to go up when cd-ing",
-			"    Default: 0",
-			"    NonNegative()",
-			"",
-			"Symbols:",
-			"  { shortcuts }: Start of new shortcut-able section. This is usable by providing the `shortcuts` keyword in this position. Run `cmd ... shortcuts --help` for more details",
-			"",
-		}, "\n"),
-	})
-}
+package cd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func filepathAbs(t *testing.T, path string) string {
+	t.Helper()
+	a, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatalf("Failed to get absolute file path: %v", err)
+	}
+	return a
+}
+
+func TestLoad(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		json string
+	}{
+		{
+			name: "handles valid json",
+			json: `{"Field": "Value"}`,
+		},
+		{
+			name: "ignores NumRecurs",
+			json: `{"NumRecurs": 6}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := DotCLI()
+			if err := json.Unmarshal([]byte(test.json), d); err != nil {
+				t.Fatalf("UnmarshalJSON(%v) should return nil; got %v", test.json, err)
+			}
+		})
+	}
+}
+
+type fakeFileInfo struct {
+	isDir bool
+}
+
+func (*fakeFileInfo) Name() string       { return "" }
+func (*fakeFileInfo) Size() int64        { return 0 }
+func (*fakeFileInfo) Mode() os.FileMode  { return 0 }
+func (*fakeFileInfo) ModTime() time.Time { return time.Now() }
+func (ffi *fakeFileInfo) IsDir() bool    { return ffi.isDir }
+func (*fakeFileInfo) Sys() interface{}   { return nil }
+
+var (
+	fileType = &fakeFileInfo{}
+	dirType  = &fakeFileInfo{true}
+)
+
+func TestExecute(t *testing.T) {
+	cwd := "prev/dir/1"
+	wdHist := &History{[]string{cwd}}
+
+	commandtest.StubValue(t, &dotName, ".")
+
+	for _, test := range []struct {
+		name               string
+		d                  *Dot
+		want               *Dot
+		etc                *commandtest.ExecuteTestCase
+		statFI             os.FileInfo
+		statErr            error
+		shellCache         *cache.Cache
+		ignoreHistoryCheck bool
+		wantHistory        *History
+		cwdOverride        string
+		noShellDataKey     bool
+	}{
+		{
+			name:        "handles nil arguments",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"cd"},
+				},
+				WantData: &command.Data{
+					Values: map[string]interface{}{
+						upFlag.Name():      0,
+						commander.GetwdKey: cwd,
+					},
+				},
+			},
+		},
+		{
+			name:   "error if GetStruct error",
+			statFI: dirType,
+			d:      DotCLI(),
+			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
+				shellCacheKey: "} invalid json {",
+			}),
+			ignoreHistoryCheck: true,
+			wantHistory:        &History{},
+			etc: &commandtest.ExecuteTestCase{
+				WantErr:    fmt.Errorf("failed to get struct data: failed to unmarshal cache data: invalid character '}' looking for beginning of value"),
+				WantStderr: "failed to get struct data: failed to unmarshal cache data: invalid character '}' looking for beginning of value\n",
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"cd"},
+				},
+				WantData: &command.Data{
+					Values: map[string]interface{}{
+						upFlag.Name():      0,
+						commander.GetwdKey: cwd,
+					},
+				},
+			},
+		},
+		{
+			name:        "complete for execute",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: &History{PrevDirs: []string{filepathAbs(t, ".")}},
+			cwdOverride: filepathAbs(t, "."),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"c"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepathAbs(t, "cmd"))},
+				},
+				WantData: &command.Data{
+					Values: map[string]interface{}{
+						upFlag.Name():      0,
+						"PATH":             filepathAbs(t, "cmd"),
+						commander.GetwdKey: filepathAbs(t, "."),
+					},
+				},
+			},
+		},
+		{
+			name:        "handles basic dot",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"cd"},
+				},
+				WantData: &command.Data{
+					Values: map[string]interface{}{
+						upFlag.Name():      0,
+						commander.GetwdKey: cwd,
+					},
+				},
+			},
+		},
+		{
+			name:        "handles empty arguments",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"cd"},
+				},
+				WantData: &command.Data{
+					Values: map[string]interface{}{
+						upFlag.Name():      0,
+						commander.GetwdKey: cwd,
+					},
+				},
+			},
+		},
+		{
+			name:        "handles directory with spaces arguments",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"some thing"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd(filepathAbs(t, "some thing")),
+					},
+				},
+				WantData: &command.Data{
+					Values: map[string]interface{}{
+						pathArg:            filepathAbs(t, "some thing"),
+						upFlag.Name():      0,
+						commander.GetwdKey: cwd,
+					},
+				},
+			},
+		},
+		{
+			name:        "handles -u flag",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-u", "2"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd(filepath.Join("..", "..")),
+					},
+				},
+				WantData: &command.Data{
+					Values: map[string]interface{}{
+						upFlag.Name():      2,
+						commander.GetwdKey: cwd,
+					},
+				},
+			},
+		},
+		{
+			name:        "handles absolute path",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{filepathAbs(t, "../../..")},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd(filepathAbs(t, filepath.Join("..", "..", ".."))),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					pathArg:            filepathAbs(t, filepath.Join("..", "..", "..")),
+					upFlag.Name():      0,
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		{
+			name:        "cds into directory of a file",
+			statFI:      fileType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"something/somewhere.txt", "--up", "3"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd(filepathAbs(t, filepath.Join("..", "..", "..", "something"))),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					pathArg:            filepathAbs(t, filepath.Join("..", "..", "..", "something", "somewhere.txt")),
+					upFlag.Name():      3,
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		{
+			name:        "cds into directory with spaces",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"some where/"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd(filepathAbs(t, filepath.Join("some where"))),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					pathArg:            filepathAbs(t, filepath.Join("some where")),
+					upFlag.Name():      0,
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		{
+			name:        "0-dot cds down multiple paths",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"some", "thing", "some", "where"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd(filepathAbs(t, filepath.Join("some", "thing", "some", "where"))),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					pathArg:            filepathAbs(t, filepath.Join("some")),
+					subPathArg:         []string{"thing", "some", "where"},
+					upFlag.Name():      0,
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		{
+			name:        "1-dot cds down multiple paths",
+			statFI:      dirType,
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"some", "thing", "-u", "1", "some", "where"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd(filepathAbs(t, filepath.Join("..", "some", "thing", "some", "where"))),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					pathArg:            filepathAbs(t, filepath.Join("..", "some")),
+					subPathArg:         []string{"thing", "some", "where"},
+					upFlag.Name():      1,
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		{
+			name:        "shortcut ignores up flag",
+			statFI:      dirType,
+			d:           shortcutDot(map[string][]string{"sc": {filepathAbs(t, "testing")}}),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"sc", "-u", "2", "dir1"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd(filepathAbs(t, filepath.Join("testing", "dir1"))),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					pathArg:            filepathAbs(t, "testing"),
+					subPathArg:         []string{"dir1"},
+					upFlag.Name():      2,
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		// Minus tests
+		{
+			name: "minus goes to the previous directory",
+			d:    DotCLI(),
+			wantHistory: &History{[]string{
+				"old/dir",
+				cwd,
+			}},
+			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
+				shellCacheKey: &History{
+					PrevDirs: []string{
+						"old/dir",
+					},
+				},
+			}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("old/dir"),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		{
+			name:        "minus goes home if no history",
+			d:           DotCLI(),
+			wantHistory: wdHist,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						`cd`,
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		// History tests
+		{
+			name:   "dot history gets truncated",
+			d:      DotCLI(),
+			statFI: dirType,
+			wantHistory: &History{[]string{
+				"old/dir/5",
+				cwd,
+			}},
+			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
+				shellCacheKey: &History{
+					PrevDirs: []string{
+						"old/dir/1",
+						"old/dir/2",
+						"old/dir/3",
+						"old/dir/4",
+						"old/dir/5",
+					},
+				},
+			}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"somewhere"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepathAbs(t, "somewhere"))},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					commander.GetwdKey: cwd,
+					"PATH":             filepathAbs(t, "somewhere"),
+					upFlag.Name():      0,
+				}},
+			},
+		},
+		{
+			name: "minus history gets truncated",
+			d:    DotCLI(),
+			wantHistory: &History{[]string{
+				"old/dir/5",
+				cwd,
+			}},
+			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
+				shellCacheKey: &History{
+					PrevDirs: []string{
+						"old/dir/1",
+						"old/dir/2",
+						"old/dir/3",
+						"old/dir/4",
+						"old/dir/5",
+					},
+				},
+			}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("old/dir/5"),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		{
+			name:   "dot history skips current directory",
+			d:      DotCLI(),
+			statFI: dirType,
+			wantHistory: &History{[]string{
+				"old/dir/1",
+				cwd,
+				"old/dir/2",
+				cwd,
+				cwd,
+				cwd,
+			}},
+			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
+				shellCacheKey: &History{
+					PrevDirs: []string{
+						"old/dir/1",
+						cwd,
+						"old/dir/2",
+						cwd,
+						cwd,
+						cwd,
+					},
+				},
+			}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"somewhere"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepathAbs(t, "somewhere"))},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					commander.GetwdKey: cwd,
+					"PATH":             filepathAbs(t, "somewhere"),
+					upFlag.Name():      0,
+				}},
+			},
+		},
+		{
+			name: "minus history skips current directory",
+			d:    DotCLI(),
+			wantHistory: &History{[]string{
+				"old/dir/1",
+				cwd,
+				"old/dir/2",
+				cwd,
+				cwd,
+				cwd,
+			}},
+			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
+				shellCacheKey: &History{
+					PrevDirs: []string{
+						"old/dir/1",
+						cwd,
+						"old/dir/2",
+						cwd,
+						cwd,
+						cwd,
+					},
+				},
+			}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("old/dir/2"),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		{
+			name: "dot history doesn't change if in working dir",
+			d:    DotCLI(),
+			wantHistory: &History{[]string{
+				"old/dir/1",
+				cwd,
+			}},
+			statFI: dirType,
+			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
+				shellCacheKey: &History{
+					PrevDirs: []string{
+						"old/dir/1",
+						cwd,
+					},
+				},
+			}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"somewhere"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepathAbs(t, "somewhere"))},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					commander.GetwdKey: cwd,
+					"PATH":             filepathAbs(t, "somewhere"),
+					upFlag.Name():      0,
+				}},
+			},
+		},
+		{
+			name: "minus history doesn't change if in working dir",
+			d:    DotCLI(),
+			wantHistory: &History{[]string{
+				"old/dir/1",
+				cwd,
+			}},
+			shellCache: cachetest.NewTestCacheWithData(t, map[string]interface{}{
+				shellCacheKey: &History{
+					PrevDirs: []string{
+						"old/dir/1",
+						cwd,
+					},
+				},
+			}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("old/dir/1"),
+					},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					commander.GetwdKey: cwd,
+				}},
+			},
+		},
+		// parent tests
+		{
+			name:        "parent fails if no arg",
+			d:           &Dot{},
+			wantHistory: &History{},
+			cwdOverride: "/abc/def/ghi",
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"parent"},
+				WantErr:    fmt.Errorf("Argument \"PARENT_DIR\" requires at least 1 argument, got 0"),
+				WantStderr: "Argument \"PARENT_DIR\" requires at least 1 argument, got 0\n",
+				WantData: &command.Data{Values: map[string]interface{}{
+					commander.GetwdKey: filepath.FromSlash("/abc/def/ghi"),
+				}},
+			},
+		},
+		{
+			name:        "parent fails if empty arg",
+			d:           &Dot{},
+			wantHistory: &History{},
+			cwdOverride: "/abc/def/ghi",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"parent", ""},
+				WantData: &command.Data{Values: map[string]interface{}{
+					parentDirArg.Name(): "",
+					commander.GetwdKey:  filepath.FromSlash("/abc/def/ghi"),
+				}},
+				WantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
+				WantStderr: "PARENT_DIR must be a parent directory\n",
+			},
+		},
+		{
+			name:        "parent fails if doesn't match",
+			d:           &Dot{},
+			wantHistory: &History{},
+			cwdOverride: "/abc/def/ghi",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"parent", "jkl"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					parentDirArg.Name(): "jkl",
+					commander.GetwdKey:  filepath.FromSlash("/abc/def/ghi"),
+				}},
+				WantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
+				WantStderr: "PARENT_DIR must be a parent directory\n",
+			},
+		},
+		{
+			name:        "parent fails if last directory",
+			d:           &Dot{},
+			wantHistory: &History{},
+			cwdOverride: "/abc/def/ghi",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"parent", "ghi"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					parentDirArg.Name(): "ghi",
+					commander.GetwdKey:  filepath.FromSlash("/abc/def/ghi"),
+				}},
+				WantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
+				WantStderr: "PARENT_DIR must be a parent directory\n",
+			},
+		},
+		{
+			name:        "parent fails if only one directory",
+			d:           &Dot{},
+			wantHistory: &History{},
+			cwdOverride: "ghi",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"parent", "ghi"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					parentDirArg.Name(): "ghi",
+					commander.GetwdKey:  filepath.FromSlash("ghi"),
+				}},
+				WantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
+				WantStderr: "PARENT_DIR must be a parent directory\n",
+			},
+		},
+		{
+			name: "parent succeeds",
+			d:    &Dot{},
+			wantHistory: &History{
+				PrevDirs: []string{commandtest.FilepathAbs(t, "abc", "def", "ghi")},
+			},
+			cwdOverride: commandtest.FilepathAbs(t, "abc", "def", "ghi"),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"parent", "def"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					parentDirArg.Name(): "def",
+					commander.GetwdKey:  commandtest.FilepathAbs(t, "abc", "def", "ghi"),
+				}},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(commandtest.FilepathAbs(t, "abc", "def"))},
+				},
+			},
+		},
+		{
+			name: "parent uses highest level directory if duplciates",
+			d:    &Dot{},
+			wantHistory: &History{
+				PrevDirs: []string{commandtest.FilepathAbs(t, "abc", "def", "ghi", "def", "jkl")},
+			},
+			cwdOverride: commandtest.FilepathAbs(t, "abc", "def", "ghi", "def", "jkl"),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"parent", "def"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					parentDirArg.Name(): "def",
+					commander.GetwdKey:  commandtest.FilepathAbs(t, "abc", "def", "ghi", "def", "jkl"),
+				}},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(commandtest.FilepathAbs(t, "abc", "def", "ghi", "def"))},
+				},
+			},
+		},
+		{
+			name: "parent complexecutes",
+			d:    &Dot{},
+			wantHistory: &History{
+				PrevDirs: []string{commandtest.FilepathAbs(t, "abc", "def", "ghi", "jkl")},
+			},
+			cwdOverride: commandtest.FilepathAbs(t, "abc", "def", "ghi", "jkl"),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"parent", "abc"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					parentDirArg.Name(): "abc",
+					commander.GetwdKey:  commandtest.FilepathAbs(t, "abc", "def", "ghi", "jkl"),
+				}},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(commandtest.FilepathAbs(t, "abc"))},
+				},
+			},
+		},
+		/* Useful for commenting out tests. */
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.cwdOverride = filepath.FromSlash(test.cwdOverride)
+			c := test.shellCache
+			if c == nil {
+				c = cachetest.NewTestCache(t)
+			}
+			if test.etc.WantData == nil {
+				test.etc.WantData = &command.Data{Values: map[string]interface{}{}}
+			}
+			if !test.noShellDataKey {
+				test.etc.WantData.Values[cache.ShellDataKey] = c
+			}
+			wd := cwd
+			if test.cwdOverride != "" {
+				wd = test.cwdOverride
+			}
+			commandtest.StubGetwd(t, wd, nil)
+			sf := &statFS{stat: func(string) (fs.FileInfo, error) { return test.statFI, test.statErr }}
+			test.d.fsys = sf
+			test.etc.WantData.Values[fsDataKey] = sf
+			cache.StubShellCache(t, c)
+
+			test.etc.Node = test.d.Node()
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.DataCmpOpts = []cmp.Option{
+				cmp.AllowUnexported(cache.Cache{}),
+				cmp.Comparer(func(a, b *statFS) bool { return a == b }),
+			}
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+
+			if !test.ignoreHistoryCheck {
+				newH := &History{}
+				if _, err := c.GetStruct(shellCacheKey, newH); err != nil {
+					t.Fatalf("Failed to read history from cache: %v", err)
+				}
+				if diff := cmp.Diff(test.wantHistory, newH); diff != "" {
+					t.Errorf("Execute(%v) produced incorrect history (-want, +got):\n%s", test.etc.Args, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestAutocomplete(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		ctc         *commandtest.CompleteTestCase
+		cwdOverride string
+	}{
+		{
+			name: "dot completes all directories",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						".git/",
+						"cmd/",
+						"testing/",
+						" ",
+					},
+				},
+			},
+		},
+		{
+			name: "dot completes all directories with command",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						".git/",
+						"cmd/",
+						"testing/",
+						" ",
+					},
+				},
+			},
+		},
+		{
+			name: "dot completes simple directory",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd c",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"cmd/",
+					},
+					SpacelessCompletion: true,
+				},
+			},
+		},
+		{
+			name: "dot handles no match",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd uhh",
+			},
+		},
+		{
+			name: "dot completes directories that match",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd te",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"testing/",
+					},
+					SpacelessCompletion: true,
+				},
+			},
+		},
+		{
+			name: "dot completes nested directories",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd testing/o",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"testing/other/",
+					},
+					SpacelessCompletion: true,
+				},
+			},
+		},
+		{
+			name: "dot completes sub directories",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd testing ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"dir1/",
+						"dir2/",
+						"links/",
+						"other/",
+						" ",
+					},
+				},
+			},
+		},
+		{
+			name: "dot completes sub nested directories",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd testing dir1/",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"another/",
+						"folderA/",
+						"folderB/",
+						" ",
+					},
+				},
+			},
+		},
+		{
+			name: "dot completes partial sub nested directories",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd testing dir1/fold",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"dir1/folder",
+					},
+					SpacelessCompletion: true,
+				},
+			},
+		},
+		{
+			name: "dot completes partial sub directories",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd testing d",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"dir",
+					},
+					SpacelessCompletion: true,
+				},
+			},
+		},
+		{
+			name: "dot completes partial sub directories",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd testing d",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"dir",
+					},
+					SpacelessCompletion: true,
+				},
+			},
+		},
+		{
+			name: "dot completion handles no match for sub directories",
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd testing um",
+			},
+		},
+		{
+			name:        "sub directory completion ignores current dir",
+			cwdOverride: commandtest.FilepathAbs(t, "testing", "dir1"),
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd testing ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"dir2/",
+						"links/",
+						"other/",
+						" ",
+					},
+				},
+			},
+		},
+		{
+			name:        "sub directory completion ignores current dir if nested",
+			cwdOverride: commandtest.FilepathAbs(t, "testing", "dir2", "something", "else"),
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd testing ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"dir1/",
+						"links/",
+						"other/",
+						" ",
+					},
+				},
+			},
+		},
+		{
+			name: "shortcut completes sub directories of its target",
+			ctc: &commandtest.CompleteTestCase{
+				Node: shortcutDot(map[string][]string{"sc": {commandtest.FilepathAbs(t, "testing", "dir1")}}).Node(),
+				Args: "cmd sc ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"another/",
+						"folderA/",
+						"folderB/",
+						" ",
+					},
+				},
+			},
+		},
+		{
+			name: "shortcut completes partial sub directories of its target",
+			ctc: &commandtest.CompleteTestCase{
+				Node: shortcutDot(map[string][]string{"sc": {commandtest.FilepathAbs(t, "testing", "dir1")}}).Node(),
+				Args: "cmd sc fo",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"folder",
+					},
+					SpacelessCompletion: true,
+				},
+			},
+		},
+		{
+			name: "shortcut with sub path completes sub directories of its full target",
+			ctc: &commandtest.CompleteTestCase{
+				Node: shortcutDot(map[string][]string{"sc": {commandtest.FilepathAbs(t, "testing"), "dir1"}}).Node(),
+				Args: "cmd sc ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"another/",
+						"folderA/",
+						"folderB/",
+						" ",
+					},
+				},
+			},
+		},
+		{
+			name: "shortcut completion ignores up flag",
+			ctc: &commandtest.CompleteTestCase{
+				Node: shortcutDot(map[string][]string{"sc": {commandtest.FilepathAbs(t, "testing", "dir1")}}).Node(),
+				Args: "cmd sc -u 2 ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"another/",
+						"folderA/",
+						"folderB/",
+						" ",
+					},
+				},
+			},
+		},
+		{
+			name:        "parent autocompletes",
+			cwdOverride: filepath.FromSlash("/abc/def/ghi/jkl"),
+			ctc: &commandtest.CompleteTestCase{
+				Node: DotCLI().Node(),
+				Args: "cmd parent ",
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						"abc",
+						"def",
+						"ghi",
+					},
+				},
+			},
+		},
+		/* Useful for commenting out tests. */
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.cwdOverride != "" {
+				commandtest.StubGetwd(t, test.cwdOverride, nil)
+			}
+
+			if test.ctc.Want != nil {
+				for i, v := range test.ctc.Want.Suggestions {
+					test.ctc.Want.Suggestions[i] = filepath.FromSlash(v)
+				}
+			}
+			test.ctc.SkipDataCheck = true
+			test.ctc.OS = &commandtest.FakeOS{}
+			commandertest.AutocompleteTest(t, test.ctc)
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	commandtest.StubValue(t, &dotName, ".")
+	wantName := "."
+	if got := DotCLI().Name(); got != wantName {
+		t.Errorf("Name() returned %q; want %q", got, wantName)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node: DotCLI().Node(),
+		Args: []string{"--help"},
+		WantStdout: strings.Join([]string{
+			"Changes directories",
+			"┳ { shortcuts } [ PATH ] [ SUB_PATH ... ] --up|-u UP --print --ls|-l --physical|-P --logical|-L",
+			"┃",
+			"┃   Go to the previous directory",
+			"┣━━ -",
+			"┃",
+			"┃   Configure which directories are suggested by completion (or print the configuration)",
+			"┣━━ completion --ignore|-i IGNORE [ IGNORE ... ] --gitignore|-g GITIGNORE --hide-hidden HIDE_HIDDEN",
+			"┃",
+			"┃   Print the completion suggestions (with descriptions) for the provided arguments, for zsh and fish completion functions",
+			"┣━━ describe [ ARGS ... ]",
+			"┃",
+			"┃   Enable or disable project environment activation (or print whether it is enabled)",
+			"┣━━ env ┳ [ ENABLED ]",
+			"┃   ┏━━━┛",
+			"┃   ┃",
+			"┃   ┃   Allow the environment files of the project that contains the directory",
+			"┃   ┣━━ allow [ DIR ]",
+			"┃   ┃",
+			"┃   ┃   Remove the project that contains the directory from the environment allowlist",
+			"┃   ┣━━ deny [ DIR ]",
+			"┃   ┃",
+			"┃   ┃   List the allowed project roots",
+			"┃   ┗━━ [list|l]",
+			"┃",
+			"┃   Run a command in a directory without changing to it",
+			"┣━━ exec TARGET [ SUB_PATH ... ] -- CMD [ CMD ... ] --up|-u UP --physical|-P --logical|-L",
+			"┃",
+			"┣━━ hist",
+			"┃",
+			"┃   Print the status of the directory index",
+			"┣━━ index ┓",
+			"┃   ┏━━━━━┛",
+			"┃   ┃",
+			"┃   ┃   Index all of the directories under the provided directories (replacing the existing index)",
+			"┃   ┣━━ build [ DIRS ... ]",
+			"┃   ┃",
+			"┃   ┃   Update the index (only directories that changed since the last update are read)",
+			"┃   ┗━━ update",
+			"┃",
+			"┃   Go to the indexed directory that best matches the query",
+			"┣━━ jump QUERY [ QUERY ... ]",
+			"┃",
+			"┃   Set how directories are listed after changing to them (or print the current format)",
+			"┣━━ listing [ FORMAT ]",
+			"┃",
+			"┣━━ parent PARENT_DIR --physical|-P --logical|-L",
+			"┃",
+			"┃   Pop the top of the directory stack and change to it",
+			"┣━━ pop",
+			"┃",
+			"┃   Push the current directory onto the directory stack and change to the target",
+			"┣━━ push TARGET [ SUB_PATH ... ] --up|-u UP --physical|-P --logical|-L",
+			"┃",
+			"┃   List the search roots (the configured roots, or $CDPATH if there are none)",
+			"┣━━ roots ┓",
+			"┃   ┏━━━━━┛",
+			"┃   ┃",
+			"┃   ┃   Add directories to the search roots",
+			"┃   ┣━━ add ROOTS [ ROOTS ... ]",
+			"┃   ┃",
+			"┃   ┃   Remove directories from the search roots",
+			"┃   ┗━━ rm ROOTS [ ROOTS ... ]",
+			"┃",
+			"┣━━ session ┓",
+			"┃   ┏━━━━━━━┛",
+			"┃   ┃",
+			"┃   ┃   List saved sessions",
+			"┃   ┣━━ [list|l]",
+			"┃   ┃",
+			"┃   ┃   Restore a saved session in the current shell",
+			"┃   ┣━━ [open|o] NAME",
+			"┃   ┃",
+			"┃   ┃   Delete a saved session",
+			"┃   ┣━━ rm NAME",
+			"┃   ┃",
+			"┃   ┃   Save the current directory, history, and directory stack as a session",
+			"┃   ┗━━ save NAME --physical|-P --logical|-L",
+			"┃",
+			"┃   List the directory stack or change to the entry at INDEX",
+			"┣━━ stack [ INDEX ]",
+			"┃",
+			"┃   Swap the current directory with the top of the directory stack",
+			"┣━━ swap-top",
+			"┃",
+			"┃   Set whether symbolic links are resolved by default (or print the current mode)",
+			"┣━━ symlinks [ MODE ]",
+			"┃",
+			"┃   Configure terminal directory reporting and titles (or print the configuration)",
+			"┣━━ terminal --osc7 OSC7 --title|-t TITLE --title-format|-f TITLE_FORMAT --title-components|-n TITLE_COMPONENTS",
+			"┃",
+			"┃   Keep the directory index, shortcuts, sessions, and visited directories up to date as directories are created, removed, and renamed (in the background)",
+			"┗━━ watch --foreground",
+			"",
+			"Arguments:",
+			"  ARGS: Arguments of the `d` command line (the last one is the argument being completed)",
+			"  CMD: Command (and its arguments) to run",
+			"  DIR: Directory in the project (defaults to the current directory)",
+			"  DIRS: Directories to index (defaults to the home directory)",
+			"  ENABLED: Whether project environment files are activated when changing directories",
+			"  FORMAT: How the directory is listed after changing to it",
+			"    InList([off ls summary])",
+			"  INDEX: Index of the stack entry to change to",
+			"    NonNegative()",
+			"  MODE: Whether symbolic links are kept (logical) or resolved (physical) by default",
+			"    InList([logical physical])",
+			"  NAME: Name of the session",
+			"    MinLength(1)",
+			"  PARENT_DIR: Name of the parent directory to go up to",
+			"  PATH: destination directory",
+			"  QUERY: Terms that the directory's path must contain (in order, as a fuzzy match)",
+			"  ROOTS: Directories searched for relative paths",
+			"  SUB_PATH: subdirectories to continue to",
+			"  TARGET: Target directory (a path or shortcut)",
+			"",
+			"Flags:",
+			"      foreground: Watch in the foreground (until interrupted) instead of in the background",
+			"  [g] gitignore: Whether directories ignored by .gitignore files are left out of suggestions",
+			"      hide-hidden: Whether hidden directories are only suggested after a leading `.` is typed",
+			"  [i] ignore: Glob patterns of directory names that are never suggested (replaces the existing patterns; an empty pattern clears them)",
+			"  [L] logical: Keep symbolic links in the destination (like `cd -L`)",
+			"  [l] ls: List the destination directory after changing to it",
+			"      osc7: Whether to report the directory to the terminal with an OSC 7 escape",
+			"  [P] physical: Resolve symbolic links in the destination (like `cd -P`)",
+			"      print: Print the absolute destination directory instead of changing to it",
+			"  [t] title: Whether to set the terminal (and tmux window) title to the directory",
+			"  [n] title-components: Number of trailing path components in the title",
+			"    NonNegative()",
+			"  [f] title-format: How the title is shortened",
+			"    InList([components project shortcut])",
+			"  [u] up: Number of directories to go up when cd-ing",
+			"    Default: 0",
+			"    NonNegative()",
+			"",
+			"Symbols:",
+			"  --: Separates the exec target from the command",
+			"  { shortcuts }: Start of new shortcut-able section. This is usable by providing the `shortcuts` keyword in this position. Run `cmd ... shortcuts --help` for more details",
+			"",
+		}, "\n"),
+	})
+}
+
+// largeTree creates a directory with n subdirectories, where the first
+// subdirectory (dir-0) also has n subdirectories.
+func largeTree(b *testing.B, n int) string {
+	b.Helper()
+	root := b.TempDir()
+	for _, dir := range []string{root, filepath.Join(root, "dir-0")} {
+		for i := 0; i < n; i++ {
+			if err := os.MkdirAll(filepath.Join(dir, fmt.Sprintf("dir-%d", i)), 0755); err != nil {
+				b.Fatalf("failed to create directory: %v", err)
+			}
+		}
+	}
+	return root
+}
+
+func BenchmarkCompleteLargeDirectory(b *testing.B) {
+	for _, n := range []int{1_000, 10_000, 50_000} {
+		root := largeTree(b, n)
+		for _, bc := range []struct {
+			name   string
+			cached bool
+			typed  string
+		}{
+			{"uncached", false, ""},
+			{"cached", true, ""},
+			{"uncached prefix", false, "dir-42"},
+			{"cached prefix", true, "dir-42"},
+			{"cached nested", true, "dir-0/dir-42"},
+		} {
+			b.Run(fmt.Sprintf("%d/%s", n, bc.name), func(b *testing.B) {
+				c, err := cache.FromDir(b.TempDir())
+				if err != nil {
+					b.Fatalf("failed to create cache: %v", err)
+				}
+				prev := listingCache
+				listingCache = func() (*cache.Cache, error) {
+					if !bc.cached {
+						return nil, fmt.Errorf("listing cache disabled")
+					}
+					return c, nil
+				}
+				b.Cleanup(func() { listingCache = prev })
+
+				dc := &dirCompletion{Directory: root}
+				// Populate the listing cache.
+				if _, err := dc.Complete(bc.typed, &command.Data{}); err != nil {
+					b.Fatalf("Complete(%q) returned error: %v", bc.typed, err)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := dc.Complete(bc.typed, &command.Data{}); err != nil {
+						b.Fatalf("Complete(%q) returned error: %v", bc.typed, err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package cd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	describeArgs = commander.ListArg[string]("ARGS", "Arguments of the `d` command line (the last one is the argument being completed)", 0, command.UnboundedList)
+)
+
+// describingOS is the operating system used when completing for `d describe`.
+// Completers record the descriptions of their suggestions in it (completers
+// don't otherwise compute descriptions, since bash can't display them).
+type describingOS struct {
+	command.OS
+	// descriptions is a map from suggestion to its description.
+	descriptions map[string]string
+	// order is a map from suggestion to its position in the ranked
+	// suggestions (see keepOrder).
+	order map[string]int
+	// visits are the visited directories (loaded once, when the first directory
+	// is described).
+	visits *Visits
+}
+
+// getVisits returns the visited directories (or nil if they can't be loaded).
+func (dos *describingOS) getVisits() *Visits {
+	if dos.visits == nil {
+		dos.visits = &Visits{}
+		if _, v, err := getVisits(); err == nil {
+			dos.visits = v
+		}
+	}
+	return dos.visits
+}
+
+// describing returns the descriptions to record suggestions in (or false if
+// the suggestions aren't being described).
+func describing(data *command.Data) (map[string]string, bool) {
+	dos, ok := data.OS.(*describingOS)
+	if !ok {
+		return nil, false
+	}
+	return dos.descriptions, true
+}
+
+// describeSuggestions records the descriptions of the directories that the
+// suggestions refer to (pathFunc returns a suggestion's absolute path). A
+// single suggestion is completed directly, so it isn't described.
+func describeSuggestions(data *command.Data, c *command.Completion, pathFunc func(string) string) {
+	descs, ok := describing(data)
+	if !ok || c == nil || len(c.Suggestions) <= 1 {
+		return
+	}
+	for _, s := range c.Suggestions {
+		if s == " " {
+			continue
+		}
+		if desc := describeDir(data, pathFunc(s)); desc != "" {
+			descs[s] = desc
+		}
+	}
+}
+
+// describeShortcuts records the target directories of the shortcut
+// suggestions.
+func (d *Dot) describeShortcuts(data *command.Data, c *command.Completion) {
+	descs, ok := describing(data)
+	if !ok || c == nil {
+		return
+	}
+	scs := d.dirShortcuts()
+	for _, s := range c.Suggestions {
+		dirs, ok := scs[s]
+		if !ok || len(dirs) == 0 {
+			continue
+		}
+		desc := "shortcut: " + strings.Join(dirs, " ")
+		if dd := describeDir(data, dirs[0]); dd != "" {
+			desc += ", " + dd
+		}
+		descs[s] = desc
+	}
+}
+
+// prefixDescription adds the prefix to the start of a suggestion's
+// description.
+func prefixDescription(data *command.Data, s, prefix string) {
+	descs, ok := describing(data)
+	if !ok {
+		return
+	}
+	if desc := descs[s]; desc != "" {
+		prefix += ", " + desc
+	}
+	descs[s] = prefix
+}
+
+// moveDescription moves a suggestion's description to the suggestion it was
+// rewritten to.
+func moveDescription(data *command.Data, from, to string) {
+	descs, ok := describing(data)
+	if !ok {
+		return
+	}
+	if desc, ok := descs[from]; ok {
+		delete(descs, from)
+		descs[to] = desc
+	}
+}
+
+// describeDir returns how many levels up the directory is (if it is a parent
+// of the working directory), when it was last visited, and its git branch (if
+// it is a repository root).
+func describeDir(data *command.Data, dir string) string {
+	var parts []string
+	if data.Has(commander.GetwdKey) {
+		if n, ok := levelsUp(workingDir(data), dir); ok {
+			parts = append(parts, fmt.Sprintf("%d %s up", n, plural(n, "level")))
+		}
+	}
+	if vis, ok := completionVisits(data).Dirs[dir]; ok {
+		parts = append(parts, "visited "+ago(timeNow().Sub(time.Unix(vis.Last, 0))))
+	}
+	fsys := filesystem(data)
+	if _, err := fsys.Stat(filepath.Join(dir, ".git")); err == nil {
+		if b, ok := gitBranch(fsys, dir); ok {
+			parts = append(parts, "git: "+b)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// levelsUp returns the number of directories between wd and its parent
+// directory dir (or false if dir isn't a parent of wd).
+func levelsUp(wd, dir string) (int, bool) {
+	n := 1
+	for prev, pwd := wd, filepath.Dir(wd); pwd != prev; prev, pwd = pwd, filepath.Dir(pwd) {
+		if pwd == dir {
+			return n, true
+		}
+		n++
+	}
+	return 0, false
+}
+
+// ago returns a short, human-readable duration (e.g. "3h ago").
+func ago(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
+
+// quoteCompLine returns the arguments as a command line that is parsed back
+// into the same arguments. Only arguments that need quoting are quoted (so
+// the suggestions for the last argument aren't quoted).
+func quoteCompLine(args []string) string {
+	sl := []string{dotName}
+	for _, a := range args {
+		if strings.ContainsAny(a, " \t\"'\\") {
+			a = shells["bash"].Quote(a)
+		}
+		sl = append(sl, a)
+	}
+	return strings.Join(sl, " ")
+}
+
+// describeNode prints the suggestions for completing a `d` command line along
+// with their descriptions. Bash completion can't display descriptions, so the
+// output is for shells that can (zsh's `_describe` uses `name:description`
+// lines and fish uses `name<TAB>description` lines).
+func (d *Dot) describeNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Print the completion suggestions (with descriptions) for the provided arguments, for zsh and fish completion functions"),
+		describeArgs,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			args := describeArgs.Get(data)
+			dos := &describingOS{OS: data.OS, descriptions: map[string]string{}}
+			ac, err := commander.Autocomplete(d.Node(), quoteCompLine(args), nil, dos)
+			if err != nil {
+				return o.Err(err)
+			}
+			// Directory suggestions are relative to the typed directory (which bash
+			// keeps), but zsh and fish replace the whole argument.
+			var laDir string
+			if len(args) > 0 {
+				laDir, _ = filepath.Split(args[len(args)-1])
+			}
+			var sl []string
+			for _, s := range ac.Suggestions {
+				if strings.TrimSpace(s) == "" {
+					continue
+				}
+				// The descriptions are recorded for the unescaped suggestions, and zsh
+				// and fish escape the suggestions that they insert.
+				sl = append(sl, strings.ReplaceAll(s, `\ `, " "))
+			}
+			// The completion library sorts the suggestions, so restore their ranking.
+			if dos.order != nil {
+				sort.SliceStable(sl, func(i, j int) bool {
+					oi, ok := dos.order[sl[i]]
+					if !ok {
+						oi = len(dos.order)
+					}
+					oj, ok := dos.order[sl[j]]
+					if !ok {
+						oj = len(dos.order)
+					}
+					return oi < oj
+				})
+			}
+			zsh := shellFromData(data).Name() == "zsh"
+			for _, s := range sl {
+				desc := dos.descriptions[s]
+				if !strings.HasPrefix(s, laDir) {
+					s = laDir + s
+				}
+				switch {
+				case zsh:
+					s = strings.ReplaceAll(s, ":", `\:`)
+					if desc != "" {
+						s += ":" + desc
+					}
+				case desc != "":
+					s += "\t" + desc
+				}
+				o.Stdoutln(s)
+			}
+			return nil
+		}},
+	)
+}
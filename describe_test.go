@@ -0,0 +1,183 @@
+package cd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestDescribe(t *testing.T) {
+	root := listingDir(t, map[string]string{
+		"repo/.git/HEAD":     "ref: refs/heads/main\n",
+		"repo/api/":          "",
+		"repo/web/.git/HEAD": "ref: refs/heads/dev\n",
+		"repo/rest/app/":     "",
+		"repo/rest/apps/":    "",
+		"repo/rest/ap/":      "",
+		"spaced/my dir/":     "",
+		"spaced/my docs/":    "",
+	})
+	repo := filepath.Join(root, "repo")
+	now := time.Unix(1_000_000_000, 0)
+	visits := &Visits{Dirs: map[string]*Visit{
+		filepath.Join(repo, "api"):              {Count: 3, Last: now.Add(-2 * time.Hour).Unix()},
+		repo:                                    {Count: 1, Last: now.Add(-3 * 24 * time.Hour).Unix()},
+		filepath.Join(root, "spaced", "my dir"): {Count: 1, Last: now.Add(-time.Hour).Unix()},
+	}}
+	d := &Dot{
+		fsys:       &statFS{host: "host"},
+		Completion: &CompletionFilter{HideHidden: true},
+		Shortcuts: map[string]map[string][]string{
+			dirShortcutName: {
+				"w:api": {filepath.Join(repo, "api")},
+				"w:web": {filepath.Join(repo, "web")},
+			},
+		},
+	}
+
+	rd := &Dot{
+		fsys:        d.fsys,
+		SearchRoots: []string{filepath.Join(repo, "rest")},
+	}
+
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		wd   string
+		args []string
+		zsh  bool
+		want []string
+	}{
+		{
+			name: "describes relative directories",
+			wd:   repo,
+			args: []string{"./"},
+			want: []string{
+				"./api/\tvisited 2h ago",
+				"./rest/",
+				"./web/\tgit: dev",
+			},
+		},
+		{
+			name: "describes parent directories",
+			wd:   filepath.Join(repo, "rest", "app"),
+			args: []string{"parent", "re"},
+			want: []string{
+				"repo\t2 levels up, visited 3d ago, git: main",
+				"rest\t1 level up",
+			},
+		},
+		{
+			name: "describes sub paths",
+			wd:   root,
+			args: []string{repo, ""},
+			want: []string{
+				"api/\tvisited 2h ago",
+				"rest/",
+				"web/\tgit: dev",
+			},
+		},
+		{
+			name: "describes shortcuts",
+			wd:   root,
+			args: []string{"w:"},
+			want: []string{
+				fmt.Sprintf("w:api\tshortcut: %s, visited 2h ago", filepath.Join(repo, "api")),
+				fmt.Sprintf("w:web\tshortcut: %s, git: dev", filepath.Join(repo, "web")),
+			},
+		},
+		{
+			name: "formats descriptions for zsh",
+			wd:   root,
+			args: []string{"w:"},
+			zsh:  true,
+			want: []string{
+				fmt.Sprintf(`w\:api:shortcut: %s, visited 2h ago`, filepath.Join(repo, "api")),
+				fmt.Sprintf(`w\:web:shortcut: %s, git: dev`, filepath.Join(repo, "web")),
+			},
+		},
+		{
+			name: "describes search roots",
+			d:    rd,
+			wd:   repo,
+			args: []string{"ap"},
+			// The current directory's suggestions are first.
+			want: []string{
+				"api/\tvisited 2h ago",
+				fmt.Sprintf("ap/\tin %s", filepath.Join(repo, "rest")),
+				fmt.Sprintf("app/\tin %s", filepath.Join(repo, "rest")),
+				fmt.Sprintf("apps/\tin %s", filepath.Join(repo, "rest")),
+			},
+		},
+		{
+			name: "describes suggestions with spaces",
+			wd:   root,
+			args: []string{"spaced/my d"},
+			want: []string{
+				"spaced/my dir/\tvisited 1h ago",
+				"spaced/my docs/",
+			},
+		},
+		{
+			name: "single suggestion isn't described",
+			wd:   repo,
+			args: []string{"ap"},
+			want: []string{
+				"api/",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.d == nil {
+				test.d = d
+			}
+			// Relative directories are completed from the process's working
+			// directory.
+			prev, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("failed to get working directory: %v", err)
+			}
+			if err := os.Chdir(test.wd); err != nil {
+				t.Fatalf("failed to change directory: %v", err)
+			}
+			t.Cleanup(func() { os.Chdir(prev) })
+			commandtest.StubGetwd(t, test.wd, nil)
+			commandtest.StubValue(t, &timeNow, func() time.Time { return now })
+			vc := cachetest.NewTestCache(t)
+			if err := vc.PutStruct(visitsCacheKey, visits); err != nil {
+				t.Fatalf("failed to store visits: %v", err)
+			}
+			var loads int
+			commandtest.StubValue(t, &visitsCache, func() (*cache.Cache, error) {
+				loads++
+				return vc, nil
+			})
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+			env := map[string]string{}
+			if test.zsh {
+				env[zshEnvVar] = "1"
+			}
+
+			commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+				Node:          test.d.Node(),
+				Args:          append([]string{"describe"}, test.args...),
+				OS:            &commandtest.FakeOS{},
+				Env:           env,
+				WantStdout:    strings.Join(test.want, "\n") + "\n",
+				SkipDataCheck: true,
+			})
+			// The visits are loaded once (not once per suggestion).
+			if loads > 1 {
+				t.Errorf("describe loaded the visits %d times; want at most once", loads)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package cd
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// cutDots splits a leading multi-dot component (e.g. `...` in `.../foo`)
+// from the path. N dots go up N-1 directories, so the returned prefix is the
+// equivalent `../../` path (with forward slashes).
+func cutDots(p string) (dots, up, rest string, ok bool) {
+	first, rest, _ := strings.Cut(filepath.ToSlash(p), "/")
+	if len(first) < 3 || strings.Trim(first, ".") != "" {
+		return "", "", "", false
+	}
+	return first, strings.Repeat("../", len(first)-1), rest, true
+}
+
+// expandDots replaces a leading multi-dot component in the path with the
+// equivalent `..` components.
+func expandDots(p string) string {
+	if _, up, rest, ok := cutDots(p); ok {
+		return filepath.FromSlash(filepath.Join(up, rest))
+	}
+	return p
+}
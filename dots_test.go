@@ -0,0 +1,148 @@
+package cd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestExpandDots(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{".", "."},
+		{"..", ".."},
+		{"../a", filepath.FromSlash("../a")},
+		{"...", filepath.FromSlash("../..")},
+		{"....", filepath.FromSlash("../../..")},
+		{".../", filepath.FromSlash("../..")},
+		{".../foo/bar", filepath.FromSlash("../../foo/bar")},
+		{"..../foo", filepath.FromSlash("../../../foo")},
+		{"...foo", "...foo"},
+		{"foo/...", "foo/..."},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			if got := expandDots(test.path); got != test.want {
+				t.Errorf("expandDots(%q) returned %q; want %q", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDots(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "goes up with dots",
+			args: []string{"..."},
+			want: "/a/b/c",
+		},
+		{
+			name: "goes up more with dots",
+			args: []string{"....."},
+			want: "/a",
+		},
+		{
+			name: "goes up and down with dots",
+			args: []string{".../foo/bar"},
+			want: "/a/b/c/foo/bar",
+		},
+		{
+			name: "combines dots with sub paths",
+			args: []string{"..../foo", "bar"},
+			want: "/a/b/foo/bar",
+		},
+		{
+			name: "combines dots with up flag",
+			args: []string{"...", "-u", "1"},
+			want: "/a/b",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			wd := filepath.FromSlash("/a/b/c/d/e")
+			commandtest.StubGetwd(t, wd, nil)
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+				Node: (&Dot{fsys: &statFS{wd: wd, stat: dirStat}}).Node(),
+				Args: test.args,
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.FromSlash(test.want))},
+				},
+				OS:            &commandtest.FakeOS{},
+				SkipDataCheck: true,
+			})
+		})
+	}
+}
+
+func TestDotsAutocomplete(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		args string
+		want *command.Autocompletion
+	}{
+		{
+			name: "completes after dots",
+			args: "cmd .../",
+			want: &command.Autocompletion{
+				// The current directory's parent (dir1) is excluded.
+				Suggestions: []string{
+					"dir2/",
+					"links/",
+					"other/",
+					" ",
+				},
+			},
+		},
+		{
+			name: "completes partial directory after dots",
+			args: "cmd .../o",
+			want: &command.Autocompletion{
+				Suggestions:         []string{".../other/"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "completes nested directory after dots",
+			args: "cmd ..../testing/dir1/folderB",
+			want: &command.Autocompletion{
+				Suggestions:         []string{"..../testing/dir1/folderB/"},
+				SpacelessCompletion: true,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// FileCompleter resolves relative directories from the process's
+			// working directory.
+			wd := commandtest.FilepathAbs(t, "testing", "dir1", "folderA")
+			prev, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("failed to get working directory: %v", err)
+			}
+			if err := os.Chdir(wd); err != nil {
+				t.Fatalf("failed to change directory: %v", err)
+			}
+			t.Cleanup(func() { os.Chdir(prev) })
+			commandtest.StubGetwd(t, wd, nil)
+			commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+				Node:          DotCLI().Node(),
+				Args:          test.args,
+				Want:          test.want,
+				SkipDataCheck: true,
+				OS:            &commandtest.FakeOS{},
+			})
+		})
+	}
+}
@@ -0,0 +1,516 @@
+package cd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	// envCacheDirEnvVar overrides the directory of the persistent cache that
+	// holds the environment allowlist (and other data shared across shells).
+	envCacheDirEnvVar = "LEEP_CD_CACHE_DIR"
+	// envActiveEnvVar holds the project environment that is activated in the
+	// shell. It is set by the same command as the cd (rather than saved in the
+	// shell cache) so it is only updated if the cd succeeds.
+	envActiveEnvVar   = "LEEP_CD_ENV_ACTIVE"
+	envAllowCacheKey  = "leep-cd-env-allow"
+	envWarnedCacheKey = "leep-cd-env-warned"
+
+	venvDir          = ".venv"
+	nvmrcFile        = ".nvmrc"
+	toolVersionsFile = ".tool-versions"
+	dotEnvFile       = ".env"
+)
+
+var (
+	// envFiles are the files (or directories) that mark the root of a project
+	// environment, in the order they are activated.
+	envFiles = []string{venvDir, nvmrcFile, toolVersionsFile, dotEnvFile}
+	// venvActivateScripts are the scripts (relative to a virtual environment)
+	// that `shell.Activate` runs.
+	venvActivateScripts = []string{
+		filepath.Join("bin", "activate"),
+		filepath.Join("bin", "activate.fish"),
+		filepath.Join("Scripts", "Activate.ps1"),
+	}
+
+	envVarNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// envCache returns the persistent (not shell-level) cache that holds the
+	// environment allowlist (and other data shared across shells).
+	envCache = func() (*cache.Cache, error) {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user cache directory: %v", err)
+		}
+		return cache.FromEnvVarOrDir(envCacheDirEnvVar, filepath.Join(dir, "leep-cd"))
+	}
+
+	// miseEnv returns the variables that mise sets in the directory (from its
+	// `.tool-versions` file).
+	miseEnv = func(dir string) (map[string]string, error) {
+		cmd := exec.Command("mise", "env", "--json")
+		cmd.Dir = dir
+		b, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to run mise: %v", err)
+		}
+		m := map[string]string{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("failed to parse mise environment: %v", err)
+		}
+		return m, nil
+	}
+
+	envEnabledArg = commander.OptionalArg[bool]("ENABLED", "Whether project environment files are activated when changing directories")
+	envDirArg     = commander.OptionalArg[string]("DIR", "Directory in the project (defaults to the current directory)",
+		dirArgCompleter(),
+	)
+)
+
+// EnvAllowlist is the set of project roots whose environment files may be
+// activated (similar to `direnv allow`).
+type EnvAllowlist struct {
+	// Roots is a map from project root to the hash of its environment files
+	// when they were allowed, so edited files must be allowed again.
+	Roots map[string]string
+}
+
+// EnvWarnings are the project environments that the current shell was warned
+// about (so each is only warned about once until its files change).
+type EnvWarnings struct {
+	// Roots is a map from project root to the hash of its environment files
+	// when the shell was warned.
+	Roots map[string]string
+}
+
+// ActiveEnv is the project environment that is activated in the current shell.
+type ActiveEnv struct {
+	Root string
+	// Venv is whether a Python virtual environment was activated.
+	Venv bool
+	// Node is whether a node version was selected with nvm.
+	Node bool
+	// Vars are the variables that were exported from the `.env` file (and by
+	// mise), in the order they were set.
+	Vars []*EnvVar
+}
+
+// EnvVar is a variable that was set by a project environment.
+type EnvVar struct {
+	Name string
+	// Prev is the value of the variable before it was set.
+	Prev string
+	// Unset is whether the variable wasn't set before.
+	Unset bool
+}
+
+// activeEnv returns the project environment that is activated in the shell.
+func activeEnv() (*ActiveEnv, error) {
+	ae := &ActiveEnv{}
+	v, ok := command.OSLookupEnv(envActiveEnvVar)
+	if !ok || v == "" {
+		return ae, nil
+	}
+	if err := json.Unmarshal([]byte(v), ae); err != nil {
+		return nil, fmt.Errorf("failed to parse active environment: %v", err)
+	}
+	return ae, nil
+}
+
+// save returns the command that records the project environment in the
+// shell.
+func (ae *ActiveEnv) save(sh shell) (string, error) {
+	if ae.Root == "" {
+		return sh.UnsetEnv(envActiveEnvVar), nil
+	}
+	b, err := json.Marshal(ae)
+	if err != nil {
+		return "", fmt.Errorf("failed to save active environment: %v", err)
+	}
+	return sh.SetEnv(envActiveEnvVar, string(b)), nil
+}
+
+// original returns the value of the variable from before the project
+// environment was activated.
+func (ae *ActiveEnv) original(name string) (string, bool) {
+	for _, v := range ae.Vars {
+		if v.Name == name {
+			return v.Prev, !v.Unset
+		}
+	}
+	return command.OSLookupEnv(name)
+}
+
+// envRoot returns the nearest directory (walking up from dir) that contains
+// any environment files, along with the files it contains.
+func envRoot(fsys FS, dir string) (string, []string, bool) {
+	for prev := ""; dir != prev; prev, dir = dir, filepath.Dir(dir) {
+		var fs []string
+		for _, f := range envFiles {
+			if _, err := fsys.Stat(filepath.Join(dir, f)); err == nil {
+				fs = append(fs, f)
+			}
+		}
+		if len(fs) > 0 {
+			return dir, fs, true
+		}
+	}
+	return "", nil, false
+}
+
+// envHash returns the hash of the environment files in the project root. A
+// virtual environment is hashed by its activate scripts (which are what is
+// run).
+func envHash(fsys FS, root string, files []string) (string, error) {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00", f)
+		paths := []string{f}
+		if f == venvDir {
+			paths = nil
+			for _, s := range venvActivateScripts {
+				paths = append(paths, filepath.Join(venvDir, s))
+			}
+		}
+		for _, p := range paths {
+			b, err := fsys.ReadFile(filepath.Join(root, p))
+			if f == venvDir && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return "", fmt.Errorf("failed to read environment file: %v", err)
+			}
+			fmt.Fprintf(h, "%s\x00", p)
+			h.Write(b)
+			h.Write([]byte{0})
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func getEnvAllowlist() (*cache.Cache, *EnvAllowlist, error) {
+	c, err := envCache()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get environment cache: %v", err)
+	}
+	a := &EnvAllowlist{}
+	if _, err := c.GetStruct(envAllowCacheKey, a); err != nil {
+		return nil, nil, fmt.Errorf("failed to get environment allowlist: %v", err)
+	}
+	if a.Roots == nil {
+		a.Roots = map[string]string{}
+	}
+	return c, a, nil
+}
+
+// parseDotEnv returns the variables (in order) set by a `.env` file. Blank
+// lines, comments, and lines with invalid variable names are ignored.
+func parseDotEnv(b []byte) [][2]string {
+	var r [][2]string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		k, v, ok := strings.Cut(line, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || !envVarNameRegex.MatchString(k) {
+			continue
+		}
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		r = append(r, [2]string{k, v})
+	}
+	return r
+}
+
+// envCommands returns the commands that deactivate the environment of the
+// project being left and activate the environment of the project being
+// entered (if it is allowed). The commands must only be run after the cd
+// succeeds.
+func (d *Dot) envCommands(sh shell, data *command.Data, dir string) ([]string, error) {
+	if !d.Env {
+		return nil, nil
+	}
+	abs, err := absoluteDir(data, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := cache.ShellFromData(data)
+	active, err := activeEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	root, files, ok := envRoot(filesystem(data), abs)
+	if ok && root == active.Root {
+		return nil, nil
+	}
+
+	next := &ActiveEnv{}
+	var activate []string
+	if ok {
+		_, a, err := getEnvAllowlist()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := envHash(filesystem(data), root, files)
+		if err != nil {
+			return nil, err
+		}
+		// Only warn about each version of a project's files once per shell.
+		allowed, isAllowed := a.Roots[root]
+		if allowed == hash {
+			if activate, err = next.activate(filesystem(data), sh, active, root, files); err != nil {
+				return nil, err
+			}
+		} else if warn, err := envWarning(c, root, hash); err != nil {
+			return nil, err
+		} else if warn && !isAllowed {
+			activate = append(activate, sh.Echo(fmt.Sprintf("Environment files in %s are not allowed (run `d env allow` to allow them)", root)))
+		} else if warn {
+			activate = append(activate, sh.Echo(fmt.Sprintf("Environment files in %s changed since they were allowed (run `d env allow` to allow them again)", root)))
+		}
+	}
+
+	if active.Root == "" && next.Root == "" {
+		return activate, nil
+	}
+	// The new environment is recorded before it is activated, so if activating
+	// it fails, leaving the project still undoes what was activated.
+	save, err := next.save(sh)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(active.deactivate(sh), save), activate...), nil
+}
+
+// envWarning returns whether the shell should be warned about the project's
+// (unallowed) environment files and records the warning.
+func envWarning(c *cache.Cache, root, hash string) (bool, error) {
+	w := &EnvWarnings{}
+	if _, err := c.GetStruct(envWarnedCacheKey, w); err != nil {
+		return false, fmt.Errorf("failed to get environment warnings: %v", err)
+	}
+	if w.Roots[root] == hash {
+		return false, nil
+	}
+	if w.Roots == nil {
+		w.Roots = map[string]string{}
+	}
+	w.Roots[root] = hash
+	if err := c.PutStruct(envWarnedCacheKey, w); err != nil {
+		return false, fmt.Errorf("failed to save environment warnings: %v", err)
+	}
+	return true, nil
+}
+
+// activate returns the commands that activate the environment files in the
+// project root and records what was activated. The values that variables are
+// restored to are looked up in the environment that is being left (prev).
+func (ae *ActiveEnv) activate(fsys FS, sh shell, prev *ActiveEnv, root string, files []string) ([]string, error) {
+	ae.Root = root
+	var r []string
+	setEnv := func(name, value string) {
+		set := false
+		for _, v := range ae.Vars {
+			set = set || v.Name == name
+		}
+		if !set {
+			p, ok := prev.original(name)
+			ae.Vars = append(ae.Vars, &EnvVar{Name: name, Prev: p, Unset: !ok})
+		}
+		r = append(r, sh.SetEnv(name, value))
+	}
+	for _, f := range files {
+		p := filepath.Join(root, f)
+		switch f {
+		case venvDir:
+			ae.Venv = true
+			r = append(r, sh.Activate(p))
+		case nvmrcFile:
+			b, err := fsys.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read environment file: %v", err)
+			}
+			if v := strings.TrimSpace(string(b)); v != "" {
+				ae.Node = true
+				r = append(r, fmt.Sprintf("nvm use %s", sh.Quote(v)))
+			}
+		case toolVersionsFile:
+			// mise reads `.tool-versions` (like asdf). Its variables are set
+			// directly (rather than evaluating `mise env`) so they can be restored.
+			vars, err := miseEnv(root)
+			if err != nil {
+				r = append(r, sh.Echo(fmt.Sprintf("Not activating %s: %v", p, err)))
+				continue
+			}
+			var names []string
+			for k := range vars {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			for _, k := range names {
+				setEnv(k, vars[k])
+			}
+		case dotEnvFile:
+			b, err := fsys.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read environment file: %v", err)
+			}
+			for _, kv := range parseDotEnv(b) {
+				setEnv(kv[0], kv[1])
+			}
+		}
+	}
+	return r, nil
+}
+
+// deactivate returns the commands that undo activate.
+func (ae *ActiveEnv) deactivate(sh shell) []string {
+	var r []string
+	if ae.Venv {
+		r = append(r, "deactivate")
+	}
+	if ae.Node {
+		r = append(r, "nvm deactivate")
+	}
+	for _, v := range ae.Vars {
+		if v.Unset {
+			r = append(r, sh.UnsetEnv(v.Name))
+		} else {
+			r = append(r, sh.SetEnv(v.Name, v.Prev))
+		}
+	}
+	return r
+}
+
+// envDir returns the absolute directory provided to an env branch.
+func envDir(data *command.Data) string {
+	dir := commander.Getwd.Get(data)
+	if data.Has(envDirArg.Name()) {
+		if p := envDirArg.Get(data); filepath.IsAbs(p) {
+			dir = p
+		} else {
+			dir = filepath.Join(dir, p)
+		}
+	}
+	return filepath.Clean(dir)
+}
+
+func (d *Dot) envNode() command.Node {
+	return &commander.BranchNode{
+		Branches: map[string]command.Node{
+			"allow":  d.envAllowNode(),
+			"deny":   d.envDenyNode(),
+			"list l": envListNode(),
+		},
+		Default: commander.SerialNodes(
+			commander.Description("Enable or disable project environment activation (or print whether it is enabled)"),
+			envEnabledArg,
+			&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+				if !data.Has(envEnabledArg.Name()) {
+					o.Stdoutln(d.Env)
+					return nil
+				}
+				d.Env = envEnabledArg.Get(data)
+				d.MarkChanged()
+				return nil
+			}},
+		),
+	}
+}
+
+func (d *Dot) envAllowNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Allow the environment files of the project that contains the directory"),
+		d.getwd(),
+		envDirArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			dir := envDir(data)
+			root, files, ok := envRoot(d.filesystem(), dir)
+			if !ok {
+				return o.Stderrf("no environment files found in %s or its parents\n", dir)
+			}
+			hash, err := envHash(d.filesystem(), root, files)
+			if err != nil {
+				return o.Err(err)
+			}
+			c, a, err := getEnvAllowlist()
+			if err != nil {
+				return o.Err(err)
+			}
+			a.Roots[root] = hash
+			if err := c.PutStruct(envAllowCacheKey, a); err != nil {
+				return o.Annotate(err, "failed to save environment allowlist")
+			}
+			return nil
+		}},
+	)
+}
+
+func (d *Dot) envDenyNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Remove the project that contains the directory from the environment allowlist"),
+		d.getwd(),
+		envDirArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			c, a, err := getEnvAllowlist()
+			if err != nil {
+				return o.Err(err)
+			}
+			// Check the directory itself first in case its environment files were
+			// already removed.
+			root := envDir(data)
+			if _, ok := a.Roots[root]; !ok {
+				if r, _, ok := envRoot(d.filesystem(), root); ok {
+					root = r
+				}
+			}
+			if _, ok := a.Roots[root]; !ok {
+				return o.Stderrf("%s is not allowed\n", root)
+			}
+			delete(a.Roots, root)
+			if err := c.PutStruct(envAllowCacheKey, a); err != nil {
+				return o.Annotate(err, "failed to save environment allowlist")
+			}
+			return nil
+		}},
+	)
+}
+
+func envListNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("List the allowed project roots"),
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			_, a, err := getEnvAllowlist()
+			if err != nil {
+				return o.Err(err)
+			}
+			for _, root := range sortedKeys(a.Roots) {
+				o.Stdoutln(root)
+			}
+			return nil
+		}},
+	)
+}
@@ -0,0 +1,506 @@
+package cd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// allowedHash returns the current hash of the environment files in root.
+func allowedHash(t *testing.T, root string) string {
+	t.Helper()
+	r, files, ok := envRoot(osFS{}, root)
+	if !ok || r != root {
+		t.Fatalf("envRoot(%q) returned (%q, %v); want (%q, true)", root, r, ok, root)
+	}
+	h, err := envHash(osFS{}, root, files)
+	if err != nil {
+		t.Fatalf("failed to hash environment files: %v", err)
+	}
+	return h
+}
+
+// activeEnvCmd returns the command that records the active environment in
+// the shell.
+func activeEnvCmd(t *testing.T, sh string, ae *ActiveEnv) string {
+	t.Helper()
+	b, err := json.Marshal(ae)
+	if err != nil {
+		t.Fatalf("failed to marshal active environment: %v", err)
+	}
+	return shells[sh].SetEnv(envActiveEnvVar, string(b))
+}
+
+func TestEnv(t *testing.T) {
+	py := listingDir(t, map[string]string{
+		".venv/":         "",
+		".nvmrc":         "v20\n",
+		".tool-versions": "golang 1.22\n",
+		".env":           "# comment\nexport API_URL=\"http://it's\"\n\nDEBUG=1\n1BAD=x\n",
+		"src/pkg/":       "",
+	})
+	node := listingDir(t, map[string]string{
+		".nvmrc": "lts/iron",
+	})
+	plain := listingDir(t, map[string]string{
+		"one/": "",
+	})
+	// pyEnv is the environment that pyActive was activated in.
+	pyEnv := map[string]string{"PATH": "/usr/bin", "DEBUG": "0"}
+	pyActive := &ActiveEnv{Root: py, Venv: true, Node: true, Vars: []*EnvVar{
+		{Name: "GOROOT", Unset: true},
+		{Name: "PATH", Prev: "/usr/bin"},
+		{Name: "API_URL", Unset: true},
+		{Name: "DEBUG", Prev: "0"},
+	}}
+	nodeActive := &ActiveEnv{Root: node, Node: true}
+
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		want *Dot
+		env  map[string]string
+		cwd  string
+		// allowed is the set of allowed roots (the current hash is used if the
+		// value is empty).
+		allowed     map[string]string
+		wantAllowed []string
+		// active is the environment that is activated in the shell.
+		active  *ActiveEnv
+		miseErr error
+		// warned is the set of roots the shell was warned about (the current
+		// hash is used if the value is empty).
+		warned     map[string]string
+		wantWarned []string
+		etc        *commandtest.ExecuteTestCase
+	}{
+		{
+			name:    "does nothing when disabled",
+			d:       &Dot{},
+			allowed: map[string]string{py: ""},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(py)},
+				},
+			},
+		},
+		{
+			name:       "warns about unallowed environment",
+			d:          &Dot{Env: true},
+			wantWarned: []string{py},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{strings.Join([]string{
+						bashCd(py),
+						fmt.Sprintf("printf '%%s\\n' 'Environment files in %s are not allowed (run `d env allow` to allow them)'", py),
+					}, " && ")},
+				},
+			},
+		},
+		{
+			name:       "only warns about unallowed environment once",
+			d:          &Dot{Env: true},
+			warned:     map[string]string{py: ""},
+			wantWarned: []string{py},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py, "src"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(py, "src"))},
+				},
+			},
+		},
+		{
+			name:       "warns again when unallowed environment changes",
+			d:          &Dot{Env: true},
+			warned:     map[string]string{py: "old-hash"},
+			wantWarned: []string{py},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{strings.Join([]string{
+						bashCd(py),
+						fmt.Sprintf("printf '%%s\\n' 'Environment files in %s are not allowed (run `d env allow` to allow them)'", py),
+					}, " && ")},
+				},
+			},
+		},
+		{
+			name:       "warns about changed environment",
+			d:          &Dot{Env: true},
+			allowed:    map[string]string{py: "old-hash"},
+			wantWarned: []string{py},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{strings.Join([]string{
+						bashCd(py),
+						fmt.Sprintf("printf '%%s\\n' 'Environment files in %s changed since they were allowed (run `d env allow` to allow them again)'", py),
+					}, " && ")},
+				},
+			},
+		},
+		{
+			name:    "activates environment from sub directory",
+			d:       &Dot{Env: true},
+			env:     pyEnv,
+			allowed: map[string]string{py: ""},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py, "src", "pkg"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{strings.Join([]string{
+						bashCd(filepath.Join(py, "src", "pkg")),
+						activeEnvCmd(t, "bash", pyActive),
+						fmt.Sprintf(". '%s'", filepath.Join(py, ".venv", "bin", "activate")),
+						"nvm use 'v20'",
+						"export GOROOT='/mise/go'",
+						"export PATH='/mise/go/bin:/usr/bin'",
+						`export API_URL='http://it'\''s'`,
+						"export DEBUG='1'",
+					}, " && ")},
+				},
+			},
+		},
+		{
+			name:    "warns when mise fails",
+			d:       &Dot{Env: true},
+			env:     pyEnv,
+			allowed: map[string]string{py: ""},
+			miseErr: fmt.Errorf("failed to run mise: exit status 1"),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{strings.Join([]string{
+						bashCd(py),
+						activeEnvCmd(t, "bash", &ActiveEnv{Root: py, Venv: true, Node: true, Vars: []*EnvVar{
+							{Name: "API_URL", Unset: true},
+							{Name: "DEBUG", Prev: "0"},
+						}}),
+						fmt.Sprintf(". '%s'", filepath.Join(py, ".venv", "bin", "activate")),
+						"nvm use 'v20'",
+						fmt.Sprintf("printf '%%s\\n' 'Not activating %s: failed to run mise: exit status 1'", filepath.Join(py, ".tool-versions")),
+						`export API_URL='http://it'\''s'`,
+						"export DEBUG='1'",
+					}, " && ")},
+				},
+			},
+		},
+		{
+			name:    "doesn't reactivate within the same project",
+			d:       &Dot{Env: true},
+			allowed: map[string]string{py: ""},
+			active:  pyActive,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py, "src"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(py, "src"))},
+				},
+			},
+		},
+		{
+			name:   "deactivates when leaving project",
+			d:      &Dot{Env: true},
+			active: pyActive,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{plain},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{strings.Join([]string{
+						bashCd(plain),
+						"deactivate",
+						"nvm deactivate",
+						"unset GOROOT",
+						"export PATH='/usr/bin'",
+						"unset API_URL",
+						"export DEBUG='0'",
+						"unset " + envActiveEnvVar,
+					}, " && ")},
+				},
+			},
+		},
+		{
+			name:    "switches projects",
+			d:       &Dot{Env: true},
+			allowed: map[string]string{node: ""},
+			active:  &ActiveEnv{Root: py, Vars: []*EnvVar{{Name: "DEBUG", Unset: true}}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{node},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{strings.Join([]string{
+						bashCd(node),
+						"unset DEBUG",
+						activeEnvCmd(t, "bash", nodeActive),
+						"nvm use 'lts/iron'",
+					}, " && ")},
+				},
+			},
+		},
+		{
+			name:    "keeps original values when switching projects",
+			d:       &Dot{Env: true},
+			env:     map[string]string{"PATH": "/other/bin:/usr/bin", "DEBUG": "2"},
+			allowed: map[string]string{py: ""},
+			active: &ActiveEnv{Root: node, Vars: []*EnvVar{
+				{Name: "PATH", Prev: "/usr/bin"},
+				{Name: "DEBUG", Unset: true},
+			}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{strings.Join([]string{
+						bashCd(py),
+						"export PATH='/usr/bin'",
+						"unset DEBUG",
+						activeEnvCmd(t, "bash", &ActiveEnv{Root: py, Venv: true, Node: true, Vars: []*EnvVar{
+							{Name: "GOROOT", Unset: true},
+							{Name: "PATH", Prev: "/usr/bin"},
+							{Name: "API_URL", Unset: true},
+							{Name: "DEBUG", Unset: true},
+						}}),
+						fmt.Sprintf(". '%s'", filepath.Join(py, ".venv", "bin", "activate")),
+						"nvm use 'v20'",
+						"export GOROOT='/mise/go'",
+						"export PATH='/mise/go/bin:/usr/bin'",
+						`export API_URL='http://it'\''s'`,
+						"export DEBUG='1'",
+					}, " && ")},
+				},
+			},
+		},
+		{
+			name:    "activates environment with fish",
+			d:       &Dot{Env: true},
+			env:     map[string]string{shellEnvVar: "fish", "PATH": "/usr/bin", "DEBUG": "0"},
+			allowed: map[string]string{py: ""},
+			active:  nodeActive,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{py},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{strings.Join([]string{
+						bashCd(py),
+						"nvm deactivate",
+						activeEnvCmd(t, "fish", pyActive),
+						fmt.Sprintf("source '%s'", filepath.Join(py, ".venv", "bin", "activate.fish")),
+						"nvm use 'v20'",
+						"set -gx GOROOT '/mise/go'",
+						"set -gx PATH '/mise/go/bin:/usr/bin'",
+						`set -gx API_URL 'http://it\'s'`,
+						"set -gx DEBUG '1'",
+					}, "; and ")},
+				},
+			},
+		},
+		{
+			name:    "doesn't activate in print mode",
+			d:       &Dot{Env: true},
+			allowed: map[string]string{py: ""},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"--print", py},
+				WantStdout: py + "\n",
+			},
+		},
+		{
+			name: "prints whether enabled",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"env"},
+				WantStdout: "false\n",
+			},
+		},
+		{
+			name: "enables activation",
+			d:    &Dot{},
+			want: &Dot{Env: true},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"env", "true"},
+			},
+		},
+		{
+			name:        "allows current project",
+			d:           &Dot{},
+			cwd:         filepath.Join(py, "src"),
+			allowed:     map[string]string{node: ""},
+			wantAllowed: sortedKeys(map[string]bool{node: true, py: true}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"env", "allow"},
+			},
+		},
+		{
+			name:        "allows provided project",
+			d:           &Dot{},
+			cwd:         plain,
+			wantAllowed: []string{node},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"env", "allow", node},
+			},
+		},
+		{
+			name: "allow fails without environment files",
+			d:    &Dot{},
+			cwd:  filepath.Join(plain, "one"),
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"env", "allow"},
+				WantErr:    fmt.Errorf("no environment files found in %s or its parents", filepath.Join(plain, "one")),
+				WantStderr: fmt.Sprintf("no environment files found in %s or its parents\n", filepath.Join(plain, "one")),
+			},
+		},
+		{
+			name:        "denies project",
+			d:           &Dot{},
+			cwd:         filepath.Join(py, "src", "pkg"),
+			allowed:     map[string]string{node: "", py: ""},
+			wantAllowed: []string{node},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"env", "deny"},
+			},
+		},
+		{
+			name:        "deny fails for unallowed project",
+			d:           &Dot{},
+			cwd:         py,
+			allowed:     map[string]string{node: ""},
+			wantAllowed: []string{node},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"env", "deny"},
+				WantErr:    fmt.Errorf("%s is not allowed", py),
+				WantStderr: fmt.Sprintf("%s is not allowed\n", py),
+			},
+		},
+		{
+			name:        "lists allowed projects",
+			d:           &Dot{},
+			allowed:     map[string]string{node: "", py: ""},
+			wantAllowed: sortedKeys(map[string]bool{node: true, py: true}),
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"env", "list"},
+				WantStdout: strings.Join(sortedKeys(map[string]bool{node: true, py: true}), "\n") + "\n",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, test.cwd, nil)
+
+			allowCache := cachetest.NewTestCache(t)
+			a := &EnvAllowlist{Roots: map[string]string{}}
+			for root, h := range test.allowed {
+				if h == "" {
+					h = allowedHash(t, root)
+				}
+				a.Roots[root] = h
+			}
+			if err := allowCache.PutStruct(envAllowCacheKey, a); err != nil {
+				t.Fatalf("failed to initialize allowlist: %v", err)
+			}
+			commandtest.StubValue(t, &envCache, func() (*cache.Cache, error) { return allowCache, nil })
+
+			commandtest.StubValue(t, &miseEnv, func(dir string) (map[string]string, error) {
+				if dir != py {
+					t.Errorf("miseEnv(%q) was called; want miseEnv(%q)", dir, py)
+				}
+				if test.miseErr != nil {
+					return nil, test.miseErr
+				}
+				return map[string]string{"PATH": "/mise/go/bin:/usr/bin", "GOROOT": "/mise/go"}, nil
+			})
+
+			env := map[string]string{}
+			for k, v := range test.env {
+				env[k] = v
+			}
+			if test.active != nil {
+				b, err := json.Marshal(test.active)
+				if err != nil {
+					t.Fatalf("failed to marshal active environment: %v", err)
+				}
+				env[envActiveEnvVar] = string(b)
+			}
+
+			shellCache := cachetest.NewTestCache(t)
+			if test.warned != nil {
+				w := &EnvWarnings{Roots: map[string]string{}}
+				for root, h := range test.warned {
+					if h == "" {
+						h = allowedHash(t, root)
+					}
+					w.Roots[root] = h
+				}
+				if err := shellCache.PutStruct(envWarnedCacheKey, w); err != nil {
+					t.Fatalf("failed to initialize environment warnings: %v", err)
+				}
+			}
+			cache.StubShellCache(t, shellCache)
+
+			test.etc.Node = test.d.Node()
+			test.etc.Env = env
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+
+			gotWarned := &EnvWarnings{}
+			if _, err := shellCache.GetStruct(envWarnedCacheKey, gotWarned); err != nil {
+				t.Fatalf("failed to read environment warnings: %v", err)
+			}
+			if diff := cmp.Diff(test.wantWarned, sortedKeys(gotWarned.Roots), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Execute(%v) produced incorrect environment warnings (-want, +got):\n%s", test.etc.Args, diff)
+			}
+			for _, root := range test.wantWarned {
+				if want := allowedHash(t, root); gotWarned.Roots[root] != want {
+					t.Errorf("Execute(%v) warned about %s with hash %q; want %q", test.etc.Args, root, gotWarned.Roots[root], want)
+				}
+			}
+
+			if test.wantAllowed != nil {
+				gotAllowed := &EnvAllowlist{}
+				if _, err := allowCache.GetStruct(envAllowCacheKey, gotAllowed); err != nil {
+					t.Fatalf("failed to read allowlist: %v", err)
+				}
+				if diff := cmp.Diff(test.wantAllowed, sortedKeys(gotAllowed.Roots), cmpopts.EquateEmpty()); diff != "" {
+					t.Errorf("Execute(%v) produced incorrect allowlist (-want, +got):\n%s", test.etc.Args, diff)
+				}
+				for _, root := range test.wantAllowed {
+					if want := allowedHash(t, root); gotAllowed.Roots[root] != want {
+						t.Errorf("Execute(%v) allowed %s with hash %q; want %q", test.etc.Args, root, gotAllowed.Roots[root], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEnvHash(t *testing.T) {
+	m := newTestMemFS(t, "/proj", "/proj/.venv/bin/activate", "/proj/.venv/lib/site.py")
+	root := filepath.FromSlash("/proj")
+	hash := func() string {
+		t.Helper()
+		h, err := envHash(m, root, []string{venvDir})
+		if err != nil {
+			t.Fatalf("envHash() returned error: %v", err)
+		}
+		return h
+	}
+
+	before := hash()
+	if err := m.WriteFile(filepath.FromSlash("/proj/.venv/lib/site.py"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if got := hash(); got != before {
+		t.Errorf("envHash() changed after editing a package (%q, %q)", before, got)
+	}
+	if err := m.WriteFile(filepath.FromSlash("/proj/.venv/bin/activate"), []byte("export PATH=/evil"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if got := hash(); got == before {
+		t.Errorf("envHash() didn't change after editing the activate script")
+	}
+}
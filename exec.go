@@ -0,0 +1,140 @@
+package cd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	execCmdArg    = "CMD"
+	execSeparator = "--"
+)
+
+// execNode returns the node for `d exec TARGET [SUB_PATH ...] -- CMD [ARGS ...]`.
+func (d *Dot) execNode() command.Node {
+	return prependProcessors(d.targetNode(d.execExecutable(), &execUsage{}),
+		commander.Description("Run a command in a directory without changing to it"),
+		d.execCommandProcessor(),
+	)
+}
+
+func (d *Dot) execExecutable() command.Processor {
+	return commander.ExecutableProcessor(func(o command.Output, data *command.Data) ([]string, error) {
+		return []string{shellFromData(data).Exec(data.String(targetDirKey), data.StringList(execCmdArg))}, nil
+	})
+}
+
+// execUsage documents the command that is separated out of the input by
+// execCommandProcessor.
+type execUsage struct{}
+
+func (*execUsage) Execute(*command.Input, command.Output, *command.Data, *command.ExecuteData) error {
+	return nil
+}
+
+func (*execUsage) Complete(*command.Input, *command.Data) (*command.Completion, error) {
+	return nil, nil
+}
+
+func (*execUsage) Usage(_ *command.Input, _ *command.Data, u *command.Usage) error {
+	u.AddSymbol(execSeparator, "Separates the exec target from the command")
+	u.AddArg(execCmdArg, "Command (and its arguments) to run", 1, command.UnboundedList)
+	return nil
+}
+
+// splitExecArgs returns the index of the separator in the remaining input (or
+// -1 if it isn't present).
+func splitExecArgs(i *command.Input) int {
+	for j, v := range i.Remaining() {
+		if v == execSeparator {
+			return j
+		}
+	}
+	return -1
+}
+
+// popExecCommand removes the separator and the command that follows it from
+// the input.
+func popExecCommand(i *command.Input, data *command.Data, idx int) []string {
+	var cmd []string
+	for i.NumRemaining() > idx+1 {
+		v, _ := i.PopAt(idx+1, data)
+		cmd = append(cmd, v)
+	}
+	i.PopAt(idx, data)
+	return cmd
+}
+
+// execCommandProcessor moves the command (everything after the `--`
+// separator) out of the input before the target is resolved so that flags
+// and arguments for the command aren't treated as `d` arguments.
+func (d *Dot) execCommandProcessor() command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		idx := splitExecArgs(i)
+		if idx < 0 {
+			return o.Stderrf("exec requires a command after %q\n", execSeparator)
+		}
+		cmd := popExecCommand(i, data, idx)
+		if len(cmd) == 0 {
+			return o.Stderrf("exec requires a command after %q\n", execSeparator)
+		}
+		data.Set(execCmdArg, cmd)
+		return nil
+	}, func(i *command.Input, data *command.Data) (*command.Completion, error) {
+		// Only complete the command if the separator comes before the argument
+		// being completed.
+		idx := splitExecArgs(i)
+		if idx < 0 || idx == i.NumRemaining()-1 {
+			return nil, nil
+		}
+		cmd := popExecCommand(i, data, idx)
+
+		// Resolve the target directory by executing the target node with the
+		// remaining (pre-separator) input.
+		var dir string
+		n := d.targetNode(commander.SuperSimpleProcessor(func(_ *command.Input, data *command.Data) error {
+			dir = data.String(targetDirKey)
+			return nil
+		}))
+		if _, err := commander.Execute(n, command.NewInput(i.Remaining(), nil), command.NewIgnoreAllOutput(), data.OS); err != nil {
+			// Still stop the graph traversal (otherwise the target would be completed).
+			return &command.Completion{}, nil
+		}
+
+		c, err := execCommandCompletion(d.filesystem(), dir, cmd)
+		if c == nil {
+			c = &command.Completion{}
+		}
+		return c, err
+	})
+}
+
+// execCommandCompletion completes executables in the `PATH` for the first
+// command argument and files in the resolved directory for the rest.
+func execCommandCompletion(fsys FS, dir string, cmd []string) (*command.Completion, error) {
+	last := cmd[len(cmd)-1]
+	if len(cmd) > 1 {
+		return fileCompletion(fsys, dir, last)
+	}
+
+	path, _ := command.OSLookupEnv("PATH")
+	m := map[string]bool{}
+	for _, pd := range filepath.SplitList(path) {
+		entries, err := fsys.ReadDir(pd)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasPrefix(e.Name(), last) {
+				continue
+			}
+			if fi, err := e.Info(); err == nil && fi.Mode().Perm()&0111 != 0 {
+				m[e.Name()] = true
+			}
+		}
+	}
+	return &command.Completion{Suggestions: sortedKeys(m)}, nil
+}
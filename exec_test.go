@@ -0,0 +1,207 @@
+package cd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestExec(t *testing.T) {
+	cwd := filepath.FromSlash("/a/b/c")
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		env  map[string]string
+		etc  *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "runs command in directory",
+			d:    DotCLI(),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"exec", "/x/y", "--", "go", "test", "./..."},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"(cd '/x/y' && 'go' 'test' './...')"},
+				},
+			},
+		},
+		{
+			name: "runs command in sub path",
+			d:    DotCLI(),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"exec", "/x", "y", "z", "--", "make"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"(cd '/x/y/z' && 'make')"},
+				},
+			},
+		},
+		{
+			name: "runs command in up directory",
+			d:    DotCLI(),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"exec", "-u", "2", ".", "--", "ls"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{fmt.Sprintf("(cd '%s' && 'ls')", filepath.FromSlash("/a"))},
+				},
+			},
+		},
+		{
+			name: "runs command in shortcut",
+			d:    shortcutDot(map[string][]string{"api": {"/work/api"}}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"exec", "api", "pkg", "--", "go", "test"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"(cd '/work/api/pkg' && 'go' 'test')"},
+				},
+			},
+		},
+		{
+			name: "runs command in namespaced shortcut",
+			d:    shortcutDot(map[string][]string{"personal:blg": {"/home/blog"}}),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"exec", "blg", "--", "ls"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"(cd '/home/blog' && 'ls')"},
+				},
+			},
+		},
+		{
+			name: "runs command in previous directory",
+			d:    DotCLI(),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"exec", "-", "--", "ls"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"(cd '/prev' && 'ls')"},
+				},
+			},
+		},
+		{
+			name: "does not parse command flags",
+			d:    DotCLI(),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"exec", "/x", "--", "ls", "-u", "--print", "--", "it's"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{`(cd '/x' && 'ls' '-u' '--print' '--' 'it'\''s')`},
+				},
+			},
+		},
+		{
+			name: "uses shell dialect",
+			d:    DotCLI(),
+			env:  map[string]string{shellEnvVar: "powershell"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"exec", "/x", "--", "go", "test"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"Push-Location -LiteralPath '/x'; try { & 'go' 'test' } finally { Pop-Location }"},
+				},
+			},
+		},
+		{
+			name: "fails without separator",
+			d:    DotCLI(),
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"exec", "/x", "ls"},
+				WantErr:    fmt.Errorf(`exec requires a command after "--"`),
+				WantStderr: "exec requires a command after \"--\"\n",
+			},
+		},
+		{
+			name: "fails without command",
+			d:    DotCLI(),
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"exec", "/x", "--"},
+				WantErr:    fmt.Errorf(`exec requires a command after "--"`),
+				WantStderr: "exec requires a command after \"--\"\n",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, cwd, nil)
+			test.d.fsys = &statFS{wd: cwd, stat: dirStat, host: "laptop"}
+			cache.StubShellCache(t, cachetest.NewTestCacheWithData(t, map[string]interface{}{
+				shellCacheKey: &History{PrevDirs: []string{filepath.FromSlash("/prev")}},
+			}))
+
+			test.etc.Node = test.d.Node()
+			test.etc.Env = test.env
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+		})
+	}
+}
+
+func TestExecAutocomplete(t *testing.T) {
+	binDir := t.TempDir()
+	for name, perm := range map[string]os.FileMode{
+		"gofmt":   0755,
+		"golint":  0755,
+		"gopher":  0644,
+		"make":    0755,
+		"notexec": 0644,
+	} {
+		if err := os.WriteFile(filepath.Join(binDir, name), nil, perm); err != nil {
+			t.Fatalf("failed to create executable: %v", err)
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		args string
+		want *command.Autocompletion
+	}{
+		{
+			name: "completes target",
+			args: "cmd exec testing/d",
+			want: &command.Autocompletion{
+				Suggestions:         []string{"testing/dir"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "completes sub path",
+			args: "cmd exec testing d",
+			want: &command.Autocompletion{
+				Suggestions:         []string{"dir"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "completes executables",
+			args: "cmd exec testing -- go",
+			want: &command.Autocompletion{
+				Suggestions: []string{"gofmt", "golint"},
+			},
+		},
+		{
+			name: "completes command arguments in target directory",
+			args: "cmd exec testing dir1 -- cat f",
+			want: &command.Autocompletion{
+				Suggestions:         []string{"folder"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "completes nothing for unresolvable target",
+			args: "cmd exec -u -- cat ",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+			commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+				Node:          DotCLI(WithFS(&statFS{host: "laptop"})).Node(),
+				Args:          test.args,
+				Env:           map[string]string{"PATH": binDir},
+				Want:          test.want,
+				SkipDataCheck: true,
+				OS:            &commandtest.FakeOS{},
+			})
+		})
+	}
+}
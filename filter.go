@@ -0,0 +1,223 @@
+package cd
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	gitignoreFile = ".gitignore"
+)
+
+var (
+	ignoreFlag     = commander.ListFlag[string]("ignore", 'i', "Glob patterns of directory names that are never suggested (replaces the existing patterns; an empty pattern clears them)", 1, command.UnboundedList)
+	gitignoreFlag  = commander.Flag[bool]("gitignore", 'g', "Whether directories ignored by .gitignore files are left out of suggestions")
+	hideHiddenFlag = commander.Flag[bool]("hide-hidden", commander.FlagNoShortName, "Whether hidden directories are only suggested after a leading `.` is typed")
+)
+
+// CompletionFilter configures which directories are suggested when
+// completing paths.
+type CompletionFilter struct {
+	// Ignore are glob patterns (matched against directory names) of
+	// directories that are never suggested.
+	Ignore []string
+	// GitIgnore is whether directories ignored by `.gitignore` files aren't
+	// suggested.
+	GitIgnore bool
+	// HideHidden is whether hidden directories are only suggested once the
+	// path component being completed starts with a `.`.
+	HideHidden bool
+}
+
+// dirCompleter returns a directory completer for the provided directory that
+// applies the configured completion filters. typed is the value being
+// completed.
+func (d *Dot) dirCompleter(dir, typed string, excludePwd bool) *dirCompletion {
+	return &dirCompletion{
+		Directory:  dir,
+		ExcludePwd: excludePwd,
+		IgnoreFunc: d.completionIgnoreFunc(dir, typed),
+	}
+}
+
+// completionIgnoreFunc returns the `dirCompletion.IgnoreFunc` for the
+// configured completion filters (or nil if there aren't any).
+func (d *Dot) completionIgnoreFunc(dir, typed string) func(string, string, *command.Data) bool {
+	cf := d.Completion
+	if cf == nil || (len(cf.Ignore) == 0 && !cf.GitIgnore && !cf.HideHidden) {
+		return nil
+	}
+
+	last := typed[strings.LastIndexAny(typed, `/\`)+1:]
+	showHidden := !cf.HideHidden || strings.HasPrefix(last, ".")
+	base, err := absPath(d.filesystem(), dir)
+	if err != nil {
+		base = dir
+	}
+	gi := map[string]*gitignore{}
+
+	return func(fullPath, name string, data *command.Data) bool {
+		name = strings.TrimRight(name, `/\`)
+		if !showHidden && strings.HasPrefix(name, ".") {
+			return true
+		}
+		for _, p := range cf.Ignore {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+		if cf.GitIgnore {
+			abs := filepath.Clean(fullPath)
+			if !filepath.IsAbs(abs) {
+				abs = filepath.Join(base, abs)
+			}
+			parent := filepath.Dir(abs)
+			g, ok := gi[parent]
+			if !ok {
+				g = loadGitignore(d.filesystem(), parent)
+				gi[parent] = g
+			}
+			return g.ignored(abs)
+		}
+		return false
+	}
+}
+
+// gitignore is the set of `.gitignore` rules that apply to a directory.
+type gitignore struct {
+	rules []*gitignoreRule
+}
+
+type gitignoreRule struct {
+	// dir is the directory that contains the `.gitignore` file.
+	dir      string
+	pattern  string
+	negate   bool
+	anchored bool
+}
+
+// loadGitignore returns the rules from the `.gitignore` files in the directory
+// and its parents (up to the root of the git repository).
+func loadGitignore(fsys FS, dir string) *gitignore {
+	var dirs []string
+	for prev := ""; dir != prev; prev, dir = dir, filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if _, err := fsys.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+	}
+
+	g := &gitignore{}
+	// Rules in deeper directories take precedence, so add them last.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		b, err := fsys.ReadFile(filepath.Join(dirs[i], gitignoreFile))
+		if err != nil {
+			continue
+		}
+		g.rules = append(g.rules, parseGitignore(dirs[i], b)...)
+	}
+	return g
+}
+
+// parseGitignore parses the subset of `.gitignore` syntax that applies to
+// directories: comments, negation, anchored patterns, and `**/` prefixes.
+func parseGitignore(dir string, b []byte) []*gitignoreRule {
+	var r []*gitignoreRule
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := &gitignoreRule{dir: dir}
+		if p, ok := strings.CutPrefix(line, "!"); ok {
+			rule.negate, line = true, p
+		}
+		line = strings.TrimSuffix(line, "/")
+		if p, ok := strings.CutPrefix(line, "**/"); ok {
+			line = p
+		} else if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		r = append(r, rule)
+	}
+	return r
+}
+
+// ignored returns whether the directory is ignored (the last matching rule
+// wins).
+func (g *gitignore) ignored(dir string) bool {
+	var ignored bool
+	for _, rule := range g.rules {
+		if rule.matches(dir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (rule *gitignoreRule) matches(dir string) bool {
+	rel, err := filepath.Rel(rule.dir, dir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !rule.anchored {
+		rel = path.Base(rel)
+	}
+	ok, _ := path.Match(rule.pattern, rel)
+	return ok
+}
+
+func (d *Dot) completionNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Configure which directories are suggested by completion (or print the configuration)"),
+		commander.FlagProcessor(
+			ignoreFlag,
+			gitignoreFlag,
+			hideHiddenFlag,
+		),
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			cf := d.Completion
+			if cf == nil {
+				cf = &CompletionFilter{}
+			}
+			var changed bool
+			if data.Has(ignoreFlag.Name()) {
+				cf.Ignore, changed = nil, true
+				for _, p := range ignoreFlag.Get(data) {
+					if p != "" {
+						cf.Ignore = append(cf.Ignore, p)
+					}
+				}
+			}
+			if data.Has(gitignoreFlag.Name()) {
+				cf.GitIgnore, changed = gitignoreFlag.Get(data), true
+			}
+			if data.Has(hideHiddenFlag.Name()) {
+				cf.HideHidden, changed = hideHiddenFlag.Get(data), true
+			}
+
+			if !changed {
+				o.Stdoutf("ignore: %s\n", strings.Join(cf.Ignore, " "))
+				o.Stdoutf("gitignore: %v\n", cf.GitIgnore)
+				o.Stdoutf("hide-hidden: %v\n", cf.HideHidden)
+				return nil
+			}
+			d.Completion = cf
+			d.MarkChanged()
+			return nil
+		}},
+	)
+}
@@ -0,0 +1,236 @@
+package cd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestCompletionFilter(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		want *Dot
+		etc  *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "prints default configuration",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"completion"},
+				WantStdout: "ignore: \n" +
+					"gitignore: false\n" +
+					"hide-hidden: false\n",
+			},
+		},
+		{
+			name: "prints configuration",
+			d:    &Dot{Completion: &CompletionFilter{Ignore: []string{"node_modules", "bazel-*"}, GitIgnore: true}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"completion"},
+				WantStdout: "ignore: node_modules bazel-*\n" +
+					"gitignore: true\n" +
+					"hide-hidden: false\n",
+			},
+		},
+		{
+			name: "sets configuration",
+			d:    &Dot{},
+			want: &Dot{Completion: &CompletionFilter{Ignore: []string{"vendor"}, GitIgnore: true, HideHidden: true}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"completion", "-i", "vendor", "-g", "true", "--hide-hidden", "true"},
+			},
+		},
+		{
+			name: "replaces ignore patterns",
+			d:    &Dot{Completion: &CompletionFilter{Ignore: []string{"vendor"}, GitIgnore: true}},
+			want: &Dot{Completion: &CompletionFilter{Ignore: []string{"node_modules", "bazel-*"}, GitIgnore: true}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"completion", "--ignore", "node_modules", "bazel-*"},
+			},
+		},
+		{
+			name: "clears ignore patterns",
+			d:    &Dot{Completion: &CompletionFilter{Ignore: []string{"vendor"}, GitIgnore: true}},
+			want: &Dot{Completion: &CompletionFilter{GitIgnore: true}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"completion", "-i", ""},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			test.etc.Node = test.d.Node()
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+		})
+	}
+}
+
+func TestCompletionFilterAutocomplete(t *testing.T) {
+	repo := listingDir(t, map[string]string{
+		".git/":          "",
+		".cache/":        "",
+		"bazel-out/":     "",
+		"build/":         "",
+		"cmd/":           "",
+		"keep-out/":      "",
+		"node_modules/":  "",
+		"vendor/":        "",
+		"src/.hidden/":   "",
+		"src/build/":     "",
+		"src/gen/":       "",
+		"src/lib/":       "",
+		".gitignore":     "# Build outputs\n*-out/\n!keep-out\n/build/\n",
+		"src/.gitignore": "gen/\n",
+	})
+
+	for _, test := range []struct {
+		name string
+		cf   *CompletionFilter
+		args string
+		want *command.Autocompletion
+	}{
+		{
+			name: "suggests all directories by default",
+			args: "cmd ",
+			want: &command.Autocompletion{
+				Suggestions: []string{
+					".cache/",
+					".git/",
+					"bazel-out/",
+					"build/",
+					"cmd/",
+					"keep-out/",
+					"node_modules/",
+					"src/",
+					"vendor/",
+					" ",
+				},
+			},
+		},
+		{
+			name: "ignores globs",
+			cf:   &CompletionFilter{Ignore: []string{"node_modules", "vend*", ".git"}},
+			args: "cmd ",
+			want: &command.Autocompletion{
+				Suggestions: []string{
+					".cache/",
+					"bazel-out/",
+					"build/",
+					"cmd/",
+					"keep-out/",
+					"src/",
+					" ",
+				},
+			},
+		},
+		{
+			name: "hides hidden directories",
+			cf:   &CompletionFilter{HideHidden: true},
+			args: "cmd ",
+			want: &command.Autocompletion{
+				Suggestions: []string{
+					"bazel-out/",
+					"build/",
+					"cmd/",
+					"keep-out/",
+					"node_modules/",
+					"src/",
+					"vendor/",
+					" ",
+				},
+			},
+		},
+		{
+			name: "suggests hidden directories after a leading dot",
+			cf:   &CompletionFilter{HideHidden: true},
+			args: "cmd .",
+			want: &command.Autocompletion{
+				Suggestions: []string{
+					".cache/",
+					".git/",
+					" ",
+				},
+			},
+		},
+		{
+			name: "suggests nested hidden directories after a leading dot",
+			cf:   &CompletionFilter{HideHidden: true},
+			args: "cmd src/.",
+			want: &command.Autocompletion{
+				Suggestions:         []string{"src/.hidden/"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "honors gitignore files",
+			cf:   &CompletionFilter{GitIgnore: true},
+			args: "cmd ",
+			want: &command.Autocompletion{
+				Suggestions: []string{
+					".cache/",
+					".git/",
+					"cmd/",
+					"keep-out/",
+					"node_modules/",
+					"src/",
+					"vendor/",
+					" ",
+				},
+			},
+		},
+		{
+			name: "honors nested gitignore files",
+			cf:   &CompletionFilter{GitIgnore: true, HideHidden: true},
+			args: "cmd src/",
+			want: &command.Autocompletion{
+				// Only the top-level build directory is ignored.
+				Suggestions: []string{
+					"build/",
+					"lib/",
+					" ",
+				},
+			},
+		},
+		{
+			name: "filters sub paths",
+			cf:   &CompletionFilter{GitIgnore: true, HideHidden: true, Ignore: []string{"li*"}},
+			args: "cmd src ",
+			want: &command.Autocompletion{
+				Suggestions:         []string{"build/"},
+				SpacelessCompletion: true,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// FileCompleter resolves relative directories from the process's
+			// working directory.
+			prev, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("failed to get working directory: %v", err)
+			}
+			if err := os.Chdir(repo); err != nil {
+				t.Fatalf("failed to change directory: %v", err)
+			}
+			t.Cleanup(func() { os.Chdir(prev) })
+			commandtest.StubGetwd(t, repo, nil)
+			commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+				Node:          (&Dot{Completion: test.cf}).Node(),
+				Args:          test.args,
+				Want:          test.want,
+				SkipDataCheck: true,
+				OS:            &commandtest.FakeOS{},
+			})
+		})
+	}
+}
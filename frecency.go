@@ -0,0 +1,196 @@
+package cd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/command"
+)
+
+const (
+	visitsCacheKey = "leep-cd-visits"
+	// maxVisits is the total visit count at which all counts are aged (so
+	// directories that are no longer visited eventually drop out).
+	maxVisits = 1000
+	// visitAging is the factor that counts are multiplied by when aged.
+	visitAging = 0.9
+)
+
+var (
+	timeNow = time.Now
+	// visitsCache returns the persistent cache that holds the visits (so they
+	// are shared by every shell).
+	visitsCache = func() (*cache.Cache, error) { return envCache() }
+)
+
+// Visits records how often and how recently directories were visited.
+type Visits struct {
+	Dirs map[string]*Visit
+}
+
+// Visit is the visit data for a single directory.
+type Visit struct {
+	Count float64
+	// Last is the Unix time of the most recent visit.
+	Last int64
+}
+
+// getVisits returns the visits stored in the persistent cache.
+func getVisits() (*cache.Cache, *Visits, error) {
+	c, err := visitsCache()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get visits cache: %v", err)
+	}
+
+	v := &Visits{}
+	if _, err := c.GetStruct(visitsCacheKey, v); err != nil {
+		return nil, nil, fmt.Errorf("failed to get visits: %v", err)
+	}
+	return c, v, nil
+}
+
+// add records a visit to the directory.
+func (v *Visits) add(dir string, now time.Time) {
+	if v.Dirs == nil {
+		v.Dirs = map[string]*Visit{}
+	}
+	vt, ok := v.Dirs[dir]
+	if !ok {
+		vt = &Visit{}
+		v.Dirs[dir] = vt
+	}
+	vt.Count++
+	vt.Last = now.Unix()
+
+	var total float64
+	for _, vt := range v.Dirs {
+		total += vt.Count
+	}
+	if total <= maxVisits {
+		return
+	}
+	for d, vt := range v.Dirs {
+		if vt.Count *= visitAging; vt.Count < 1 {
+			delete(v.Dirs, d)
+		}
+	}
+}
+
+// score returns the frecency of the directory: its visit count weighted by
+// how recently it was last visited.
+func (v *Visits) score(dir string, now time.Time) float64 {
+	vt, ok := v.Dirs[dir]
+	if !ok {
+		return 0
+	}
+	switch age := now.Sub(time.Unix(vt.Last, 0)); {
+	case age < time.Hour:
+		return vt.Count * 4
+	case age < 24*time.Hour:
+		return vt.Count * 2
+	case age < 7*24*time.Hour:
+		return vt.Count / 2
+	default:
+		return vt.Count / 4
+	}
+}
+
+// recordVisit records a visit to the directory in the persistent cache.
+func recordVisit(dir string) error {
+	c, v, err := getVisits()
+	if err != nil {
+		return err
+	}
+	v.add(dir, timeNow())
+	if err := c.PutStruct(visitsCacheKey, v); err != nil {
+		return fmt.Errorf("failed to save visits: %v", err)
+	}
+	return nil
+}
+
+// completionVisits returns the visits that suggestions are ranked (and
+// described) by. When describing, they are loaded once for all of the
+// suggestions.
+func completionVisits(data *command.Data) *Visits {
+	if dos, ok := data.OS.(*describingOS); ok {
+		return dos.getVisits()
+	}
+	if _, v, err := getVisits(); err == nil {
+		return v
+	}
+	return &Visits{}
+}
+
+// rankSuggestions orders the suggestions by the frecency of the directories
+// they refer to (pathFunc returns a suggestion's absolute path). Suggestions
+// with the same frecency keep their order. The suggestions are also described
+// when completing for `d describe`.
+func rankSuggestions(data *command.Data, c *command.Completion, pathFunc func(string) string) *command.Completion {
+	describeSuggestions(data, c, pathFunc)
+	// A single suggestion is completed directly, so there is nothing to rank.
+	if c == nil || len(c.Suggestions) <= 1 {
+		return c
+	}
+	v := completionVisits(data)
+	if len(v.Dirs) == 0 {
+		return c
+	}
+
+	now := timeNow()
+	scores := map[string]float64{}
+	for _, s := range c.Suggestions {
+		if s != " " {
+			scores[s] = v.score(pathFunc(s), now)
+		}
+	}
+	sort.SliceStable(c.Suggestions, func(i, j int) bool {
+		// Keep the DontComplete suggestion last.
+		if c.Suggestions[j] == " " {
+			return c.Suggestions[i] != " "
+		}
+		return scores[c.Suggestions[i]] > scores[c.Suggestions[j]]
+	})
+	return c
+}
+
+// keepOrder records the order of the suggestions for `d describe` (zsh and
+// fish keep the order that it prints them in). The completion library sorts
+// the suggestions that bash lists, and they are left unchanged so that shells
+// that insert listed suggestions (e.g. when cycling through a menu) insert the
+// actual values.
+func keepOrder(data *command.Data, c *command.Completion) *command.Completion {
+	dos, ok := data.OS.(*describingOS)
+	if !ok || c == nil {
+		return c
+	}
+	dos.order = map[string]int{}
+	for i, s := range c.Suggestions {
+		dos.order[s] = i
+	}
+	return c
+}
+
+// suggestionDir returns the absolute directory that contains the suggestions
+// for the typed value completed relative to dir.
+func suggestionDir(fsys FS, dir, typed string) string {
+	laDir, _ := filepath.Split(filepath.FromSlash(typed))
+	if !filepath.IsAbs(laDir) {
+		laDir = filepath.Join(dir, laDir)
+	}
+	if abs, err := absPath(fsys, laDir); err == nil {
+		return abs
+	}
+	return laDir
+}
+
+// rankDirs orders the directory suggestions for the typed value (completed
+// relative to dir) by frecency.
+func rankDirs(data *command.Data, c *command.Completion, dir, typed string) *command.Completion {
+	sd := suggestionDir(filesystem(data), dir, typed)
+	return rankSuggestions(data, c, func(s string) string {
+		return filepath.Join(sd, s)
+	})
+}
@@ -0,0 +1,248 @@
+package cd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestVisitScore(t *testing.T) {
+	now := time.Unix(1_000_000_000, 0)
+	v := &Visits{Dirs: map[string]*Visit{
+		"/hour":  {Count: 3, Last: now.Add(-time.Minute).Unix()},
+		"/day":   {Count: 3, Last: now.Add(-2 * time.Hour).Unix()},
+		"/week":  {Count: 3, Last: now.Add(-48 * time.Hour).Unix()},
+		"/older": {Count: 3, Last: now.Add(-30 * 24 * time.Hour).Unix()},
+	}}
+	for _, test := range []struct {
+		dir  string
+		want float64
+	}{
+		{"/hour", 12},
+		{"/day", 6},
+		{"/week", 1.5},
+		{"/older", 0.75},
+		{"/unvisited", 0},
+	} {
+		if got := v.score(test.dir, now); got != test.want {
+			t.Errorf("score(%q) returned %v; want %v", test.dir, got, test.want)
+		}
+	}
+}
+
+func TestVisitAging(t *testing.T) {
+	now := time.Unix(1_000_000_000, 0)
+	v := &Visits{Dirs: map[string]*Visit{
+		"/frequent": {Count: maxVisits - 1},
+		"/rare":     {Count: 1},
+	}}
+	v.add("/new", now)
+
+	// Directories with counts below 1 are dropped when aged.
+	want := &Visits{Dirs: map[string]*Visit{
+		"/frequent": {Count: (maxVisits - 1) * visitAging},
+	}}
+	if diff := cmp.Diff(want, v, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+		t.Errorf("add() produced incorrect visits (-want, +got):\n%s", diff)
+	}
+}
+
+func TestRecordVisits(t *testing.T) {
+	now := time.Unix(1_000_000_000, 0)
+	commandtest.StubValue(t, &timeNow, func() time.Time { return now })
+	c := cachetest.NewTestCache(t)
+	commandtest.StubValue(t, &visitsCache, func() (*cache.Cache, error) { return c, nil })
+	cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+	d := &Dot{}
+	a, b := filepath.FromSlash("/a"), filepath.FromSlash("/a/b")
+	for _, test := range []struct {
+		wd   string
+		args []string
+		want string
+	}{
+		{a, []string{b}, b},
+		{b, []string{"-u", "1"}, ".."},
+		{a, []string{b}, b},
+	} {
+		commandtest.StubGetwd(t, test.wd, nil)
+		commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+			Node: d.Node(),
+			Args: test.args,
+			OS:   &commandtest.FakeOS{},
+			WantExecuteData: &command.ExecuteData{
+				Executable: []string{bashCd(test.want)},
+			},
+			SkipDataCheck: true,
+		})
+	}
+
+	v := &Visits{}
+	if _, err := c.GetStruct(visitsCacheKey, v); err != nil {
+		t.Fatalf("failed to read visits: %v", err)
+	}
+	// The destinations are recorded.
+	want := &Visits{Dirs: map[string]*Visit{
+		a: {Count: 1, Last: now.Unix()},
+		b: {Count: 2, Last: now.Unix()},
+	}}
+	if diff := cmp.Diff(want, v); diff != "" {
+		t.Errorf("Execute() recorded incorrect visits (-want, +got):\n%s", diff)
+	}
+}
+
+func TestRecordVisitFails(t *testing.T) {
+	commandtest.StubValue(t, &visitsCache, func() (*cache.Cache, error) { return nil, fmt.Errorf("no cache dir") })
+	cache.StubShellCache(t, cachetest.NewTestCache(t))
+	commandtest.StubGetwd(t, filepath.FromSlash("/a"), nil)
+
+	// The cd still happens.
+	dir := filepath.FromSlash("/tmp")
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node:       (&Dot{}).Node(),
+		Args:       []string{dir},
+		OS:         &commandtest.FakeOS{},
+		WantStderr: "Not recording visit: failed to get visits cache: no cache dir\n",
+		WantExecuteData: &command.ExecuteData{
+			Executable: []string{bashCd(dir)},
+		},
+		SkipDataCheck: true,
+	})
+}
+
+func TestFrecencyAutocomplete(t *testing.T) {
+	now := time.Unix(1_000_000_000, 0)
+	commandtest.StubValue(t, &timeNow, func() time.Time { return now })
+	vc := cachetest.NewTestCache(t)
+	commandtest.StubValue(t, &visitsCache, func() (*cache.Cache, error) { return vc, nil })
+	cache.StubShellCache(t, cachetest.NewTestCache(t))
+	root := listingDir(t, map[string]string{
+		"api/":  "",
+		"cmd/":  "",
+		"docs/": "",
+		"web/":  "",
+	})
+	commandtest.StubGetwd(t, root, nil)
+	d := &Dot{fsys: &statFS{wd: root}}
+
+	for _, args := range [][]string{{"web"}, {"cmd"}, {"web"}} {
+		commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+			Node: d.Node(),
+			Args: args,
+			OS:   &commandtest.FakeOS{},
+			WantExecuteData: &command.ExecuteData{
+				Executable: []string{bashCd(filepath.Join(root, args[0]))},
+			},
+			SkipDataCheck: true,
+		})
+	}
+
+	commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+		Node: d.Node(),
+		Args: "cmd ",
+		OS:   &commandtest.FakeOS{},
+		Want: &command.Autocompletion{
+			Suggestions: []string{"api/", "cmd/", "docs/", "web/", " "},
+		},
+		SkipDataCheck: true,
+	})
+
+	// The ranking is only kept by d describe (which completes relative
+	// directories from the process's working directory).
+	prev, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatalf("failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(prev) })
+	commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+		Node: d.Node(),
+		Args: []string{"describe", ""},
+		OS:   &commandtest.FakeOS{},
+		WantStdout: strings.Join([]string{
+			"web/\tvisited just now",
+			"cmd/\tvisited just now",
+			"api/",
+			"docs/",
+		}, "\n") + "\n",
+		SkipDataCheck: true,
+	})
+}
+
+func TestRankSuggestions(t *testing.T) {
+	now := time.Unix(1_000_000_000, 0)
+	root := filepath.FromSlash("/src")
+	visits := &Visits{Dirs: map[string]*Visit{
+		filepath.Join(root, "web"):      {Count: 5, Last: now.Unix()},
+		filepath.Join(root, "cmd"):      {Count: 1, Last: now.Unix()},
+		filepath.Join(root, "api", "x"): {Count: 10, Last: now.Unix()},
+	}}
+
+	for _, test := range []struct {
+		name  string
+		typed string
+		c     *command.Completion
+		want  *command.Completion
+	}{
+		{
+			name: "ranks by frecency",
+			c: &command.Completion{
+				Suggestions:  []string{"api/", "cmd/", "docs/", "web/"},
+				DontComplete: true,
+			},
+			want: &command.Completion{
+				Suggestions:  []string{"web/", "cmd/", "api/", "docs/"},
+				DontComplete: true,
+			},
+		},
+		{
+			name:  "ranks nested suggestions",
+			typed: "api/",
+			c: &command.Completion{
+				Suggestions: []string{"a/", "b/", "x/", " "},
+			},
+			want: &command.Completion{
+				Suggestions: []string{"x/", "a/", "b/", " "},
+			},
+		},
+		{
+			name: "ignores single suggestion",
+			c: &command.Completion{
+				Suggestions:         []string{"/src/api/"},
+				SpacelessCompletion: true,
+			},
+			want: &command.Completion{
+				Suggestions:         []string{"/src/api/"},
+				SpacelessCompletion: true,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubValue(t, &timeNow, func() time.Time { return now })
+			c := cachetest.NewTestCache(t)
+			if err := c.PutStruct(visitsCacheKey, visits); err != nil {
+				t.Fatalf("failed to store visits: %v", err)
+			}
+			commandtest.StubValue(t, &visitsCache, func() (*cache.Cache, error) { return c, nil })
+			data := &command.Data{}
+
+			got := rankDirs(data, test.c, root, test.typed)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("rankDirs() returned incorrect completion (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
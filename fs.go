@@ -0,0 +1,273 @@
+package cd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	fsDataKey = "LEEP_CD_FS"
+	// maxSymlinks is the number of symbolic links followed when resolving a
+	// path before giving up (like the OS limit).
+	maxSymlinks = 255
+)
+
+// FS is the filesystem that directories are resolved and completed in.
+type FS interface {
+	// Stat returns the file info of the named file (following symbolic links).
+	Stat(name string) (fs.FileInfo, error)
+	// Lstat returns the file info of the named file (without following a
+	// final symbolic link).
+	Lstat(name string) (fs.FileInfo, error)
+	// ReadDir returns the entries of the named directory, sorted by name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+	// Readlink returns the target of the named symbolic link.
+	Readlink(name string) (string, error)
+	// ReadFile returns the contents of the named file.
+	ReadFile(name string) ([]byte, error)
+	// Getwd returns the current working directory.
+	Getwd() (string, error)
+}
+
+// osFS is the operating system's filesystem.
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Readlink(name string) (string, error)       { return os.Readlink(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFS) Getwd() (string, error)                     { return os.Getwd() }
+
+func (osFS) EvalSymlinks(name string) (string, error) { return filepath.EvalSymlinks(name) }
+func (osFS) Hostname() (string, error)                { return os.Hostname() }
+func (osFS) UserHomeDir() (string, error)             { return os.UserHomeDir() }
+
+// usesOSWd marks the operating system's filesystem (and filesystems that
+// embed it) as using the process's working directory.
+func (osFS) usesOSWd() {}
+
+// OpenDir opens the directory so its entries can be read incrementally.
+func (osFS) OpenDir(name string) (dirReader, error) { return os.Open(name) }
+
+// symlinkEvaluator is implemented by filesystems that resolve symbolic links
+// themselves.
+type symlinkEvaluator interface {
+	EvalSymlinks(name string) (string, error)
+}
+
+// dirOpener is implemented by filesystems that read directories
+// incrementally.
+type dirOpener interface {
+	OpenDir(name string) (dirReader, error)
+}
+
+// hostnamer is implemented by filesystems that know the name of their host.
+type hostnamer interface {
+	Hostname() (string, error)
+}
+
+// homeDirer is implemented by filesystems that know the user's home
+// directory.
+type homeDirer interface {
+	UserHomeDir() (string, error)
+}
+
+// osWd is implemented by filesystems whose working directory is the
+// process's, which is retrieved with `commander.Getwd` (like the rest of the
+// command framework).
+type osWd interface {
+	usesOSWd()
+}
+
+// fsHostname returns the name of the filesystem's host (or an error if the
+// filesystem doesn't know it).
+func fsHostname(fsys FS) (string, error) {
+	if h, ok := fsys.(hostnamer); ok {
+		return h.Hostname()
+	}
+	return "", fmt.Errorf("hostname is unknown")
+}
+
+// fsUserHomeDir returns the user's home directory in the filesystem (or an
+// error if the filesystem doesn't know it).
+func fsUserHomeDir(fsys FS) (string, error) {
+	if h, ok := fsys.(homeDirer); ok {
+		return h.UserHomeDir()
+	}
+	return "", fmt.Errorf("home directory is unknown")
+}
+
+// Option configures a Dot.
+type Option func(*Dot)
+
+// WithFS sets the filesystem that directories are resolved and completed in
+// (the operating system's filesystem by default).
+func WithFS(fsys FS) Option {
+	return func(d *Dot) { d.fsys = fsys }
+}
+
+// filesystem returns the configured filesystem.
+func (d *Dot) filesystem() FS {
+	if d.fsys == nil {
+		return osFS{}
+	}
+	return d.fsys
+}
+
+// fsProcessor sets the configured filesystem in the data (so it is available
+// to the argument completers and transformers).
+func (d *Dot) fsProcessor() command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		data.Set(fsDataKey, d.filesystem())
+		return nil
+	}, func(i *command.Input, data *command.Data) (*command.Completion, error) {
+		data.Set(fsDataKey, d.filesystem())
+		return nil, nil
+	})
+}
+
+// filesystem returns the filesystem set by fsProcessor (or the operating
+// system's filesystem if none was set).
+func filesystem(data *command.Data) FS {
+	if data != nil && data.Has(fsDataKey) {
+		return command.GetData[FS](data, fsDataKey)
+	}
+	return osFS{}
+}
+
+// getwd returns the processor that sets the working directory. The operating
+// system's working directory is retrieved with `commander.Getwd`.
+func (d *Dot) getwd() command.Processor {
+	if _, ok := d.filesystem().(osWd); ok {
+		return commander.Getwd
+	}
+	return commander.SuperSimpleProcessor(func(i *command.Input, data *command.Data) error {
+		wd, err := d.fsys.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %v", err)
+		}
+		data.Set(commander.GetwdKey, wd)
+		return nil
+	})
+}
+
+// absPath returns the absolute path for p (relative to the filesystem's
+// working directory).
+func absPath(fsys FS, p string) (string, error) {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p), nil
+	}
+	wd, err := fsys.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(wd, p), nil
+}
+
+// absTransformer transforms a path argument into an absolute path in the
+// configured filesystem (like `commander.FileTransformer`).
+func absTransformer() *commander.Transformer[string] {
+	return &commander.Transformer[string]{F: func(s string, data *command.Data) (string, error) {
+		return absPath(filesystem(data), s)
+	}}
+}
+
+// evalSymlinks returns the path with its symbolic links resolved (like
+// filepath.EvalSymlinks).
+func evalSymlinks(fsys FS, p string) (string, error) {
+	if se, ok := fsys.(symlinkEvaluator); ok {
+		return se.EvalSymlinks(p)
+	}
+	if !filepath.IsAbs(p) {
+		wd, err := fsys.Getwd()
+		if err != nil {
+			return "", err
+		}
+		// Don't use filepath.Join because `..` is applied after resolving the
+		// symbolic links before it.
+		p = wd + string(filepath.Separator) + p
+	}
+	vol := filepath.VolumeName(p)
+	parts := splitPath(p[len(vol):])
+	cur := vol + string(filepath.Separator)
+	for i, links := 0, 0; i < len(parts); i++ {
+		next := filepath.Join(cur, parts[i])
+		fi, err := fsys.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", &fs.PathError{Op: "lstat", Path: p, Err: errTooManySym}
+		}
+		target, err := fsys.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = cur + string(filepath.Separator) + target
+		}
+		// Resolve the rest of the path from the start of the link's target.
+		vol = filepath.VolumeName(target)
+		parts = append(splitPath(target[len(vol):]), parts[i+1:]...)
+		cur, i = vol+string(filepath.Separator), -1
+	}
+	return cur, nil
+}
+
+// splitPath returns the non-empty components of the path.
+func splitPath(p string) []string {
+	return strings.FieldsFunc(p, func(r rune) bool { return r == filepath.Separator || r == '/' })
+}
+
+// dirReader reads the entries of an open directory (like *os.File).
+type dirReader interface {
+	ReadDir(n int) ([]fs.DirEntry, error)
+	Stat() (fs.FileInfo, error)
+	Close() error
+}
+
+// openDir opens the directory for reading in batches.
+func openDir(fsys FS, dir string) (dirReader, error) {
+	if do, ok := fsys.(dirOpener); ok {
+		return do.OpenDir(dir)
+	}
+	es, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &entriesReader{fsys: fsys, dir: dir, entries: es}, nil
+}
+
+// entriesReader is a dirReader for entries that were read all at once.
+type entriesReader struct {
+	fsys    FS
+	dir     string
+	entries []fs.DirEntry
+}
+
+func (er *entriesReader) ReadDir(n int) ([]fs.DirEntry, error) {
+	if len(er.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(er.entries) {
+		n = len(er.entries)
+	}
+	r := er.entries[:n]
+	er.entries = er.entries[n:]
+	return r, nil
+}
+
+func (er *entriesReader) Stat() (fs.FileInfo, error) { return er.fsys.Stat(er.dir) }
+func (er *entriesReader) Close() error               { return nil }
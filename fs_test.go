@@ -0,0 +1,241 @@
+package cd
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// statFS is the operating system's filesystem with a stubbed working
+// directory, Stat, hostname, and home directory. Unset stubs use the
+// operating system's.
+type statFS struct {
+	osFS
+	wd   string
+	stat func(name string) (fs.FileInfo, error)
+	host string
+	home string
+}
+
+func (sf *statFS) Stat(name string) (fs.FileInfo, error) {
+	if sf.stat == nil {
+		return sf.osFS.Stat(name)
+	}
+	return sf.stat(name)
+}
+
+func (sf *statFS) Getwd() (string, error) {
+	if sf.wd == "" {
+		return sf.osFS.Getwd()
+	}
+	return sf.wd, nil
+}
+
+func (sf *statFS) Hostname() (string, error)    { return sf.host, nil }
+func (sf *statFS) UserHomeDir() (string, error) { return sf.home, nil }
+
+// dirStat reports that every path is a directory.
+func dirStat(string) (fs.FileInfo, error) { return dirType, nil }
+
+func TestMemFSExecute(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		d          *Dot
+		wd         string
+		args       []string
+		want       string
+		wantStderr string
+		wantErr    error
+	}{
+		{
+			name: "changes to relative directory",
+			args: []string{"src"},
+			want: "/repo/src",
+		},
+		{
+			name: "changes to directory of file",
+			args: []string{"src/main.go"},
+			want: "/repo/src",
+		},
+		{
+			name: "keeps symbolic links",
+			args: []string{"link"},
+			want: "/repo/link",
+		},
+		{
+			name: "resolves symbolic links with flag",
+			args: []string{"link", "-P"},
+			want: "/data/inner",
+		},
+		{
+			name: "resolves relative symbolic links",
+			d:    &Dot{PathMode: pathModePhysical},
+			args: []string{"rel"},
+			want: "/data/inner",
+		},
+		{
+			name: "applies .. after resolving symbolic links in physical mode",
+			wd:   "/repo/link",
+			args: []string{"..", "-P"},
+			want: "/data",
+		},
+		{
+			name: "up flag applies to symbolic link working directory",
+			wd:   "/repo/link/deep",
+			args: []string{"-u", "2", "-P"},
+			want: "/data",
+		},
+		{
+			name: "parent keeps symbolic links",
+			wd:   "/repo/link/deep",
+			args: []string{"parent", "repo"},
+			want: "/repo",
+		},
+		{
+			name: "parent resolves symbolic links with flag",
+			wd:   "/repo/link/deep",
+			args: []string{"parent", "data", "-P"},
+			want: "/data",
+		},
+		{
+			name:       "parent fails for symbolic link's parent in physical mode",
+			d:          &Dot{PathMode: pathModePhysical},
+			wd:         "/repo/link/deep",
+			args:       []string{"parent", "repo"},
+			wantStderr: "PARENT_DIR must be a parent directory\n",
+			wantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
+		},
+		{
+			name: "reads project shortcuts from filesystem",
+			wd:   "/repo/src",
+			args: []string{"deep"},
+			want: "/repo/link/deep",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestMemFS(t, "/repo",
+				"/repo/src/main.go",
+				"/repo/link -> /data/inner",
+				"/repo/rel -> ../data/inner",
+				"/data/inner/deep/",
+			)
+			if err := m.WriteFile(filepath.FromSlash("/repo/"+projectShortcutsFile), []byte(`{"deep": ["link/deep"]}`), 0644); err != nil {
+				t.Fatalf("failed to create project shortcuts: %v", err)
+			}
+			if test.wd != "" {
+				if err := m.Chdir(filepath.FromSlash(test.wd)); err != nil {
+					t.Fatalf("failed to change directory: %v", err)
+				}
+			}
+			if test.d == nil {
+				test.d = &Dot{}
+			}
+			test.d.fsys = m
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			etc := &commandtest.ExecuteTestCase{
+				Node:          test.d.Node(),
+				Args:          test.args,
+				OS:            &commandtest.FakeOS{},
+				WantStderr:    test.wantStderr,
+				WantErr:       test.wantErr,
+				SkipDataCheck: true,
+			}
+			if test.want != "" {
+				etc.WantExecuteData = &command.ExecuteData{Executable: []string{bashCd(filepath.FromSlash(test.want))}}
+			}
+			commandertest.ExecuteTest(t, etc)
+		})
+	}
+}
+
+func TestMemFSAutocomplete(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		d       *Dot
+		wd      string
+		args    string
+		want    *command.Autocompletion
+		wantErr error
+	}{
+		{
+			name: "completes directories and symbolic links",
+			args: "cmd ",
+			want: &command.Autocompletion{
+				Suggestions: []string{"link/", "locked/", "src/", "wide/", " "},
+			},
+		},
+		{
+			name: "completes through symbolic links",
+			args: "cmd link/",
+			want: &command.Autocompletion{
+				Suggestions:         []string{"link/deep/"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "completes large directory",
+			args: "cmd wide/d499",
+			want: &command.Autocompletion{
+				Suggestions: []string{"d499/", "d4990/", "d4991/", "d4992/", "d4993/", "d4994/", "d4995/", "d4996/", "d4997/", "d4998/", "d4999/", " "},
+			},
+		},
+		{
+			name:    "fails for directory that can't be read",
+			args:    "cmd locked/",
+			wantErr: fmt.Errorf(`failed to read dir: open %s: permission denied`, filepath.FromSlash("/repo/locked")),
+		},
+		{
+			name: "completes parents of symbolic link working directory",
+			d:    &Dot{PathMode: pathModePhysical},
+			wd:   "/repo/link/deep",
+			args: "cmd parent ",
+			want: &command.Autocompletion{
+				Suggestions: []string{"data", "inner"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			wide := []string{"/repo/link -> /data/inner", "/data/inner/deep/", "/repo/src/", "/repo/locked/sub/"}
+			for i := 0; i < 5000; i++ {
+				wide = append(wide, fmt.Sprintf("/repo/wide/d%d/", i))
+			}
+			m := newTestMemFS(t, "/repo", wide...)
+			if err := m.Chmod(filepath.FromSlash("/repo/locked"), 0300); err != nil {
+				t.Fatalf("failed to change mode: %v", err)
+			}
+			if test.wd != "" {
+				if err := m.Chdir(filepath.FromSlash(test.wd)); err != nil {
+					t.Fatalf("failed to change directory: %v", err)
+				}
+			}
+			if test.d == nil {
+				test.d = &Dot{}
+			}
+			test.d.fsys = m
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+			stubListingCache(t, cachetest.NewTestCache(t))
+
+			if test.want != nil {
+				for i, s := range test.want.Suggestions {
+					test.want.Suggestions[i] = filepath.FromSlash(s)
+				}
+			}
+			commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+				Node:          test.d.Node(),
+				Args:          test.args,
+				OS:            &commandtest.FakeOS{},
+				Want:          test.want,
+				WantErr:       test.wantErr,
+				SkipDataCheck: true,
+			})
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package cd
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	indexCacheKey = "leep-cd-index"
+	// indexDirsCacheKey is the cache key of the indexed directories (one per
+	// line), which is all that jump queries need.
+	indexDirsCacheKey = "leep-cd-index-dirs"
+	// maxJumpSuggestions is the number of best matches suggested when
+	// completing a jump query.
+	maxJumpSuggestions = 10
+)
+
+var (
+	// indexCache returns the persistent cache that holds the directory index.
+	indexCache = func() (*cache.Cache, error) { return envCache() }
+
+	indexDirsArg = commander.ListArg[string]("DIRS", "Directories to index (defaults to the home directory)", 0, command.UnboundedList,
+		commander.TransformerList(absTransformer()),
+		dirListCompleter(),
+	)
+	jumpQueryArg = "QUERY"
+)
+
+// Index is an index of all of the directories under a set of roots.
+type Index struct {
+	Roots []string
+	// Updated is the Unix time of the last build or update.
+	Updated int64
+	// Dirs is a map from indexed directory to its entry.
+	Dirs map[string]*IndexEntry
+}
+
+// IndexEntry is an indexed directory.
+type IndexEntry struct {
+	// ModTime is the directory's modification time (in Unix nanoseconds) when
+	// it was indexed. Directories with the same modification time aren't read
+	// again when the index is updated.
+	ModTime int64
+	// Children are the names of the directory's indexed subdirectories.
+	Children []string
+}
+
+// indexStats counts the directories that were read (or reused) by an index
+// walk.
+type indexStats struct {
+	read, reused int
+}
+
+func getIndex() (*cache.Cache, *Index, error) {
+	c, err := indexCache()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get index cache: %v", err)
+	}
+	ix := &Index{}
+	if _, err := c.GetStruct(indexCacheKey, ix); err != nil {
+		return nil, nil, fmt.Errorf("failed to get directory index: %v", err)
+	}
+	return c, ix, nil
+}
+
+// putIndex stores the index and its list of directories.
+func putIndex(c *cache.Cache, ix *Index) error {
+	if err := c.PutStruct(indexCacheKey, ix); err != nil {
+		return err
+	}
+	return c.Put(indexDirsCacheKey, strings.Join(sortedKeys(ix.Dirs), "\n"))
+}
+
+// getIndexDirs returns the indexed directories without decoding the whole
+// index (which also has every directory's children).
+func getIndexDirs() ([]string, error) {
+	c, err := indexCache()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index cache: %v", err)
+	}
+	s, ok, err := c.Get(indexDirsCacheKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get indexed directories: %v", err)
+	}
+	if !ok {
+		// The index was stored before the list of directories was.
+		_, ix, err := getIndex()
+		if err != nil {
+			return nil, err
+		}
+		return sortedKeys(ix.Dirs), nil
+	}
+	if s == "" {
+		return nil, nil
+	}
+	return strings.Split(s, "\n"), nil
+}
+
+// indexSkip returns whether a directory (and everything under it) is left out
+// of the index. Hidden directories and directories that match the completion
+// ignore patterns are skipped.
+func (d *Dot) indexSkip(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	if d.Completion != nil {
+		for _, p := range d.Completion.Ignore {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// walkRoot indexes an index root and its subdirectories. Unlike the
+// directories under it, a root may be a symbolic link to a directory.
+func (d *Dot) walkRoot(ix *Index, root string, prev map[string]*IndexEntry, stats *indexStats) {
+	d.walkDir(ix, root, d.filesystem().Stat, prev, stats)
+}
+
+// walk indexes the directory and its subdirectories (unless the directory is
+// a symbolic link).
+func (d *Dot) walk(ix *Index, dir string, prev map[string]*IndexEntry, stats *indexStats) {
+	d.walkDir(ix, dir, d.filesystem().Lstat, prev, stats)
+}
+
+// walkDir indexes the directory (using stat to check that it is one) and its
+// subdirectories. Directories whose modification time hasn't changed since
+// they were indexed in prev reuse their children instead of being read again.
+func (d *Dot) walkDir(ix *Index, dir string, stat func(string) (fs.FileInfo, error), prev map[string]*IndexEntry, stats *indexStats) {
+	fsys := d.filesystem()
+	fi, err := stat(dir)
+	if err != nil || !fi.IsDir() {
+		// Removed directories are dropped from the index.
+		return
+	}
+	modTime := fi.ModTime().UnixNano()
+
+	e, ok := prev[dir]
+	if ok && e.ModTime == modTime {
+		stats.reused++
+	} else {
+		es, err := fsys.ReadDir(dir)
+		if err != nil {
+			// Directories that can't be read are still indexed (just not their
+			// children).
+			es = nil
+		}
+		e = &IndexEntry{ModTime: modTime}
+		for _, de := range es {
+			// Symbolic links aren't followed (to avoid cycles).
+			if de.IsDir() && !d.indexSkip(de.Name()) {
+				e.Children = append(e.Children, de.Name())
+			}
+		}
+		stats.read++
+	}
+
+	ix.Dirs[dir] = e
+	for _, c := range e.Children {
+		d.walk(ix, filepath.Join(dir, c), prev, stats)
+	}
+}
+
+// update re-indexes the index's roots, reusing the entries of unchanged
+// directories in prev.
+func (d *Dot) update(ix *Index, prev map[string]*IndexEntry) *indexStats {
+	stats := &indexStats{}
+	ix.Dirs = map[string]*IndexEntry{}
+	for _, root := range ix.Roots {
+		d.walkRoot(ix, root, prev, stats)
+	}
+	ix.Updated = timeNow().Unix()
+	return stats
+}
+
+// fuzzyScore returns how well the directory matches the query terms (and false
+// if it doesn't match). Each term must match the path as a case-insensitive
+// subsequence (in order), and matches that are contiguous, start path
+// components, or are in the directory's name score higher.
+func fuzzyScore(dir string, terms []string) (int, bool) {
+	p := strings.ToLower(filepath.ToSlash(dir))
+	var score, pos int
+	for _, term := range terms {
+		term = strings.ToLower(filepath.ToSlash(term))
+		prev := -2
+		for _, r := range term {
+			i := strings.IndexRune(p[pos:], r)
+			if i < 0 {
+				return 0, false
+			}
+			i += pos
+			score++
+			if i == prev+1 {
+				score += 2
+			}
+			if i == 0 || p[i-1] == '/' {
+				score += 3
+			}
+			prev, pos = i, i+len(string(r))
+		}
+	}
+
+	// Prefer directories whose name matches the last term.
+	base := strings.ToLower(filepath.Base(dir))
+	last := strings.ToLower(terms[len(terms)-1])
+	switch {
+	case base == last:
+		score += 30
+	case strings.HasPrefix(base, last):
+		score += 20
+	case strings.Contains(base, last):
+		score += 10
+	}
+	return score, true
+}
+
+// jumpMatches returns the indexed directories that match the query terms,
+// best match first. Ties are broken by frecency and then by shorter paths.
+func jumpMatches(dirs []string, terms []string) []string {
+	var visits *Visits
+	if _, v, err := getVisits(); err == nil {
+		visits = v
+	}
+	now := timeNow()
+
+	type match struct {
+		dir      string
+		score    int
+		frecency float64
+	}
+	var ms []*match
+	for _, dir := range dirs {
+		if s, ok := fuzzyScore(dir, terms); ok {
+			m := &match{dir: dir, score: s}
+			if visits != nil {
+				m.frecency = visits.score(dir, now)
+			}
+			ms = append(ms, m)
+		}
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].score != ms[j].score {
+			return ms[i].score > ms[j].score
+		}
+		if ms[i].frecency != ms[j].frecency {
+			return ms[i].frecency > ms[j].frecency
+		}
+		if len(ms[i].dir) != len(ms[j].dir) {
+			return len(ms[i].dir) < len(ms[j].dir)
+		}
+		return ms[i].dir < ms[j].dir
+	})
+
+	r := make([]string, 0, len(ms))
+	for _, m := range ms {
+		r = append(r, m.dir)
+	}
+	return r
+}
+
+// queryTerms returns the non-empty query terms (terms can also be separated
+// by spaces within an argument).
+func queryTerms(args []string) []string {
+	var terms []string
+	for _, a := range args {
+		terms = append(terms, strings.FieldsFunc(a, unicode.IsSpace)...)
+	}
+	return terms
+}
+
+func (d *Dot) indexNode() command.Node {
+	return &commander.BranchNode{
+		Branches: map[string]command.Node{
+			"build": commander.SerialNodes(
+				commander.Description("Index all of the directories under the provided directories (replacing the existing index)"),
+				indexDirsArg,
+				&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+					roots := indexDirsArg.Get(data)
+					if len(roots) == 0 {
+						home, err := fsUserHomeDir(filesystem(data))
+						if err != nil {
+							return o.Annotatef(err, "failed to get home directory")
+						}
+						roots = []string{home}
+					}
+					ix := &Index{Roots: roots}
+					return d.saveIndex(o, ix, nil)
+				}},
+			),
+			"update": commander.SerialNodes(
+				commander.Description("Update the index (only directories that changed since the last update are read)"),
+				&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+					_, ix, err := getIndex()
+					if err != nil {
+						return o.Err(err)
+					}
+					if len(ix.Roots) == 0 {
+						return o.Stderrln("no directory index (run `d index build` to build one)")
+					}
+					return d.saveIndex(o, ix, ix.Dirs)
+				}},
+			),
+		},
+		Default: commander.SerialNodes(
+			commander.Description("Print the status of the directory index"),
+			&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+				_, ix, err := getIndex()
+				if err != nil {
+					return o.Err(err)
+				}
+				if len(ix.Roots) == 0 {
+					o.Stdoutln("no directory index (run `d index build` to build one)")
+					return nil
+				}
+				o.Stdoutf("roots: %s\n", strings.Join(ix.Roots, " "))
+				o.Stdoutf("directories: %d\n", len(ix.Dirs))
+				o.Stdoutf("updated: %s\n", time.Unix(ix.Updated, 0).Format(time.RFC3339))
+				return nil
+			}},
+		),
+	}
+}
+
+// saveIndex updates and stores the index.
+func (d *Dot) saveIndex(o command.Output, ix *Index, prev map[string]*IndexEntry) error {
+	c, err := indexCache()
+	if err != nil {
+		return o.Annotatef(err, "failed to get index cache")
+	}
+	stats := d.update(ix, prev)
+	if err := putIndex(c, ix); err != nil {
+		return o.Annotatef(err, "failed to save directory index")
+	}
+	o.Stdoutf("Indexed %d directories (%d read, %d unchanged)\n", len(ix.Dirs), stats.read, stats.reused)
+	return nil
+}
+
+func (d *Dot) jumpNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Go to the indexed directory that best matches the query"),
+		d.getwd(),
+		cache.ShellProcessor(),
+		commander.ListArg[string](jumpQueryArg, "Terms that the directory's path must contain (in order, as a fuzzy match)", 1, command.UnboundedList,
+			commander.CompleterFromFunc(func(sl []string, data *command.Data) (*command.Completion, error) {
+				terms := queryTerms(sl)
+				if len(terms) == 0 {
+					return nil, nil
+				}
+				dirs, err := getIndexDirs()
+				if err != nil {
+					return nil, err
+				}
+				ms := jumpMatches(dirs, terms)
+				if len(ms) > maxJumpSuggestions {
+					ms = ms[:maxJumpSuggestions]
+				}
+				// Only a single match is completed (the suggestions don't start with
+				// the query, so the shell can't complete a common prefix).
+				return keepOrder(data, &command.Completion{
+					Suggestions:  ms,
+					IgnoreFilter: true,
+					DontComplete: len(ms) > 1,
+				}), nil
+			}),
+		),
+		commander.ExecutableProcessor(func(o command.Output, data *command.Data) ([]string, error) {
+			terms := queryTerms(data.StringList(jumpQueryArg))
+			// A completed suggestion is the directory itself.
+			if len(terms) == 1 && filepath.IsAbs(terms[0]) {
+				if fi, err := d.filesystem().Stat(terms[0]); err == nil && fi.IsDir() {
+					return d.changeDirectory(o, data, terms[0])
+				}
+			}
+			if len(terms) == 0 {
+				return nil, o.Stderrln("no query terms provided")
+			}
+			dirs, err := getIndexDirs()
+			if err != nil {
+				return nil, o.Err(err)
+			}
+			if len(dirs) == 0 {
+				return nil, o.Stderrln("no directory index (run `d index build` to build one)")
+			}
+			ms := jumpMatches(dirs, terms)
+			if len(ms) == 0 {
+				return nil, o.Stderrf("no indexed directory matches %q\n", strings.Join(terms, " "))
+			}
+			return d.changeDirectory(o, data, ms[0])
+		}),
+		&commander.ExecutorProcessor{F: d.updateHistory},
+	)
+}
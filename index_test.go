@@ -0,0 +1,339 @@
+package cd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestIndex(t *testing.T) {
+	root := listingDir(t, map[string]string{
+		"src/api/":            "",
+		"src/web/components/": "",
+		"docs/":               "",
+		".git/objects/":       "",
+		"node_modules/pkg/":   "",
+		"notes.txt":           "",
+	})
+	now := time.Unix(1_000_000_000, 0)
+	// The index is shared by all of the steps.
+	ic := cachetest.NewTestCache(t)
+	d := &Dot{Completion: &CompletionFilter{Ignore: []string{"node_modules"}}}
+	d.fsys = &statFS{home: root}
+
+	for _, step := range []struct {
+		name string
+		// mkdir is a directory created (relative to root) before the step.
+		mkdir string
+		etc   *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "status without index",
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"index"},
+				WantStdout: "no directory index (run `d index build` to build one)\n",
+			},
+		},
+		{
+			name: "update fails without index",
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"index", "update"},
+				WantStderr: "no directory index (run `d index build` to build one)\n",
+				WantErr:    fmt.Errorf("no directory index (run `d index build` to build one)"),
+			},
+		},
+		{
+			name: "jump fails without index",
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"jump", "api"},
+				WantStderr: "no directory index (run `d index build` to build one)\n",
+				WantErr:    fmt.Errorf("no directory index (run `d index build` to build one)"),
+			},
+		},
+		{
+			name: "builds index of home directory",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"index", "build"},
+				// Hidden and ignored directories aren't indexed.
+				WantStdout: "Indexed 6 directories (6 read, 0 unchanged)\n",
+			},
+		},
+		{
+			name: "prints status",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"index"},
+				WantStdout: fmt.Sprintf("roots: %s\n", root) +
+					"directories: 6\n" +
+					fmt.Sprintf("updated: %s\n", now.Format(time.RFC3339)),
+			},
+		},
+		{
+			name: "jumps to best match",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"jump", "comp"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(root, "src", "web", "components"))},
+				},
+			},
+		},
+		{
+			name: "jumps with multiple terms",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"jump", "src", "a"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(root, "src", "api"))},
+				},
+			},
+		},
+		{
+			name: "jumps to completed directory",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"jump", filepath.Join(root, "docs")},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(root, "docs"))},
+				},
+			},
+		},
+		{
+			name: "jump fails if nothing matches",
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"jump", "zzz"},
+				WantStderr: "no indexed directory matches \"zzz\"\n",
+				WantErr:    fmt.Errorf("no indexed directory matches \"zzz\""),
+			},
+		},
+		{
+			name:  "updates changed directories",
+			mkdir: filepath.Join("src", "api", "v2"),
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"index", "update"},
+				WantStdout: "Indexed 7 directories (2 read, 5 unchanged)\n",
+			},
+		},
+		{
+			name: "jumps to new directory",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"jump", "v2"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(root, "src", "api", "v2"))},
+				},
+			},
+		},
+		{
+			name: "builds index of provided directories",
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"index", "build", filepath.Join(root, "src")},
+				WantStdout: "Indexed 5 directories (5 read, 0 unchanged)\n",
+			},
+		},
+	} {
+		t.Run(step.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, root, nil)
+			commandtest.StubValue(t, &timeNow, func() time.Time { return now })
+			commandtest.StubValue(t, &indexCache, func() (*cache.Cache, error) { return ic, nil })
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+			if step.mkdir != "" {
+				if err := os.MkdirAll(filepath.Join(root, step.mkdir), 0755); err != nil {
+					t.Fatalf("failed to create directory: %v", err)
+				}
+			}
+
+			step.etc.Node = d.Node()
+			step.etc.OS = &commandtest.FakeOS{}
+			step.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, step.etc)
+		})
+	}
+}
+
+func TestIndexSymlinkedRoot(t *testing.T) {
+	target := listingDir(t, map[string]string{
+		"api/v1/": "",
+		"web/":    "",
+	})
+	root := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(target, root); err != nil {
+		t.Fatalf("failed to create symbolic link: %v", err)
+	}
+	// Links under the root aren't followed (this one would be a cycle).
+	if err := os.Symlink(target, filepath.Join(target, "loop")); err != nil {
+		t.Fatalf("failed to create symbolic link: %v", err)
+	}
+	ic := cachetest.NewTestCache(t)
+	d := &Dot{}
+
+	for _, step := range []struct {
+		name string
+		etc  *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "builds index of symbolic link",
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"index", "build", root},
+				WantStdout: "Indexed 4 directories (4 read, 0 unchanged)\n",
+			},
+		},
+		{
+			name: "updates index of symbolic link",
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"index", "update"},
+				WantStdout: "Indexed 4 directories (0 read, 4 unchanged)\n",
+			},
+		},
+		{
+			name: "jumps through symbolic link",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"jump", "v1"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(root, "api", "v1"))},
+				},
+			},
+		},
+	} {
+		t.Run(step.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, target, nil)
+			commandtest.StubValue(t, &indexCache, func() (*cache.Cache, error) { return ic, nil })
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			step.etc.Node = d.Node()
+			step.etc.OS = &commandtest.FakeOS{}
+			step.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, step.etc)
+		})
+	}
+}
+
+func TestJumpAutocomplete(t *testing.T) {
+	root := listingDir(t, map[string]string{
+		"src/api/":            "",
+		"src/web/components/": "",
+		"docs/":               "",
+	})
+	d := &Dot{}
+	ix := &Index{Roots: []string{root}}
+	d.update(ix, nil)
+	ic := cachetest.NewTestCache(t)
+	if err := putIndex(ic, ix); err != nil {
+		t.Fatalf("failed to store index: %v", err)
+	}
+
+	for _, test := range []struct {
+		name string
+		args string
+		want *command.Autocompletion
+	}{
+		{
+			name: "suggests matching directories",
+			args: "cmd jump we",
+			want: &command.Autocompletion{
+				// The matches don't start with the query, so they aren't completed.
+				Suggestions: []string{
+					filepath.Join(root, "src", "web"),
+					filepath.Join(root, "src", "web", "components"),
+					" ",
+				},
+			},
+		},
+		{
+			name: "completes single match",
+			args: "cmd jump src ap",
+			want: &command.Autocompletion{
+				Suggestions: []string{filepath.Join(root, "src", "api")},
+			},
+		},
+		{
+			name: "no suggestions without query",
+			args: "cmd jump ",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, root, nil)
+			commandtest.StubValue(t, &indexCache, func() (*cache.Cache, error) { return ic, nil })
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+			commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+				Node:          d.Node(),
+				Args:          test.args,
+				Want:          test.want,
+				SkipDataCheck: true,
+				OS:            &commandtest.FakeOS{},
+			})
+		})
+	}
+}
+
+func TestGetIndexDirs(t *testing.T) {
+	ix := &Index{Dirs: map[string]*IndexEntry{
+		"/b":   {Children: []string{"c"}},
+		"/b/c": {},
+		"/a":   {},
+	}}
+	for _, test := range []struct {
+		name string
+		put  func(c *cache.Cache) error
+		want []string
+	}{
+		{
+			name: "reads directory list",
+			put:  func(c *cache.Cache) error { return putIndex(c, ix) },
+			want: []string{"/a", "/b", "/b/c"},
+		},
+		{
+			name: "reads index without directory list",
+			put:  func(c *cache.Cache) error { return c.PutStruct(indexCacheKey, ix) },
+			want: []string{"/a", "/b", "/b/c"},
+		},
+		{
+			name: "reads empty index",
+			put:  func(c *cache.Cache) error { return putIndex(c, &Index{}) },
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ic := cachetest.NewTestCache(t)
+			commandtest.StubValue(t, &indexCache, func() (*cache.Cache, error) { return ic, nil })
+			if err := test.put(ic); err != nil {
+				t.Fatalf("failed to store index: %v", err)
+			}
+			got, err := getIndexDirs()
+			if err != nil {
+				t.Fatalf("getIndexDirs() returned error: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("getIndexDirs() returned incorrect directories (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	for _, test := range []struct {
+		dir     string
+		terms   []string
+		want    int
+		noMatch bool
+	}{
+		// 3 letters, 2 contiguous, 1 component start, and an exact name.
+		{"/src/api", []string{"api"}, 3 + 4 + 3 + 30, false},
+		// Subsequence match in the name.
+		{"/src/apple", []string{"ape"}, 3 + 2 + 3 + 0, false},
+		{"/src/api", []string{"src", "api"}, 6 + 8 + 6 + 30, false},
+		// Terms must match in order.
+		{"/src/api", []string{"api", "src"}, 0, true},
+		{"/src/api", []string{"web"}, 0, true},
+	} {
+		t.Run(fmt.Sprintf("%s %v", test.dir, test.terms), func(t *testing.T) {
+			got, ok := fuzzyScore(filepath.FromSlash(test.dir), test.terms)
+			if ok == test.noMatch || got != test.want {
+				t.Errorf("fuzzyScore(%q, %v) returned (%d, %v); want (%d, %v)", test.dir, test.terms, got, ok, test.want, !test.noMatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package cd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	listingOff     = "off"
+	listingLs      = "ls"
+	listingSummary = "summary"
+)
+
+var (
+	listingFormats = []string{listingOff, listingLs, listingSummary}
+
+	lsFlag           = commander.BoolFlag("ls", 'l', "List the destination directory after changing to it")
+	listingFormatArg = commander.OptionalArg[string]("FORMAT", "How the directory is listed after changing to it",
+		commander.SimpleCompleter[string](listingFormats...),
+		commander.InList(listingFormats...),
+	)
+
+	// projectMarkers are notable files that are included in the summary listing.
+	projectMarkers = []string{
+		"go.mod",
+		"package.json",
+		"Cargo.toml",
+		"pyproject.toml",
+		"requirements.txt",
+		"Makefile",
+		"Dockerfile",
+		projectShortcutsFile,
+	}
+)
+
+// listingCommand returns the command that lists the directory after changing
+// to it (or an empty string if no listing should be done).
+func (d *Dot) listingCommand(sh shell, data *command.Data, dir string) string {
+	format := d.ListFormat
+	if format == listingOff {
+		format = ""
+	}
+	if data.Bool(lsFlag.Name()) && format == "" {
+		format = listingLs
+	}
+
+	switch format {
+	case listingLs:
+		return sh.List()
+	case listingSummary:
+		abs, err := absoluteDir(data, dir)
+		if err != nil {
+			return ""
+		}
+		if s, ok := summarize(d.filesystem(), abs); ok {
+			return sh.Echo(s)
+		}
+	}
+	return ""
+}
+
+// summarize returns a compact, one-line summary of the directory contents.
+func summarize(fsys FS, dir string) (string, bool) {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+
+	var dirs, files int
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if e.IsDir() {
+			dirs++
+		} else {
+			files++
+		}
+	}
+	parts := []string{fmt.Sprintf("%d %s, %d %s", dirs, plural(dirs, "dir"), files, plural(files, "file"))}
+	if b, ok := gitBranch(fsys, dir); ok {
+		parts = append(parts, fmt.Sprintf("git: %s", b))
+	}
+	var ms []string
+	for _, m := range projectMarkers {
+		if _, err := fsys.Stat(filepath.Join(dir, m)); err == nil {
+			ms = append(ms, m)
+		}
+	}
+	if len(ms) > 0 {
+		parts = append(parts, strings.Join(ms, ", "))
+	}
+	return strings.Join(parts, " | "), true
+}
+
+func plural(n int, s string) string {
+	if n == 1 {
+		return s
+	}
+	return s + "s"
+}
+
+// gitBranch returns the git branch (or short commit if detached) of the
+// repository that contains the directory.
+func gitBranch(fsys FS, dir string) (string, bool) {
+	for prev := ""; dir != prev; prev, dir = dir, filepath.Dir(dir) {
+		gitDir := filepath.Join(dir, ".git")
+		fi, err := fsys.Stat(gitDir)
+		if err != nil {
+			continue
+		}
+
+		// Worktrees and submodules use a `.git` file that points to the git directory.
+		if !fi.IsDir() {
+			b, err := fsys.ReadFile(gitDir)
+			if err != nil {
+				return "", false
+			}
+			gd := strings.TrimSpace(strings.TrimPrefix(string(b), "gitdir:"))
+			if !filepath.IsAbs(gd) {
+				gd = filepath.Join(dir, gd)
+			}
+			gitDir = gd
+		}
+
+		b, err := fsys.ReadFile(filepath.Join(gitDir, "HEAD"))
+		if err != nil {
+			return "", false
+		}
+		head := strings.TrimSpace(string(b))
+		if ref, ok := strings.CutPrefix(head, "ref: refs/heads/"); ok {
+			return ref, true
+		}
+		if len(head) > 7 {
+			head = head[:7]
+		}
+		return head, head != ""
+	}
+	return "", false
+}
+
+func (d *Dot) listingNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Set how directories are listed after changing to them (or print the current format)"),
+		listingFormatArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			if !data.Has(listingFormatArg.Name()) {
+				format := d.ListFormat
+				if format == "" {
+					format = listingOff
+				}
+				o.Stdoutln(format)
+				return nil
+			}
+
+			d.ListFormat = listingFormatArg.Get(data)
+			if d.ListFormat == listingOff {
+				d.ListFormat = ""
+			}
+			d.MarkChanged()
+			return nil
+		}},
+	)
+}
@@ -0,0 +1,195 @@
+package cd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// listingDir creates a temporary directory with the provided files (and
+// directories, for names ending in a slash).
+func listingDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatalf("failed to create directory: %v", err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestListing(t *testing.T) {
+	repo := listingDir(t, map[string]string{
+		"cmd/":      "",
+		"pkg/":      "",
+		"go.mod":    "module x",
+		"Makefile":  "",
+		".hidden":   "",
+		".git/HEAD": "ref: refs/heads/main\n",
+	})
+	detached := listingDir(t, map[string]string{
+		"main.go":   "",
+		".git/HEAD": "0123456789abcdef\n",
+	})
+	worktree := listingDir(t, map[string]string{
+		"wt/.git":         "gitdir: ../gitdir\n",
+		"gitdir/HEAD":     "ref: refs/heads/feature\n",
+		"wt/package.json": "",
+	})
+	plain := listingDir(t, map[string]string{
+		"one/": "",
+	})
+
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		want *Dot
+		env  map[string]string
+		etc  *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "lists with flag",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{plain, "--ls"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{fmt.Sprintf("%s && ls", bashCd(plain))},
+				},
+			},
+		},
+		{
+			name: "lists with config",
+			d:    &Dot{ListFormat: listingLs},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{plain},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{fmt.Sprintf("%s && ls", bashCd(plain))},
+				},
+			},
+		},
+		{
+			name: "lists summary",
+			d:    &Dot{ListFormat: listingSummary},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{repo},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{fmt.Sprintf("%s && printf '%%s\\n' '2 dirs, 2 files | git: main | go.mod, Makefile'", bashCd(repo))},
+				},
+			},
+		},
+		{
+			name: "lists summary in sub directory",
+			d:    &Dot{ListFormat: listingSummary},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{repo, "cmd", "-l"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{fmt.Sprintf("%s && printf '%%s\\n' '0 dirs, 0 files | git: main'", bashCd(filepath.Join(repo, "cmd")))},
+				},
+			},
+		},
+		{
+			name: "lists summary for detached head",
+			d:    &Dot{ListFormat: listingSummary},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{detached},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{fmt.Sprintf("%s && printf '%%s\\n' '0 dirs, 1 file | git: 0123456'", bashCd(detached))},
+				},
+			},
+		},
+		{
+			name: "lists summary for worktree",
+			d:    &Dot{ListFormat: listingSummary},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{filepath.Join(worktree, "wt")},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{fmt.Sprintf("%s && printf '%%s\\n' '0 dirs, 1 file | git: feature | package.json'", bashCd(filepath.Join(worktree, "wt")))},
+				},
+			},
+		},
+		{
+			name: "lists with fish",
+			d:    &Dot{},
+			env:  map[string]string{shellEnvVar: "fish"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{plain, "--ls"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{fmt.Sprintf("%s; and ls", bashCd(plain))},
+				},
+			},
+		},
+		{
+			name: "lists with powershell",
+			d:    &Dot{ListFormat: listingSummary},
+			env:  map[string]string{shellEnvVar: "powershell"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{plain},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{fmt.Sprintf("Set-Location -LiteralPath '%s'; if ($?) { Write-Output '1 dir, 0 files' }", plain)},
+				},
+			},
+		},
+		{
+			name: "doesn't list in print mode",
+			d:    &Dot{ListFormat: listingSummary},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"--print", plain},
+				WantStdout: plain + "\n",
+			},
+		},
+		{
+			name: "prints listing format",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"listing"},
+				WantStdout: "off\n",
+			},
+		},
+		{
+			name: "sets listing format",
+			d:    &Dot{},
+			want: &Dot{ListFormat: listingSummary},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"listing", "summary"},
+			},
+		},
+		{
+			name: "turns off listing",
+			d:    &Dot{ListFormat: listingLs},
+			want: &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"listing", "off"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			test.etc.Node = test.d.Node()
+			test.etc.Env = test.env
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package cd
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/leep-frog/command/cache"
+)
+
+// TestMain sets up the environment shared by every test in the package:
+// directory changes record visits (and commands check for pending renames) in
+// temporary caches rather than the user's cache. Each of these caches is
+// empty unless a test stubs visitsCache or envCache.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "leep-cd-caches")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create temporary directory: %v\n", err)
+		os.Exit(1)
+	}
+	tempCache := func() (*cache.Cache, error) {
+		d, err := os.MkdirTemp(dir, "")
+		if err != nil {
+			return nil, err
+		}
+		return cache.FromDir(d)
+	}
+	visitsCache = tempCache
+	envCache = tempCache
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
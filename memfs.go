@@ -0,0 +1,338 @@
+package cd
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	errNotDir     = errors.New("not a directory")
+	errNotSymlink = errors.New("not a symbolic link")
+	errTooManySym = errors.New("too many levels of symbolic links")
+	errIsDir      = errors.New("is a directory")
+)
+
+// MemFS is an in-memory FS for resolving and completing directories without
+// touching the disk (so behavior around symbolic links, permissions, and huge
+// trees can be tested hermetically). Like the operating system's
+// filesystem, directories without the owner's read bit can't be listed and
+// directories without the owner's execute bit can't be traversed. Every change
+// advances a fake clock that sets the modification times.
+type MemFS struct {
+	mu   sync.RWMutex
+	root *memNode
+	wd   string
+	now  time.Time
+	host string
+	home string
+}
+
+// memNode is a file, directory, or symbolic link in a MemFS.
+type memNode struct {
+	mode     fs.FileMode
+	modTime  time.Time
+	data     []byte
+	target   string
+	children map[string]*memNode
+}
+
+// NewMemFS returns an empty in-memory filesystem whose working directory is
+// wd (which is created).
+func NewMemFS(wd string) *MemFS {
+	m := &MemFS{
+		root: &memNode{mode: fs.ModeDir | 0755, children: map[string]*memNode{}},
+		wd:   string(filepath.Separator),
+		now:  time.Unix(1_000_000_000, 0),
+	}
+	if err := m.MkdirAll(wd, 0755); err == nil {
+		m.wd = filepath.Clean(wd)
+	}
+	return m
+}
+
+// tick advances the fake clock and returns the new time.
+func (m *MemFS) tick() time.Time {
+	m.now = m.now.Add(time.Second)
+	return m.now
+}
+
+// abs returns the absolute path for name (without applying `..`, which is
+// applied when the path is resolved).
+func (m *MemFS) abs(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return m.wd + string(filepath.Separator) + name
+}
+
+// lookup returns the node for the path (and the path with its symbolic links
+// resolved). A final symbolic link is only followed if follow is true.
+func (m *MemFS) lookup(op, name string, follow bool) (*memNode, string, error) {
+	parts := splitPath(m.abs(name))
+	stack := []*memNode{m.root}
+	var names []string
+	for i, links := 0, 0; i < len(parts); i++ {
+		cur := stack[len(stack)-1]
+		if cur.mode&fs.ModeDir == 0 {
+			return nil, "", &fs.PathError{Op: op, Path: name, Err: errNotDir}
+		}
+		if cur.mode&0100 == 0 {
+			return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+		}
+		switch parts[i] {
+		case ".":
+			continue
+		case "..":
+			if len(stack) > 1 {
+				stack, names = stack[:len(stack)-1], names[:len(names)-1]
+			}
+			continue
+		}
+
+		child, ok := cur.children[parts[i]]
+		if !ok {
+			return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if child.mode&fs.ModeSymlink == 0 || (i == len(parts)-1 && !follow) {
+			stack, names = append(stack, child), append(names, parts[i])
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return nil, "", &fs.PathError{Op: op, Path: name, Err: errTooManySym}
+		}
+		// Resolve the rest of the path from the start of the link's target.
+		rest := parts[i+1:]
+		if filepath.IsAbs(child.target) {
+			parts = splitPath(child.target)
+		} else {
+			parts = append(append([]string{}, names...), splitPath(child.target)...)
+		}
+		parts = append(parts, rest...)
+		stack, names, i = []*memNode{m.root}, nil, -1
+	}
+	return stack[len(stack)-1], string(filepath.Separator) + filepath.Join(names...), nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, p, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(filepath.Base(p)), nil
+}
+
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, p, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(filepath.Base(p)), nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, _, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.mode&fs.ModeDir == 0 {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: errNotDir}
+	}
+	if n.mode&0400 == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	r := make([]fs.DirEntry, 0, len(n.children))
+	for _, c := range sortedKeys(n.children) {
+		r = append(r, fs.FileInfoToDirEntry(n.children[c].info(c)))
+	}
+	return r, nil
+}
+
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, _, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errNotSymlink}
+	}
+	return n.target, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, _, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	if n.mode&0400 == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return append([]byte{}, n.data...), nil
+}
+
+func (m *MemFS) Getwd() (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.wd, nil
+}
+
+// Hostname returns the hostname set by SetHostname.
+func (m *MemFS) Hostname() (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.host, nil
+}
+
+// SetHostname sets the name of the filesystem's host.
+func (m *MemFS) SetHostname(host string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.host = host
+}
+
+// UserHomeDir returns the home directory set by SetHome.
+func (m *MemFS) UserHomeDir() (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.home == "" {
+		return "", errors.New("home directory is not set")
+	}
+	return m.home, nil
+}
+
+// SetHome sets the user's home directory.
+func (m *MemFS) SetHome(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.home = filepath.Clean(dir)
+}
+
+// Chdir changes the working directory.
+func (m *MemFS) Chdir(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, _, err := m.lookup("chdir", dir, true)
+	if err != nil {
+		return err
+	}
+	if n.mode&fs.ModeDir == 0 {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: errNotDir}
+	}
+	// Like a shell's `cd`, the working directory keeps its symbolic links.
+	m.wd = filepath.Clean(m.abs(dir))
+	return nil
+}
+
+// MkdirAll creates the directory along with any missing parents.
+func (m *MemFS) MkdirAll(dir string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := string(filepath.Separator)
+	for _, part := range splitPath(m.abs(dir)) {
+		p = filepath.Join(p, part)
+		n, _, err := m.lookup("mkdir", p, true)
+		if err == nil {
+			if n.mode&fs.ModeDir == 0 {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: errNotDir}
+			}
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := m.create("mkdir", p, &memNode{mode: fs.ModeDir | perm.Perm(), children: map[string]*memNode{}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFile creates (or truncates) the named file.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n, _, err := m.lookup("open", name, true); err == nil {
+		if n.mode.IsDir() {
+			return &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+		}
+		n.data, n.modTime = append([]byte{}, data...), m.tick()
+		return nil
+	}
+	return m.create("open", name, &memNode{mode: perm.Perm(), data: append([]byte{}, data...)})
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+func (m *MemFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.create("symlink", newname, &memNode{mode: fs.ModeSymlink | 0777, target: oldname})
+}
+
+// Chmod changes the permission bits of the named file (following symbolic
+// links).
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, _, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	n.mode = n.mode.Type() | mode.Perm()
+	return nil
+}
+
+// create adds the node to its parent directory (which must exist).
+func (m *MemFS) create(op, name string, n *memNode) error {
+	dir, base := filepath.Split(filepath.Clean(m.abs(name)))
+	parent, _, err := m.lookup(op, dir, true)
+	if err != nil {
+		return err
+	}
+	if parent.mode&fs.ModeDir == 0 {
+		return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	if parent.mode&0200 == 0 {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	if _, ok := parent.children[base]; ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	}
+	n.modTime = m.tick()
+	parent.children[base] = n
+	parent.modTime = n.modTime
+	return nil
+}
+
+// memInfo is the fs.FileInfo of a MemFS node (when it was stated).
+type memInfo struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	size    int64
+}
+
+func (n *memNode) info(name string) *memInfo {
+	return &memInfo{name, n.mode, n.modTime, int64(len(n.data))}
+}
+
+func (mi *memInfo) Name() string       { return mi.name }
+func (mi *memInfo) Size() int64        { return mi.size }
+func (mi *memInfo) Mode() fs.FileMode  { return mi.mode }
+func (mi *memInfo) ModTime() time.Time { return mi.modTime }
+func (mi *memInfo) IsDir() bool        { return mi.mode.IsDir() }
+func (mi *memInfo) Sys() any           { return nil }
@@ -0,0 +1,271 @@
+package cd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newTestMemFS returns an in-memory filesystem (with the working directory
+// wd) that contains the provided paths. Paths ending in a slash are
+// directories, paths of the form `link -> target` are symbolic links, and
+// other paths are files.
+func newTestMemFS(t *testing.T, wd string, paths ...string) *MemFS {
+	t.Helper()
+	m := NewMemFS(filepath.FromSlash(wd))
+	for _, p := range paths {
+		var err error
+		switch link, target, ok := strings.Cut(p, " -> "); {
+		case ok:
+			link = filepath.FromSlash(link)
+			if err = m.MkdirAll(filepath.Dir(link), 0755); err == nil {
+				err = m.Symlink(filepath.FromSlash(target), link)
+			}
+		case strings.HasSuffix(p, "/"):
+			err = m.MkdirAll(filepath.FromSlash(p), 0755)
+		default:
+			p = filepath.FromSlash(p)
+			if err = m.MkdirAll(filepath.Dir(p), 0755); err == nil {
+				err = m.WriteFile(p, []byte(p), 0644)
+			}
+		}
+		if err != nil {
+			t.Fatalf("failed to create %q: %v", p, err)
+		}
+	}
+	return m
+}
+
+func TestMemFS(t *testing.T) {
+	m := newTestMemFS(t, "/repo",
+		"/repo/src/main.go",
+		"/repo/docs/",
+		"/repo/link -> /data/inner",
+		"/repo/rel -> ../data/inner",
+		"/repo/chain -> link",
+		"/repo/loop -> loop",
+		"/data/inner/deep/",
+		"/locked/sub/",
+		"/hidden/sub/",
+	)
+	if err := m.Chmod(filepath.FromSlash("/locked"), 0300); err != nil {
+		t.Fatalf("failed to change mode: %v", err)
+	}
+	if err := m.Chmod(filepath.FromSlash("/hidden"), 0600); err != nil {
+		t.Fatalf("failed to change mode: %v", err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		f       func() (string, error)
+		want    string
+		wantErr error
+	}{
+		{
+			name: "stats directory",
+			f:    statMode(m.Stat, "/repo/docs"),
+			want: "docs d",
+		},
+		{
+			name: "stats relative path",
+			f:    statMode(m.Stat, "src/main.go"),
+			want: "main.go -",
+		},
+		{
+			name: "stat follows symbolic links",
+			f:    statMode(m.Stat, "/repo/link/deep"),
+			want: "deep d",
+		},
+		{
+			name: "stat follows relative symbolic links",
+			f:    statMode(m.Stat, "/repo/rel"),
+			want: "inner d",
+		},
+		{
+			name: "stat follows chained symbolic links",
+			f:    statMode(m.Stat, "/repo/chain"),
+			want: "inner d",
+		},
+		{
+			name: "stat applies .. after following symbolic links",
+			f:    statMode(m.Stat, "/repo/link/../inner/deep"),
+			want: "deep d",
+		},
+		{
+			name: "lstat doesn't follow final symbolic link",
+			f:    statMode(m.Lstat, "/repo/link"),
+			want: "link L",
+		},
+		{
+			name:    "stat fails for missing file",
+			f:       statMode(m.Stat, "/repo/missing"),
+			wantErr: fs.ErrNotExist,
+		},
+		{
+			name:    "stat fails for symbolic link loop",
+			f:       statMode(m.Stat, "/repo/loop"),
+			wantErr: errTooManySym,
+		},
+		{
+			name:    "stat fails below file",
+			f:       statMode(m.Stat, "/repo/src/main.go/x"),
+			wantErr: errNotDir,
+		},
+		{
+			name:    "stat fails in directory that can't be traversed",
+			f:       statMode(m.Stat, "/hidden/sub"),
+			wantErr: fs.ErrPermission,
+		},
+		{
+			name: "reads directory",
+			f:    readDirNames(m, "/repo"),
+			want: "chain L, docs d, link L, loop L, rel L, src d",
+		},
+		{
+			name: "reads directory through symbolic link",
+			f:    readDirNames(m, "/repo/link"),
+			want: "deep d",
+		},
+		{
+			name: "reads directory that can't be traversed",
+			f:    readDirNames(m, "/hidden"),
+			want: "sub d",
+		},
+		{
+			name:    "read fails for directory that can't be read",
+			f:       readDirNames(m, "/locked"),
+			wantErr: fs.ErrPermission,
+		},
+		{
+			name:    "read fails for file",
+			f:       readDirNames(m, "/repo/src/main.go"),
+			wantErr: errNotDir,
+		},
+		{
+			name: "reads file",
+			f:    readFile(m, "/repo/link/../../repo/src/main.go"),
+			want: filepath.FromSlash("/repo/src/main.go"),
+		},
+		{
+			name:    "read file fails for directory",
+			f:       readFile(m, "/repo/docs"),
+			wantErr: errIsDir,
+		},
+		{
+			name: "reads link",
+			f:    func() (string, error) { return m.Readlink(filepath.FromSlash("/repo/rel")) },
+			want: filepath.FromSlash("../data/inner"),
+		},
+		{
+			name:    "readlink fails for directory",
+			f:       func() (string, error) { return m.Readlink(filepath.FromSlash("/repo/docs")) },
+			wantErr: errNotSymlink,
+		},
+		{
+			name: "evaluates symbolic links",
+			f:    func() (string, error) { return evalSymlinks(m, filepath.FromSlash("chain/deep/..")) },
+			want: filepath.FromSlash("/data/inner"),
+		},
+		{
+			name:    "evaluating symbolic links fails for loop",
+			f:       func() (string, error) { return evalSymlinks(m, filepath.FromSlash("/repo/loop")) },
+			wantErr: errTooManySym,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.f()
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("returned error %v; want %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("returned incorrect result (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMemFSChanges(t *testing.T) {
+	m := newTestMemFS(t, "/repo", "/repo/src/")
+	before, err := m.Stat(filepath.FromSlash("/repo"))
+	if err != nil {
+		t.Fatalf("Stat() returned error: %v", err)
+	}
+
+	if err := m.MkdirAll(filepath.FromSlash("new/inner"), 0755); err != nil {
+		t.Fatalf("MkdirAll() returned error: %v", err)
+	}
+	after, err := m.Stat(filepath.FromSlash("/repo"))
+	if err != nil {
+		t.Fatalf("Stat() returned error: %v", err)
+	}
+	if !after.ModTime().After(before.ModTime()) {
+		t.Errorf("MkdirAll() didn't update the parent's modification time (%v, %v)", before.ModTime(), after.ModTime())
+	}
+
+	if err := m.Symlink("src", filepath.FromSlash("/repo/src")); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Symlink() returned error %v; want %v", err, fs.ErrExist)
+	}
+	if err := m.MkdirAll(filepath.FromSlash("/repo/src/main.go"), 0755); err != nil {
+		t.Fatalf("MkdirAll() returned error: %v", err)
+	}
+	if err := m.WriteFile(filepath.FromSlash("/repo/src/main.go"), nil, 0644); err == nil {
+		t.Errorf("WriteFile() returned nil error for directory")
+	}
+
+	if err := m.Chmod(filepath.FromSlash("/repo"), 0555); err != nil {
+		t.Fatalf("Chmod() returned error: %v", err)
+	}
+	if err := m.MkdirAll(filepath.FromSlash("/repo/other"), 0755); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("MkdirAll() returned error %v; want %v", err, fs.ErrPermission)
+	}
+
+	if err := m.Chdir(filepath.FromSlash("new/inner/..")); err != nil {
+		t.Fatalf("Chdir() returned error: %v", err)
+	}
+	if wd, _ := m.Getwd(); wd != filepath.FromSlash("/repo/new") {
+		t.Errorf("Getwd() returned %q; want %q", wd, filepath.FromSlash("/repo/new"))
+	}
+	if err := m.Chdir("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Chdir() returned error %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+// statMode returns a function that returns the name and type of the stated
+// file.
+func statMode(stat func(string) (fs.FileInfo, error), name string) func() (string, error) {
+	return func() (string, error) {
+		fi, err := stat(filepath.FromSlash(name))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s", fi.Name(), fi.Mode().Type().String()[:1]), nil
+	}
+}
+
+// readDirNames returns a function that returns the names and types of the
+// directory's entries.
+func readDirNames(m *MemFS, dir string) func() (string, error) {
+	return func() (string, error) {
+		es, err := m.ReadDir(filepath.FromSlash(dir))
+		if err != nil {
+			return "", err
+		}
+		var r []string
+		for _, e := range es {
+			r = append(r, fmt.Sprintf("%s %s", e.Name(), e.Type().String()[:1]))
+		}
+		return strings.Join(r, ", "), nil
+	}
+}
+
+func readFile(m *MemFS, name string) func() (string, error) {
+	return func() (string, error) {
+		b, err := m.ReadFile(filepath.FromSlash(name))
+		return string(b), err
+	}
+}
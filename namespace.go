@@ -0,0 +1,224 @@
+package cd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	// namespaceSeparator separates a shortcut's namespace from its name
+	// (e.g. `work:api`).
+	namespaceSeparator = ":"
+	namespaceArgName   = "NAMESPACE"
+)
+
+var (
+	hostFlag = commander.Flag[string]("host", 'H', "Host for which the namespace is enabled or disabled (defaults to the current host)")
+)
+
+// splitNamespace splits a shortcut name into its namespace and base name. The
+// namespace is empty if the shortcut isn't namespaced.
+func splitNamespace(shortcut string) (string, string) {
+	if i := strings.Index(shortcut, namespaceSeparator); i > 0 {
+		return shortcut[:i], shortcut[i+1:]
+	}
+	return "", shortcut
+}
+
+// namespaces returns a map from namespace to the shortcuts in that namespace.
+func (d *Dot) namespaces() map[string][]string {
+	m := map[string][]string{}
+	for k := range d.dirShortcuts() {
+		if ns, _ := splitNamespace(k); ns != "" {
+			m[ns] = append(m[ns], k)
+		}
+	}
+	for _, v := range m {
+		sort.Strings(v)
+	}
+	return m
+}
+
+func hostname(data *command.Data) (string, error) {
+	if hostFlag.Provided(data) {
+		return hostFlag.Get(data), nil
+	}
+	h, err := fsHostname(filesystem(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to get hostname: %v", err)
+	}
+	return h, nil
+}
+
+// namespaceEnabled returns whether the shortcut's namespace is enabled on the
+// provided host. Shortcuts without a namespace are always enabled.
+func (d *Dot) namespaceEnabled(host, shortcut string) bool {
+	ns, _ := splitNamespace(shortcut)
+	if ns == "" {
+		return true
+	}
+	for _, dns := range d.DisabledNamespaces[host] {
+		if dns == ns {
+			return false
+		}
+	}
+	return true
+}
+
+// namespaceTransformer runs before user shortcuts are expanded. It rejects
+// shortcuts in namespaces disabled for this host and resolves a bare name
+// (e.g. `api`) to its namespaced shortcut (e.g. `work:api`) when exactly one
+// enabled namespace defines it.
+func (d *Dot) namespaceTransformer() command.Processor {
+	it := &command.InputTransformer{F: func(o command.Output, data *command.Data, s string) ([]string, error) {
+		ns, err := d.namespacedShortcut(data, s)
+		if err != nil {
+			return nil, err
+		}
+		return []string{ns}, nil
+	}}
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		return o.Err(it.Transform(i, o, data, false))
+	}, it.Complete)
+}
+
+// namespacedShortcut returns the namespaced shortcut for the provided
+// argument (or the argument itself if it isn't a bare shortcut name).
+func (d *Dot) namespacedShortcut(data *command.Data, s string) (string, error) {
+	if len(d.DisabledNamespaces) == 0 && len(d.namespaces()) == 0 {
+		return s, nil
+	}
+
+	host, err := hostname(data)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := d.dirShortcuts()[s]; ok {
+		if !d.namespaceEnabled(host, s) {
+			ns, _ := splitNamespace(s)
+			return "", fmt.Errorf("shortcut namespace %q is disabled on host %q", ns, host)
+		}
+		return s, nil
+	}
+
+	var matches []string
+	for k := range d.dirShortcuts() {
+		if ns, name := splitNamespace(k); ns != "" && name == s && d.namespaceEnabled(host, k) {
+			matches = append(matches, k)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	return s, nil
+}
+
+// namespaceCompletion returns the enabled shortcuts in the namespace that `s`
+// starts with (or nil if `s` isn't prefixed with a known namespace).
+func (d *Dot) namespaceCompletion(s string, data *command.Data) (*command.Completion, error) {
+	ns, _ := splitNamespace(s)
+	shortcuts, ok := d.namespaces()[ns]
+	if ns == "" || !ok {
+		return nil, nil
+	}
+	host, err := fsHostname(filesystem(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %v", err)
+	}
+	c := &command.Completion{}
+	for _, k := range shortcuts {
+		if d.namespaceEnabled(host, k) {
+			c.Suggestions = append(c.Suggestions, k)
+		}
+	}
+	return c, nil
+}
+
+func (d *Dot) namespaceCompleter() commander.Completer[string] {
+	return commander.CompleterFromFunc(func(s string, data *command.Data) (*command.Completion, error) {
+		return &command.Completion{Suggestions: sortedKeys(d.namespaces())}, nil
+	})
+}
+
+func (d *Dot) namespacesNode() command.Node {
+	nsArg := commander.OptionalArg[string](namespaceArgName, "If provided, list the shortcuts in this namespace", d.namespaceCompleter())
+	return commander.SerialNodes(
+		commander.Description("List shortcut namespaces, or the shortcuts in a namespace"),
+		commander.FlagProcessor(hostFlag),
+		nsArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			host, err := hostname(data)
+			if err != nil {
+				return o.Err(err)
+			}
+
+			nss := d.namespaces()
+			if nsArg.Provided(data) {
+				ns := nsArg.Get(data)
+				if _, ok := nss[ns]; !ok {
+					return o.Stderrf("Namespace %q does not exist\n", ns)
+				}
+				for _, k := range nss[ns] {
+					o.Stdoutf("%s: %s\n", k, strings.Join(d.dirShortcuts()[k], " "))
+				}
+				return nil
+			}
+
+			for _, ns := range sortedKeys(nss) {
+				status := ""
+				if !d.namespaceEnabled(host, ns+namespaceSeparator) {
+					status = " [disabled]"
+				}
+				o.Stdoutf("%s (%d)%s\n", ns, len(nss[ns]), status)
+			}
+			return nil
+		}},
+	)
+}
+
+func (d *Dot) namespaceToggleNode(enable bool) command.Node {
+	nsArg := commander.Arg[string](namespaceArgName, "Shortcut namespace", commander.MinLength[string, string](1), d.namespaceCompleter())
+	desc := "Disable a shortcut namespace on a host"
+	if enable {
+		desc = "Enable a shortcut namespace on a host"
+	}
+	return commander.SerialNodes(
+		commander.Description(desc),
+		commander.FlagProcessor(hostFlag),
+		nsArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			host, err := hostname(data)
+			if err != nil {
+				return o.Err(err)
+			}
+			ns := nsArg.Get(data)
+
+			var disabled []string
+			for _, dns := range d.DisabledNamespaces[host] {
+				if dns != ns {
+					disabled = append(disabled, dns)
+				}
+			}
+			if !enable {
+				disabled = append(disabled, ns)
+				sort.Strings(disabled)
+			}
+
+			if d.DisabledNamespaces == nil {
+				d.DisabledNamespaces = map[string][]string{}
+			}
+			if len(disabled) == 0 {
+				delete(d.DisabledNamespaces, host)
+			} else {
+				d.DisabledNamespaces[host] = disabled
+			}
+			d.MarkChanged()
+			return nil
+		}},
+	)
+}
@@ -0,0 +1,225 @@
+package cd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// namespacedShortcuts are the shortcuts used by the namespace tests.
+var namespacedShortcuts = map[string][]string{
+	"work:api":     {"/work/api"},
+	"work:web":     {"/work/web"},
+	"personal:api": {"/home/api"},
+	"personal:blg": {"/home/blog"},
+	"plain":        {"/plain"},
+}
+
+func TestNamespaces(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		want *Dot
+		etc  *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "uses namespaced shortcut",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"work:api"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/work/api")},
+				},
+			},
+		},
+		{
+			name: "uses unique bare name",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"blg"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/home/blog")},
+				},
+			},
+		},
+		{
+			name: "uses bare name if other namespaces are disabled",
+			d:    &Dot{DisabledNamespaces: map[string][]string{"laptop": {"work"}}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"api"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/home/api")},
+				},
+			},
+		},
+		{
+			name: "ignores ambiguous bare name",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"api"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepathAbs(t, "api"))},
+				},
+			},
+		},
+		{
+			name: "fails for disabled namespace",
+			d:    &Dot{DisabledNamespaces: map[string][]string{"laptop": {"work"}}},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"work:web"},
+				WantErr:    fmt.Errorf(`shortcut namespace "work" is disabled on host "laptop"`),
+				WantStderr: "shortcut namespace \"work\" is disabled on host \"laptop\"\n",
+			},
+		},
+		{
+			name: "lists namespaces",
+			d:    &Dot{DisabledNamespaces: map[string][]string{"laptop": {"work"}, "server": {"personal"}}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "namespaces"},
+				WantStdout: strings.Join([]string{
+					"personal (2)",
+					"work (2) [disabled]",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "lists namespaces for another host",
+			d:    &Dot{DisabledNamespaces: map[string][]string{"laptop": {"work"}, "server": {"personal"}}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "ns", "--host", "server"},
+				WantStdout: strings.Join([]string{
+					"personal (2) [disabled]",
+					"work (2)",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "lists shortcuts in namespace",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "ns", "work"},
+				WantStdout: strings.Join([]string{
+					"work:api: /work/api",
+					"work:web: /work/web",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "listing fails for unknown namespace",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"shortcuts", "ns", "other"},
+				WantErr:    fmt.Errorf(`Namespace "other" does not exist`),
+				WantStderr: "Namespace \"other\" does not exist\n",
+			},
+		},
+		{
+			name: "disables namespace on current host",
+			d:    &Dot{DisabledNamespaces: map[string][]string{"laptop": {"personal"}}},
+			want: &Dot{DisabledNamespaces: map[string][]string{"laptop": {"personal", "work"}}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "disable", "work"},
+			},
+		},
+		{
+			name: "disables namespace on other host",
+			d:    &Dot{},
+			want: &Dot{DisabledNamespaces: map[string][]string{"server": {"work"}}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "disable", "work", "-H", "server"},
+			},
+		},
+		{
+			name: "enables namespace",
+			d:    &Dot{DisabledNamespaces: map[string][]string{"laptop": {"personal", "work"}}},
+			want: &Dot{DisabledNamespaces: map[string][]string{"laptop": {"personal"}}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "enable", "work"},
+			},
+		},
+		{
+			name: "enabling last namespace removes host",
+			d:    &Dot{DisabledNamespaces: map[string][]string{"laptop": {"work"}}},
+			want: &Dot{DisabledNamespaces: map[string][]string{}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "enable", "work"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.d.Shortcuts = map[string]map[string][]string{dirShortcutName: namespacedShortcuts}
+			if test.want != nil {
+				test.want.Shortcuts = map[string]map[string][]string{dirShortcutName: namespacedShortcuts}
+			}
+			test.d.fsys = &statFS{wd: commandtest.FilepathAbs(t), stat: dirStat, host: "laptop"}
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			test.etc.Node = test.d.Node()
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+		})
+	}
+}
+
+func TestNamespaceAutocomplete(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		args string
+		want *command.Autocompletion
+	}{
+		{
+			name: "completes shortcuts in namespace",
+			d:    &Dot{},
+			args: "cmd work:",
+			want: &command.Autocompletion{
+				Suggestions: []string{"work:api", "work:web"},
+			},
+		},
+		{
+			name: "completes partial shortcut in namespace",
+			d:    &Dot{},
+			args: "cmd personal:b",
+			want: &command.Autocompletion{
+				Suggestions: []string{"personal:blg"},
+			},
+		},
+		{
+			name: "does not complete disabled namespace",
+			d:    &Dot{DisabledNamespaces: map[string][]string{"laptop": {"work"}}},
+			args: "cmd work:",
+		},
+		{
+			name: "completes namespaces for enable",
+			d:    &Dot{},
+			args: "cmd shortcuts enable ",
+			want: &command.Autocompletion{
+				Suggestions: []string{"personal", "work"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.d.Shortcuts = map[string]map[string][]string{dirShortcutName: namespacedShortcuts}
+			test.d.fsys = &statFS{host: "laptop"}
+			commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+				Node:          test.d.Node(),
+				Args:          test.args,
+				Want:          test.want,
+				SkipDataCheck: true,
+				OS:            &commandtest.FakeOS{},
+			})
+		})
+	}
+}
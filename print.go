@@ -0,0 +1,115 @@
+package cd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	printFlag = commander.BoolFlag("print", commander.FlagNoShortName, "Print the absolute destination directory instead of changing to it")
+)
+
+// printProcessor consumes a leading `--print` flag so that print mode can be
+// used with every branch (e.g. `d --print parent src` and `d --print -`).
+func printProcessor() command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		applyPrint(i, data, false)
+		return nil
+	}, func(i *command.Input, data *command.Data) (*command.Completion, error) {
+		applyPrint(i, data, true)
+		return nil, nil
+	})
+}
+
+func applyPrint(i *command.Input, data *command.Data, complete bool) {
+	// Don't consume the flag if it is the argument being completed.
+	if complete && i.NumRemaining() <= 1 {
+		return
+	}
+	if v, ok := i.Peek(); ok && v == "--"+printFlag.Name() {
+		i.Pop(data)
+		data.Set(printFlag.Name(), true)
+	}
+}
+
+// printMode returns whether the destination should be printed rather than
+// changed to.
+func printMode(data *command.Data) bool {
+	return data.Bool(printFlag.Name())
+}
+
+// changeDirectory returns the executable that changes to the provided
+// directory (the home directory if dir is empty), followed by the configured
+// listing, terminal integration, and project environment commands (and
+// records a visit to the directory). In print mode, the absolute directory is
+// printed instead and no executable is returned.
+func (d *Dot) changeDirectory(o command.Output, data *command.Data, dir string) ([]string, error) {
+	if dir != "" && physical(data) {
+		dir = resolvePath(data, dir)
+	}
+	if !printMode(data) {
+		sh := shellFromData(data)
+		// The terminal, listing, and environment commands only run if the cd
+		// succeeds.
+		then := d.terminalCommands(sh, data, dir)
+		if l := d.listingCommand(sh, data, dir); l != "" {
+			then = append(then, l)
+		}
+		env, err := d.envCommands(sh, data, dir)
+		if err != nil {
+			return nil, o.Err(err)
+		}
+		then = append(then, env...)
+		abs, err := absoluteDir(data, dir)
+		if err != nil {
+			return nil, o.Err(err)
+		}
+		if err := recordVisit(abs); err != nil {
+			// Visits only rank suggestions, so a broken cache doesn't stop the cd.
+			o.Stderrf("Not recording visit: %v\n", err)
+		}
+		return []string{andThen(sh, sh.Cd(dir), then...)}, nil
+	}
+
+	abs, err := absoluteDir(data, dir)
+	if err != nil {
+		return nil, o.Err(err)
+	}
+	if dest, ok := resolving(data); ok {
+		if dir == "" {
+			dest.Kind = DestinationHome
+		}
+		dest.Dir = abs
+	}
+	o.Stdoutln(abs)
+	return nil, nil
+}
+
+// andThen returns the command that runs each of the then commands (in order)
+// only if all of the commands before it succeed.
+func andThen(sh shell, first string, then ...string) string {
+	if len(then) == 0 {
+		return first
+	}
+	// Nest the rest so dialects that check the previous status (PowerShell)
+	// skip every remaining command.
+	return sh.AndThen(first, andThen(sh, then[0], then[1:]...))
+}
+
+// absoluteDir returns the absolute path of a directory passed to
+// changeDirectory.
+func absoluteDir(data *command.Data, dir string) (string, error) {
+	if dir == "" {
+		home, err := fsUserHomeDir(filesystem(data))
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %v", err)
+		}
+		dir = home
+	} else if !filepath.IsAbs(dir) {
+		dir = filepath.Join(commander.Getwd.Get(data), dir)
+	}
+	return filepath.Clean(dir), nil
+}
@@ -0,0 +1,95 @@
+package cd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestPrint(t *testing.T) {
+	cwd := filepath.FromSlash("/a/b/c")
+	history := &History{PrevDirs: []string{filepath.FromSlash("/prev")}}
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		args []string
+		want string
+	}{
+		{
+			name: "prints home directory",
+			d:    DotCLI(),
+			args: []string{"--print"},
+			want: filepath.FromSlash("/home/user"),
+		},
+		{
+			name: "prints path",
+			d:    DotCLI(),
+			args: []string{"--print", "/x/y"},
+			want: filepath.FromSlash("/x/y"),
+		},
+		{
+			name: "prints path with sub paths",
+			d:    DotCLI(),
+			args: []string{"--print", "/x", "y", "z"},
+			want: filepath.FromSlash("/x/y/z"),
+		},
+		{
+			name: "prints path when flag is last",
+			d:    DotCLI(),
+			args: []string{"/x/y", "--print"},
+			want: filepath.FromSlash("/x/y"),
+		},
+		{
+			name: "prints up directory",
+			d:    DotCLI(),
+			args: []string{"--print", "-u", "2"},
+			want: filepath.FromSlash("/a"),
+		},
+		{
+			name: "prints shortcut",
+			d:    shortcutDot(map[string][]string{"api": {"/work/api"}}),
+			args: []string{"--print", "api", "src"},
+			want: filepath.FromSlash("/work/api/src"),
+		},
+		{
+			name: "prints parent",
+			d:    DotCLI(),
+			args: []string{"--print", "parent", "a"},
+			want: filepath.FromSlash("/a"),
+		},
+		{
+			name: "prints previous directory",
+			d:    DotCLI(),
+			args: []string{"--print", "-"},
+			want: filepath.FromSlash("/prev"),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, cwd, nil)
+			test.d.fsys = &statFS{wd: cwd, stat: dirStat, host: "laptop", home: filepath.FromSlash("/home/user")}
+			c := cachetest.NewTestCacheWithData(t, map[string]interface{}{shellCacheKey: history})
+			cache.StubShellCache(t, c)
+
+			commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+				Node:          test.d.Node(),
+				Args:          test.args,
+				OS:            &commandtest.FakeOS{},
+				SkipDataCheck: true,
+				WantStdout:    test.want + "\n",
+			})
+
+			gotH := &History{}
+			if _, err := c.GetStruct(shellCacheKey, gotH); err != nil {
+				t.Fatalf("Failed to read history from cache: %v", err)
+			}
+			if diff := cmp.Diff(history, gotH); diff != "" {
+				t.Errorf("Execute(%v) changed history (-want, +got):\n%s", test.args, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package cd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	profileFlag = commander.Flag[string]("profile", 'p', "Shortcut profile to use instead of the host and user profiles")
+
+	profileShortcutArg = commander.Arg[string]("SHORTCUT", "Name of the shortcut", commander.MinLength[string, string](1))
+	profilePathArg     = commander.Arg[string]("PATH", "Directory the shortcut points to",
+		absTransformer(),
+		dirArgCompleter(),
+	)
+	profileSubPathArg = commander.ListArg[string]("SUB_PATH", "Subdirectories appended to the shortcut", 0, command.UnboundedList)
+)
+
+// activeProfiles returns the profiles whose shortcuts override the default
+// shortcuts, in order of precedence. If a profile was explicitly provided,
+// then only that profile is used; otherwise, the host profile is checked
+// followed by the user profile.
+func (d *Dot) activeProfiles(data *command.Data) []string {
+	if data.Has(profileFlag.Name()) {
+		return []string{data.String(profileFlag.Name())}
+	}
+	var r []string
+	if h, err := fsHostname(filesystem(data)); err == nil && h != "" {
+		r = append(r, h)
+	}
+	if u, ok := command.OSLookupEnv("USER"); ok && u != "" {
+		r = append(r, u)
+	}
+	return r
+}
+
+// profileShortcut returns the values for the shortcut and the profile that
+// supplied them (if any).
+func (d *Dot) profileShortcut(data *command.Data, shortcut string) ([]string, string, bool) {
+	for _, p := range d.activeProfiles(data) {
+		if v, ok := d.Profiles[p][shortcut]; ok {
+			return v, p, true
+		}
+	}
+	return nil, "", false
+}
+
+func (d *Dot) profileCompleter() commander.Completer[string] {
+	return commander.CompleterFromFunc(func(s string, data *command.Data) (*command.Completion, error) {
+		m := map[string]bool{}
+		for p := range d.Profiles {
+			m[p] = true
+		}
+		// Ignore the profile flag (which is being completed) so the host and
+		// user profiles are suggested.
+		pd := &command.Data{}
+		pd.Set(fsDataKey, filesystem(data))
+		for _, p := range d.activeProfiles(pd) {
+			m[p] = true
+		}
+		return &command.Completion{Suggestions: sortedKeys(m)}, nil
+	})
+}
+
+// profileProcessor runs before any other shortcut expansion. It consumes a
+// leading `--profile` flag (which must precede the shortcut so the profile is
+// known before the shortcut is expanded) and then expands the first argument
+// if it is a shortcut in one of the active profiles. The flag isn't supported
+// anywhere else (or with an `=` value), so those forms are rejected rather
+// than treated as paths.
+func (d *Dot) profileProcessor() command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		_, err := d.applyProfile(i, data, false)
+		return o.Err(err)
+	}, func(i *command.Input, data *command.Data) (*command.Completion, error) {
+		return d.applyProfile(i, data, true)
+	})
+}
+
+// isProfileFlag returns whether the argument is the profile flag.
+func isProfileFlag(a string) bool {
+	return a == "--"+profileFlag.Name() || a == "-"+string(profileFlag.ShortName())
+}
+
+// checkProfileFlag returns an error if the profile flag is provided in a form
+// that applyProfile doesn't support.
+func checkProfileFlag(i *command.Input) error {
+	// The shortcuts commands parse the flag themselves (see listNode).
+	if v, ok := i.Peek(); ok && v == shortcutsBranchName {
+		return nil
+	}
+	for j := 0; ; j++ {
+		a, ok := i.PeekAt(j)
+		if !ok || a == commander.FlagStop {
+			return nil
+		}
+		if f, v, ok := strings.Cut(a, "="); ok && isProfileFlag(f) {
+			return fmt.Errorf("flag %q doesn't support = (use %q)", profileFlag.Name(), f+" "+v)
+		}
+		if j > 0 && isProfileFlag(a) {
+			return fmt.Errorf("flag %q must be the first argument", profileFlag.Name())
+		}
+	}
+}
+
+func (d *Dot) applyProfile(i *command.Input, data *command.Data, complete bool) (*command.Completion, error) {
+	if !complete {
+		if err := checkProfileFlag(i); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := i.Peek(); ok && isProfileFlag(v) {
+		if complete && i.NumRemaining() == 2 {
+			i.Pop(data)
+			p, _ := i.Pop(data)
+			return commander.RunArgumentCompleter(d.profileCompleter(), p, data)
+		}
+		i.Pop(data)
+		p, ok := i.Pop(data)
+		if !ok {
+			return nil, fmt.Errorf("flag %q requires a value", profileFlag.Name())
+		}
+		data.Set(profileFlag.Name(), p)
+	}
+
+	// Don't expand the argument that is being completed.
+	if complete && i.NumRemaining() <= 1 {
+		return nil, nil
+	}
+
+	s, ok := i.Peek()
+	if !ok {
+		return nil, nil
+	}
+	if v, _, ok := d.profileShortcut(data, s); ok {
+		i.Pop(data)
+		i.PushFront(v...)
+		resolvedShortcut(data, DestinationShortcut, s)
+	}
+	return nil, nil
+}
+
+func (d *Dot) profileSetNode() command.Node {
+	profileArg := commander.Arg[string]("PROFILE", "Profile name (e.g. a hostname or username)", commander.MinLength[string, string](1), d.profileCompleter())
+	return commander.SerialNodes(
+		commander.Description("Set a shortcut value for a profile"),
+		profileArg,
+		profileShortcutArg,
+		profilePathArg,
+		profileSubPathArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			if d.Profiles == nil {
+				d.Profiles = map[string]map[string][]string{}
+			}
+			p := profileArg.Get(data)
+			if d.Profiles[p] == nil {
+				d.Profiles[p] = map[string][]string{}
+			}
+			d.Profiles[p][profileShortcutArg.Get(data)] = append([]string{profilePathArg.Get(data)}, profileSubPathArg.Get(data)...)
+			d.MarkChanged()
+			return nil
+		}},
+	)
+}
+
+func (d *Dot) profileDeleteNode() command.Node {
+	profileArg := commander.Arg[string]("PROFILE", "Profile name", d.profileCompleter())
+	return commander.SerialNodes(
+		commander.Description("Delete a shortcut value from a profile"),
+		profileArg,
+		profileShortcutArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			p, sc := profileArg.Get(data), profileShortcutArg.Get(data)
+			if _, ok := d.Profiles[p][sc]; !ok {
+				return o.Stderrf("Shortcut %q does not exist in profile %q\n", sc, p)
+			}
+			delete(d.Profiles[p], sc)
+			if len(d.Profiles[p]) == 0 {
+				delete(d.Profiles, p)
+			}
+			d.MarkChanged()
+			return nil
+		}},
+	)
+}
+
+// listNode replaces the default shortcut lister so that the profile that
+// supplied each shortcut value is displayed.
+func (d *Dot) listNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("List all shortcuts and the profile that supplied each value"),
+		commander.FlagProcessor(profileFlag),
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			names := map[string]bool{}
+			for k := range d.dirShortcuts() {
+				names[k] = true
+			}
+			for _, p := range d.activeProfiles(data) {
+				for k := range d.Profiles[p] {
+					names[k] = true
+				}
+			}
+
+			for _, k := range sortedKeys(names) {
+				if v, p, ok := d.profileShortcut(data, k); ok {
+					o.Stdoutf("%s: %s (profile: %s)\n", k, strings.Join(v, " "), p)
+				} else {
+					o.Stdoutf("%s: %s\n", k, strings.Join(d.dirShortcuts()[k], " "))
+				}
+			}
+			return nil
+		}},
+	)
+}
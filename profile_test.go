@@ -0,0 +1,266 @@
+package cd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// profileShortcuts are the (non-profile) shortcuts used by the profile tests.
+var profileShortcuts = map[string][]string{
+	"logs": {"/default/logs"},
+	"src":  {"/default/src"},
+}
+
+func TestProfiles(t *testing.T) {
+	profiles := map[string]map[string][]string{
+		"server": {"logs": {"/var/log/app"}},
+		"laptop": {"logs": {"/home/me/dev/app/logs"}, "tmp": {"/home/me/tmp"}},
+		"me":     {"logs": {"/home/me/logs"}, "src": {"/home/me/src", "mine"}},
+	}
+
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		want *Dot
+		env  map[string]string
+		etc  *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "uses host profile",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"logs"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/home/me/dev/app/logs")},
+				},
+			},
+		},
+		{
+			name: "uses user profile",
+			d:    &Dot{Profiles: profiles},
+			env:  map[string]string{"USER": "me"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"src"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/home/me/src/mine")},
+				},
+			},
+		},
+		{
+			name: "host profile takes precedence over user profile",
+			d:    &Dot{Profiles: profiles},
+			env:  map[string]string{"USER": "me"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"logs"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/home/me/dev/app/logs")},
+				},
+			},
+		},
+		{
+			name: "uses default shortcut if not in profile",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"src"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/default/src")},
+				},
+			},
+		},
+		{
+			name: "uses profile flag",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"--profile", "server", "logs"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/var/log/app")},
+				},
+			},
+		},
+		{
+			name: "profile flag only uses that profile",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-p", "server", "tmp"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepathAbs(t, "tmp"))},
+				},
+			},
+		},
+		{
+			name: "profile flag requires a value",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"-p"},
+				WantErr:    fmt.Errorf(`flag "profile" requires a value`),
+				WantStderr: "flag \"profile\" requires a value\n",
+			},
+		},
+		{
+			name: "uses profile flag with other flags",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"-p", "server", "logs", "--print"},
+				WantStdout: filepath.FromSlash("/var/log/app") + "\n",
+			},
+		},
+		{
+			name: "profile flag must be the first argument",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"-u", "1", "-p", "server", "logs"},
+				WantErr:    fmt.Errorf(`flag "profile" must be the first argument`),
+				WantStderr: "flag \"profile\" must be the first argument\n",
+			},
+		},
+		{
+			name: "profile flag can't follow the shortcut",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"logs", "--profile", "server"},
+				WantErr:    fmt.Errorf(`flag "profile" must be the first argument`),
+				WantStderr: "flag \"profile\" must be the first argument\n",
+			},
+		},
+		{
+			name: "profile flag doesn't support equals",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"--profile=server", "logs"},
+				WantErr:    fmt.Errorf(`flag "profile" doesn't support = (use "--profile server")`),
+				WantStderr: "flag \"profile\" doesn't support = (use \"--profile server\")\n",
+			},
+		},
+		{
+			name: "short profile flag doesn't support equals",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"-p=server", "logs"},
+				WantErr:    fmt.Errorf(`flag "profile" doesn't support = (use "-p server")`),
+				WantStderr: "flag \"profile\" doesn't support = (use \"-p server\")\n",
+			},
+		},
+		{
+			name: "profile flag after flag stop is an argument",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-p", "server", "logs", "--", "-p"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join("/var/log/app", "-p"))},
+				},
+			},
+		},
+		{
+			name: "lists shortcuts with profiles",
+			d:    &Dot{Profiles: profiles},
+			env:  map[string]string{"USER": "me"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "list"},
+				WantStdout: strings.Join([]string{
+					"logs: /home/me/dev/app/logs (profile: laptop)",
+					"src: /home/me/src mine (profile: me)",
+					"tmp: /home/me/tmp (profile: laptop)",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "lists shortcuts with provided profile",
+			d:    &Dot{Profiles: profiles},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "l", "-p", "server"},
+				WantStdout: strings.Join([]string{
+					"logs: /var/log/app (profile: server)",
+					"src: /default/src",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "sets profile shortcut",
+			d:    &Dot{},
+			want: &Dot{Profiles: map[string]map[string][]string{
+				"server": {"logs": {"/var/log/app", "current"}},
+			}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "profile", "set", "server", "logs", "/var/log/app", "current"},
+			},
+		},
+		{
+			name: "deletes profile shortcut",
+			d: &Dot{Profiles: map[string]map[string][]string{
+				"server": {"logs": {"/var/log/app"}, "tmp": {"/tmp"}},
+			}},
+			want: &Dot{Profiles: map[string]map[string][]string{
+				"server": {"tmp": {"/tmp"}},
+			}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "profile", "delete", "server", "logs"},
+			},
+		},
+		{
+			name: "deleting last profile shortcut removes profile",
+			d: &Dot{Profiles: map[string]map[string][]string{
+				"server": {"logs": {"/var/log/app"}},
+			}},
+			want: &Dot{Profiles: map[string]map[string][]string{}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "profile", "d", "server", "logs"},
+			},
+		},
+		{
+			name: "delete fails for missing shortcut",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"shortcuts", "profile", "delete", "server", "logs"},
+				WantErr:    fmt.Errorf(`Shortcut "logs" does not exist in profile "server"`),
+				WantStderr: "Shortcut \"logs\" does not exist in profile \"server\"\n",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.d.Shortcuts = map[string]map[string][]string{dirShortcutName: profileShortcuts}
+			if test.want != nil {
+				test.want.Shortcuts = map[string]map[string][]string{dirShortcutName: profileShortcuts}
+			}
+			test.d.fsys = &statFS{wd: commandtest.FilepathAbs(t), stat: dirStat, host: "laptop"}
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			test.etc.Node = test.d.Node()
+			test.etc.Env = test.env
+			if test.etc.Env == nil {
+				test.etc.Env = map[string]string{}
+			}
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+		})
+	}
+}
+
+func TestProfileAutocomplete(t *testing.T) {
+	d := &Dot{Profiles: map[string]map[string][]string{
+		"server": {"logs": {"/var/log/app"}},
+	}}
+	d.fsys = &statFS{host: "laptop"}
+	commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+		Node:          d.Node(),
+		Args:          "cmd --profile ",
+		Env:           map[string]string{"USER": "me"},
+		SkipDataCheck: true,
+		OS:            &commandtest.FakeOS{},
+		Want: &command.Autocompletion{
+			Suggestions: []string{"laptop", "me", "server"},
+		},
+	})
+}
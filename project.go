@@ -0,0 +1,129 @@
+package cd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	// projectShortcutsFile is the name of the file (checked in at the root of
+	// a project) that contains shortcuts relative to that root.
+	projectShortcutsFile = ".dshortcuts.json"
+)
+
+// projectShortcuts are shortcuts that are defined by a project (rather than
+// by the user) and are only available when inside of that project.
+type projectShortcuts struct {
+	// Root is the directory containing the project shortcuts file.
+	Root string
+	// Shortcuts is a map from shortcut name to shortcut values. The first value
+	// is relative to `Root` (unless it is an absolute path).
+	Shortcuts map[string][]string
+}
+
+// findProjectShortcuts walks up from the provided directory and returns the
+// first project shortcuts it finds (or nil if none exist).
+func findProjectShortcuts(fsys FS, dir string) (*projectShortcuts, error) {
+	for prev := ""; dir != prev; prev, dir = dir, filepath.Dir(dir) {
+		f := filepath.Join(dir, projectShortcutsFile)
+		b, err := fsys.ReadFile(f)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read project shortcuts file: %v", err)
+		}
+
+		ps := &projectShortcuts{Root: dir}
+		if err := json.Unmarshal(b, &ps.Shortcuts); err != nil {
+			return nil, fmt.Errorf("failed to parse project shortcuts file (%s): %v", f, err)
+		}
+		return ps, nil
+	}
+	return nil, nil
+}
+
+// get returns the expanded (absolute) values for the provided shortcut.
+func (ps *projectShortcuts) get(name string) ([]string, bool) {
+	if ps == nil {
+		return nil, false
+	}
+	v, ok := ps.Shortcuts[name]
+	if !ok || len(v) == 0 {
+		return nil, false
+	}
+	r := append([]string{}, v...)
+	if !filepath.IsAbs(r[0]) {
+		r[0] = filepath.Join(ps.Root, r[0])
+	}
+	return r, true
+}
+
+// projectShortcutTransformer expands project shortcuts. User shortcuts are
+// expanded before this runs (by the `commander.ShortcutNode`), so user
+// entries always take precedence.
+func (d *Dot) projectShortcutTransformer() command.Processor {
+	it := &command.InputTransformer{F: func(o command.Output, data *command.Data, s string) ([]string, error) {
+		v, ok, err := d.projectShortcut(filesystem(data), commander.Getwd.Get(data), s)
+		if err != nil {
+			// A broken project file shouldn't break changing directories.
+			o.Stderrf("Ignoring project shortcuts: %v\n", err)
+			return []string{s}, nil
+		}
+		if !ok {
+			return []string{s}, nil
+		}
+		resolvedShortcut(data, DestinationProjectShortcut, s)
+		return v, nil
+	}}
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		return o.Err(it.Transform(i, o, data, false))
+	}, it.Complete)
+}
+
+// projectShortcut returns the values of the project shortcut (for the project
+// that contains wd) if it isn't overridden by a user shortcut.
+func (d *Dot) projectShortcut(fsys FS, wd, s string) ([]string, bool, error) {
+	if _, ok := d.dirShortcuts()[s]; ok {
+		return nil, false, nil
+	}
+	ps, err := findProjectShortcuts(fsys, wd)
+	if err != nil {
+		return nil, false, err
+	}
+	v, ok := ps.get(s)
+	return v, ok, nil
+}
+
+func (d *Dot) projectShortcutsNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("List the shortcuts provided by the current project"),
+		d.getwd(),
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			ps, err := findProjectShortcuts(d.filesystem(), commander.Getwd.Get(data))
+			if err != nil {
+				return o.Err(err)
+			}
+			if ps == nil {
+				return o.Stderrf("No %s file found in the current directory or any parent directory\n", projectShortcutsFile)
+			}
+
+			for _, k := range sortedKeys(ps.Shortcuts) {
+				v, _ := ps.get(k)
+				if _, ok := d.dirShortcuts()[k]; ok {
+					o.Stdoutf("%s: %s (overridden by user shortcut)\n", k, strings.Join(v, " "))
+				} else {
+					o.Stdoutf("%s: %s\n", k, strings.Join(v, " "))
+				}
+			}
+			return nil
+		}},
+	)
+}
@@ -0,0 +1,149 @@
+package cd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestProjectShortcuts(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "services", "api"), 0755); err != nil {
+		t.Fatalf("Failed to create project directories: %v", err)
+	}
+	writeProjectFile := func(t *testing.T, contents string) {
+		if err := os.WriteFile(filepath.Join(root, projectShortcutsFile), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write project shortcuts file: %v", err)
+		}
+		t.Cleanup(func() { os.Remove(filepath.Join(root, projectShortcutsFile)) })
+	}
+
+	for _, test := range []struct {
+		name     string
+		d        *Dot
+		contents string
+		cwd      string
+		etc      *commandtest.ExecuteTestCase
+	}{
+		{
+			name:     "expands project shortcut relative to project root",
+			d:        DotCLI(),
+			contents: `{"api": ["services/api"], "abs": ["/some/where"]}`,
+			cwd:      filepath.Join(root, "services"),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"api"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(root, "services", "api"))},
+				},
+			},
+		},
+		{
+			name:     "expands project shortcut with sub paths",
+			d:        DotCLI(),
+			contents: `{"svc": ["services", "api"]}`,
+			cwd:      root,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"svc"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(root, "services", "api"))},
+				},
+			},
+		},
+		{
+			name:     "user shortcuts take precedence",
+			d:        shortcutDot(map[string][]string{"api": {"/user/api"}}),
+			contents: `{"api": ["services/api"]}`,
+			cwd:      root,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"api"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.FromSlash("/user/api"))},
+				},
+			},
+		},
+		{
+			name:     "ignores project shortcuts outside of project",
+			d:        DotCLI(),
+			contents: `{"api": ["services/api"]}`,
+			cwd:      filepath.Dir(root),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"api"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(filepath.Dir(root), "api"))},
+				},
+			},
+		},
+		{
+			name:     "ignores invalid project file",
+			d:        DotCLI(),
+			contents: `{"api": "services/api"}`,
+			cwd:      filepath.Join(root, "services"),
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"api"},
+				WantStderr: fmt.Sprintf("Ignoring project shortcuts: failed to parse project shortcuts file (%s): json: cannot unmarshal string into Go struct field .api of type []string\n", filepath.Join(root, projectShortcutsFile)),
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(root, "services", "api"))},
+				},
+			},
+		},
+		{
+			name:     "goes up with invalid project file",
+			d:        DotCLI(),
+			contents: `not json`,
+			cwd:      filepath.Join(root, "services"),
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{".."},
+				WantStderr: fmt.Sprintf("Ignoring project shortcuts: failed to parse project shortcuts file (%s): invalid character 'o' in literal null (expecting 'u')\n", filepath.Join(root, projectShortcutsFile)),
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(root)},
+				},
+			},
+		},
+		{
+			name:     "lists project shortcuts and flags collisions",
+			d:        shortcutDot(map[string][]string{"api": {"/user/api"}}),
+			contents: `{"api": ["services/api"], "svc": ["services", "api"]}`,
+			cwd:      filepath.Join(root, "services"),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"shortcuts", "project"},
+				WantStdout: strings.Join([]string{
+					fmt.Sprintf("api: %s (overridden by user shortcut)", filepath.Join(root, "services", "api")),
+					fmt.Sprintf("svc: %s api", filepath.Join(root, "services")),
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "listing fails if no project",
+			d:    DotCLI(),
+			cwd:  root,
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"shortcuts", "project"},
+				WantErr:    fmt.Errorf("No .dshortcuts.json file found in the current directory or any parent directory"),
+				WantStderr: "No .dshortcuts.json file found in the current directory or any parent directory\n",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.contents != "" {
+				writeProjectFile(t, test.contents)
+			}
+			commandtest.StubGetwd(t, test.cwd, nil)
+			test.d.fsys = &statFS{wd: test.cwd, stat: dirStat}
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			test.etc.Node = test.d.Node()
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+		})
+	}
+}
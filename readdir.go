@@ -0,0 +1,422 @@
+package cd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	listingCacheKeyPrefix = "leep-cd-listing-"
+	// listingIndexKey is the cache key of the directories that have cached
+	// listings.
+	listingIndexKey = "leep-cd-listings"
+)
+
+var (
+	// readDirBatch is the number of entries read at a time (so the time budget
+	// can be checked while reading huge directories). Directories with more
+	// entries than this have their listings cached.
+	readDirBatch = 1024
+	// listingCache returns the persistent cache that holds the listings of
+	// large directories.
+	listingCache = func() (*cache.Cache, error) { return envCache() }
+	// readDirBudget is how long a directory is read for before completing with
+	// the entries read so far.
+	readDirBudget = 200 * time.Millisecond
+	// maxReadEntries is the maximum number of entries read from a directory.
+	maxReadEntries = 200_000
+	// maxDirSuggestions is the maximum number of suggested directories.
+	maxDirSuggestions = 1000
+	// maxCachedListings is the maximum number of cached listings. The oldest
+	// listings are removed when there are more.
+	maxCachedListings = 50
+)
+
+// DirListing is a cached listing of the subdirectories of a directory.
+type DirListing struct {
+	Dir string
+	// ModTime is the directory's modification time (in Unix nanoseconds) when it
+	// was listed. A directory's modification time changes whenever an entry is
+	// added, removed, or renamed, which invalidates the listing.
+	ModTime int64
+	Dirs    []string
+}
+
+// ListingIndex is the list of directories with cached listings (in the order
+// they were cached).
+type ListingIndex struct {
+	Dirs []string
+}
+
+func listingCacheKey(dir string) string {
+	h := sha256.Sum256([]byte(dir))
+	return listingCacheKeyPrefix + hex.EncodeToString(h[:8])
+}
+
+// readDirs returns the names of the subdirectories (and symbolic links) in the
+// directory that start with the prefix (ignoring case). The directory is read
+// in batches until readDirBudget or maxReadEntries is exceeded (in which case
+// the names are truncated), and complete listings of large directories (more
+// than one batch) are cached until the directory changes.
+func readDirs(fsys FS, dir, prefix string) ([]string, bool, error) {
+	names, truncated, err := listDirs(fsys, dir)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read dir: %v", err)
+	}
+
+	lp := strings.ToLower(prefix)
+	var r []string
+	for _, n := range names {
+		if strings.HasPrefix(strings.ToLower(n), lp) {
+			r = append(r, n)
+		}
+	}
+	return r, truncated, nil
+}
+
+// listDirs returns the sorted names of the subdirectories in the directory
+// and whether the directory was only partially read.
+func listDirs(fsys FS, dir string) ([]string, bool, error) {
+	f, err := openDir(fsys, dir)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	deadline := time.Now().Add(readDirBudget)
+	var names []string
+	var modTime int64
+	for read := 0; ; {
+		es, err := f.ReadDir(readDirBatch)
+		for _, e := range es {
+			if e.IsDir() || e.Type()&fs.ModeSymlink != 0 {
+				names = append(names, e.Name())
+			}
+		}
+		read += len(es)
+		if err == io.EOF || (err == nil && len(es) < readDirBatch) {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		if read == len(es) {
+			// The directory is large, so use the cached listing if the directory
+			// hasn't changed.
+			fi, err := f.Stat()
+			if err != nil {
+				return nil, false, err
+			}
+			modTime = fi.ModTime().UnixNano()
+			if cached, ok := cachedListing(dir, modTime); ok {
+				return cached, false, nil
+			}
+		}
+		if read >= maxReadEntries || time.Now().After(deadline) {
+			// Complete with the entries read so far (and don't cache them).
+			sort.Strings(names)
+			return names, true, nil
+		}
+	}
+	sort.Strings(names)
+
+	if modTime != 0 {
+		storeListing(&DirListing{dir, modTime, names})
+	}
+	return names, false, nil
+}
+
+// cachedListing returns the cached subdirectories of the directory if the
+// directory hasn't changed since it was cached. Cache errors are ignored
+// (the directory is just read again).
+func cachedListing(dir string, modTime int64) ([]string, bool) {
+	c, err := listingCache()
+	if err != nil {
+		return nil, false
+	}
+	l := &DirListing{}
+	if ok, err := c.GetStruct(listingCacheKey(dir), l); err != nil || !ok || l.Dir != dir || l.ModTime != modTime {
+		return nil, false
+	}
+	return l.Dirs, true
+}
+
+// storeListing caches the listing and removes the oldest listings if there
+// are more than maxCachedListings. Cache errors are ignored.
+func storeListing(l *DirListing) {
+	c, err := listingCache()
+	if err != nil {
+		return
+	}
+	li := &ListingIndex{}
+	if _, err := c.GetStruct(listingIndexKey, li); err != nil {
+		return
+	}
+	if err := c.PutStruct(listingCacheKey(l.Dir), l); err != nil {
+		return
+	}
+
+	dirs := append(slices.DeleteFunc(li.Dirs, func(dir string) bool { return dir == l.Dir }), l.Dir)
+	for ; len(dirs) > maxCachedListings; dirs = dirs[1:] {
+		c.Delete(listingCacheKey(dirs[0]))
+	}
+	c.PutStruct(listingIndexKey, &ListingIndex{dirs})
+}
+
+// dirCompletion completes directories like `commander.FileCompleter` (with
+// IgnoreFiles set), but reads directories with readDirs.
+type dirCompletion struct {
+	// Directory is the directory that relative paths are completed in.
+	Directory string
+	// ExcludePwd is whether the directory that contains the current working
+	// directory is excluded.
+	ExcludePwd bool
+	// IgnoreFunc returns whether a suggestion should be ignored.
+	IgnoreFunc func(fullPath, basename string, data *command.Data) bool
+}
+
+func (dc *dirCompletion) Complete(typed string, data *command.Data) (*command.Completion, error) {
+	laDir, laFile := filepath.Split(filepath.FromSlash(typed))
+	if data.Complexecute && laFile == "" {
+		// Complexecute to the full directory.
+		return &command.Completion{Suggestions: []string{typed}}, nil
+	}
+
+	suggestions, truncated, err := dc.suggestions(typed, data)
+	if err != nil || len(suggestions) == 0 {
+		return nil, err
+	}
+
+	c := &command.Completion{
+		Suggestions:         suggestions,
+		IgnoreFilter:        true,
+		CaseInsensitiveSort: true,
+	}
+	if len(suggestions) == 1 && !truncated {
+		// Complete the full path (without a space so the user can continue to
+		// sub directories).
+		c.Suggestions[0] = laDir + c.Suggestions[0]
+		c.SpacelessCompletion = !data.Complexecute
+		return c, nil
+	}
+	if data.Complexecute {
+		return c, nil
+	}
+	if truncated {
+		// Directories that weren't read may also match, so only list the
+		// suggestions.
+		c.DontComplete = true
+		return c, nil
+	}
+
+	autofill, ok := autofillLetters(laFile, suggestions)
+	if !ok {
+		// Don't let the shell complete the common prefix (which would drop the
+		// typed directory).
+		c.DontComplete = true
+		return c, nil
+	}
+	c.Suggestions = []string{laDir + autofill}
+	c.SpacelessCompletion = true
+	return c, nil
+}
+
+// suggestions returns the names (with a trailing separator) of the
+// directories that match what was typed, and whether there may be more
+// matches (because the directory was only partially read or there are more
+// than maxDirSuggestions).
+func (dc *dirCompletion) suggestions(typed string, data *command.Data) ([]string, bool, error) {
+	laDir, laFile := filepath.Split(filepath.FromSlash(typed))
+	fsys := filesystem(data)
+	dir := laDir
+	if !isAbs(laDir) {
+		var err error
+		if dir, err = absPath(fsys, filepath.Join(dc.Directory, laDir)); err != nil {
+			return nil, false, fmt.Errorf("failed to get absolute filepath: %v", err)
+		}
+	}
+
+	names, truncated, err := readDirs(fsys, dir, laFile)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ignoreDir string
+	if dc.ExcludePwd {
+		var pwd string
+		if data.Has(commander.GetwdKey) {
+			pwd = commander.Getwd.Get(data)
+		} else if pwd, err = fsys.Getwd(); err != nil {
+			return nil, false, fmt.Errorf("failed to get current working directory: %v", err)
+		}
+		rel, err := filepath.Rel(dir, pwd)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get relative directory: %v", err)
+		}
+		if rel[0] != '.' {
+			ignoreDir = strings.Split(rel, string(os.PathSeparator))[0]
+		}
+	}
+
+	var suggestions []string
+	for i, n := range names {
+		if n == ignoreDir {
+			continue
+		}
+		s := n + string(os.PathSeparator)
+		if dc.IgnoreFunc != nil && dc.IgnoreFunc(laDir+s, s, data) {
+			continue
+		}
+		if suggestions = append(suggestions, s); len(suggestions) >= maxDirSuggestions {
+			return suggestions, truncated || i < len(names)-1, nil
+		}
+	}
+	return suggestions, truncated, nil
+}
+
+// dirArgCompleter completes a directory argument in the configured
+// filesystem.
+func dirArgCompleter() commander.Completer[string] {
+	return commander.CompleterFromFunc(func(s string, data *command.Data) (*command.Completion, error) {
+		return (&dirCompletion{}).Complete(s, data)
+	})
+}
+
+// dirListCompleter completes the last directory of a list argument in the
+// configured filesystem (without suggesting directories that were already
+// provided).
+func dirListCompleter() commander.Completer[[]string] {
+	return commander.CompleterFromFunc(func(sl []string, data *command.Data) (*command.Completion, error) {
+		if len(sl) == 0 {
+			sl = []string{""}
+		}
+		prev := map[string]bool{}
+		for _, s := range sl[:len(sl)-1] {
+			prev[filepath.Clean(s)] = true
+		}
+		dc := &dirCompletion{IgnoreFunc: func(fullPath, _ string, _ *command.Data) bool {
+			return prev[filepath.Clean(fullPath)]
+		}}
+		return dc.Complete(sl[len(sl)-1], data)
+	})
+}
+
+// fileArgCompleter completes a file argument in the configured filesystem.
+func fileArgCompleter() commander.Completer[string] {
+	return commander.CompleterFromFunc(func(s string, data *command.Data) (*command.Completion, error) {
+		return fileCompletion(filesystem(data), "", s)
+	})
+}
+
+// fileCompletion completes files and directories (relative to dir) like
+// `commander.FileCompleter`, but reads directories in the provided filesystem.
+func fileCompletion(fsys FS, dir, typed string) (*command.Completion, error) {
+	laDir, laFile := filepath.Split(filepath.FromSlash(typed))
+	full := laDir
+	if !isAbs(laDir) {
+		var err error
+		if full, err = absPath(fsys, filepath.Join(dir, laDir)); err != nil {
+			return nil, fmt.Errorf("failed to get absolute filepath: %v", err)
+		}
+	}
+	es, err := fsys.ReadDir(full)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dir: %v", err)
+	}
+
+	lf := strings.ToLower(laFile)
+	var suggestions []string
+	onlyDir := true
+	for _, e := range es {
+		if !strings.HasPrefix(strings.ToLower(e.Name()), lf) {
+			continue
+		}
+		if e.IsDir() || e.Type()&fs.ModeSymlink != 0 {
+			suggestions = append(suggestions, e.Name()+string(os.PathSeparator))
+		} else {
+			onlyDir = false
+			suggestions = append(suggestions, e.Name())
+		}
+	}
+	if len(suggestions) == 0 {
+		return nil, nil
+	}
+	c := &command.Completion{Suggestions: suggestions, IgnoreFilter: true}
+	if len(suggestions) == 1 {
+		c.Suggestions[0] = laDir + c.Suggestions[0]
+		// Continue to the directory's files (rather than the next argument).
+		c.SpacelessCompletion = onlyDir
+		return c, nil
+	}
+
+	autofill, ok := autofillLetters(laFile, suggestions)
+	if !ok {
+		c.DontComplete = true
+		return c, nil
+	}
+	c.Suggestions = []string{laDir + autofill}
+	c.SpacelessCompletion = true
+	return c, nil
+}
+
+// autofillLetters returns the common prefix of the suggestions (ignoring
+// case) if it is longer than what has been typed.
+func autofillLetters(laFile string, suggestions []string) (string, bool) {
+	n := len(laFile)
+	for proceed := true; proceed; n++ {
+		var next rune
+		for i, s := range suggestions {
+			if len(s) <= n {
+				if s != laFile {
+					return s, true
+				}
+				proceed = false
+				break
+			}
+			c := unicode.ToLower(rune(s[n]))
+			if i == 0 {
+				next = c
+				continue
+			}
+			if c != next {
+				proceed = false
+				break
+			}
+		}
+	}
+
+	upTo := n - 1
+	if upTo <= len(laFile) {
+		return "", false
+	}
+	// Use the casing of a suggestion that matches what was typed.
+	s := suggestions[0]
+	for _, sg := range suggestions {
+		if strings.HasPrefix(sg, laFile) {
+			s = sg
+			break
+		}
+	}
+	return s[:upTo], true
+}
+
+// isAbs returns whether the path is absolute (including rooted paths on
+// Windows shells like mingw).
+func isAbs(p string) bool {
+	return filepath.IsAbs(p) || (len(p) > 0 && (p[0] == '/' || p[0] == '\\'))
+}
@@ -0,0 +1,251 @@
+package cd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestListDirs(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		files map[string]string
+		// batch is the readDirBatch value.
+		batch      int
+		budget     time.Duration
+		maxEntries int
+		// cached is a listing stored in the cache (with the directory's current
+		// modification time) before listing.
+		cached []string
+		// stale is whether the cached listing has an old modification time.
+		stale         bool
+		want          []string
+		wantTruncated bool
+		wantCached    []string
+	}{
+		{
+			name: "lists directories",
+			files: map[string]string{
+				"b/":    "",
+				"a/":    "",
+				"c.txt": "",
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "doesn't cache small directories",
+			files: map[string]string{
+				"a/": "",
+				"b/": "",
+			},
+			batch: 3,
+			want:  []string{"a", "b"},
+		},
+		{
+			name: "caches large directories",
+			files: map[string]string{
+				"a/":    "",
+				"b/":    "",
+				"c/":    "",
+				"d.txt": "",
+			},
+			batch:      2,
+			want:       []string{"a", "b", "c"},
+			wantCached: []string{"a", "b", "c"},
+		},
+		{
+			name: "uses cached listing",
+			files: map[string]string{
+				"a/": "",
+				"b/": "",
+				"c/": "",
+			},
+			batch:      2,
+			cached:     []string{"x", "y"},
+			want:       []string{"x", "y"},
+			wantCached: []string{"x", "y"},
+		},
+		{
+			name: "ignores stale cached listing",
+			files: map[string]string{
+				"a/": "",
+				"b/": "",
+				"c/": "",
+			},
+			batch:      2,
+			cached:     []string{"x", "y"},
+			stale:      true,
+			want:       []string{"a", "b", "c"},
+			wantCached: []string{"a", "b", "c"},
+		},
+		{
+			name: "stops at time budget",
+			files: map[string]string{
+				"a/": "",
+				"b/": "",
+				"c/": "",
+			},
+			batch:         2,
+			budget:        -time.Second,
+			want:          []string{"a", "b"},
+			wantTruncated: true,
+		},
+		{
+			name: "stops at max entries",
+			files: map[string]string{
+				"a/": "",
+				"b/": "",
+				"c/": "",
+				"d/": "",
+				"e/": "",
+			},
+			batch:         2,
+			maxEntries:    4,
+			want:          []string{"a", "b", "c", "d"},
+			wantTruncated: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := listingDir(t, test.files)
+			c := cachetest.NewTestCache(t)
+			stubListingCache(t, c)
+			if test.batch != 0 {
+				commandtest.StubValue(t, &readDirBatch, test.batch)
+			}
+			if test.budget != 0 {
+				commandtest.StubValue(t, &readDirBudget, test.budget)
+			}
+			if test.maxEntries != 0 {
+				commandtest.StubValue(t, &maxReadEntries, test.maxEntries)
+			}
+			if test.cached != nil {
+				fi, err := os.Stat(dir)
+				if err != nil {
+					t.Fatalf("failed to stat directory: %v", err)
+				}
+				modTime := fi.ModTime().UnixNano()
+				if test.stale {
+					modTime--
+				}
+				if err := c.PutStruct(listingCacheKey(dir), &DirListing{dir, modTime, test.cached}); err != nil {
+					t.Fatalf("failed to store listing: %v", err)
+				}
+			}
+
+			got, truncated, err := listDirs(osFS{}, dir)
+			if err != nil {
+				t.Fatalf("listDirs() returned error: %v", err)
+			}
+			if truncated != test.wantTruncated {
+				t.Errorf("listDirs() returned truncated %v; want %v", truncated, test.wantTruncated)
+			}
+			// Entries are read in directory order, so partial reads can return
+			// any of the directories.
+			if test.budget < 0 || test.maxEntries != 0 {
+				if len(got) != len(test.want) {
+					t.Errorf("listDirs() returned %v; want %d directories", got, len(test.want))
+				}
+			} else if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("listDirs() returned incorrect directories (-want, +got):\n%s", diff)
+			}
+
+			l := &DirListing{}
+			if _, err := c.GetStruct(listingCacheKey(dir), l); err != nil {
+				t.Fatalf("failed to read listing: %v", err)
+			}
+			if diff := cmp.Diff(test.wantCached, l.Dirs); diff != "" {
+				t.Errorf("listDirs() cached incorrect directories (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadDirs(t *testing.T) {
+	dir := listingDir(t, map[string]string{
+		"Alpha/": "",
+		"alps/":  "",
+		"beta/":  "",
+	})
+	stubListingCache(t, cachetest.NewTestCache(t))
+
+	got, _, err := readDirs(osFS{}, dir, "al")
+	if err != nil {
+		t.Fatalf("readDirs() returned error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"Alpha", "alps"}, got); diff != "" {
+		t.Errorf("readDirs() returned incorrect directories (-want, +got):\n%s", diff)
+	}
+
+	if _, _, err := readDirs(osFS{}, filepath.Join(dir, "missing"), ""); err == nil {
+		t.Errorf("readDirs() returned nil error for missing directory")
+	}
+}
+
+func TestPruneListings(t *testing.T) {
+	root := listingDir(t, map[string]string{
+		"a/x/": "",
+		"a/y/": "",
+		"b/x/": "",
+		"b/y/": "",
+		"c/x/": "",
+		"c/y/": "",
+	})
+	a, b, c := filepath.Join(root, "a"), filepath.Join(root, "b"), filepath.Join(root, "c")
+	commandtest.StubValue(t, &readDirBatch, 1)
+	commandtest.StubValue(t, &maxCachedListings, 2)
+	lc := cachetest.NewTestCache(t)
+	stubListingCache(t, lc)
+
+	for _, dir := range []string{a, b, c, a} {
+		if _, _, err := listDirs(osFS{}, dir); err != nil {
+			t.Fatalf("listDirs() returned error: %v", err)
+		}
+	}
+
+	li := &ListingIndex{}
+	if _, err := lc.GetStruct(listingIndexKey, li); err != nil {
+		t.Fatalf("failed to read listing index: %v", err)
+	}
+	// a is listed again after it is removed, so b is the oldest listing.
+	if diff := cmp.Diff([]string{c, a}, li.Dirs); diff != "" {
+		t.Errorf("listDirs() stored incorrect listing index (-want, +got):\n%s", diff)
+	}
+	for dir, want := range map[string]bool{a: true, b: false, c: true} {
+		if _, ok, err := lc.Get(listingCacheKey(dir)); err != nil || ok != want {
+			t.Errorf("listing of %s is cached: %v (%v); want %v", dir, ok, err, want)
+		}
+	}
+}
+
+func TestTruncatedCompletion(t *testing.T) {
+	dir := listingDir(t, map[string]string{
+		"alpha/": "",
+		"beta/":  "",
+		"gamma/": "",
+	})
+	stubListingCache(t, cachetest.NewTestCache(t))
+	commandtest.StubValue(t, &readDirBatch, 1)
+	commandtest.StubValue(t, &maxReadEntries, 1)
+
+	// Only one directory is read, but it isn't completed since other
+	// directories may match.
+	c, err := (&dirCompletion{Directory: dir}).Complete("", &command.Data{})
+	if err != nil {
+		t.Fatalf("Complete() returned error: %v", err)
+	}
+	if len(c.Suggestions) != 1 || !c.DontComplete || c.SpacelessCompletion {
+		t.Errorf("Complete() returned %+v; want one suggestion with DontComplete", c)
+	}
+}
+
+func stubListingCache(t *testing.T, c *cache.Cache) {
+	t.Helper()
+	commandtest.StubValue(t, &listingCache, func() (*cache.Cache, error) { return c, nil })
+}
@@ -0,0 +1,233 @@
+package cd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+	"github.com/leep-frog/command/sourcerer"
+)
+
+// DestinationKind is how a destination was resolved.
+type DestinationKind string
+
+const (
+	// DestinationHome is the home directory (no path was provided).
+	DestinationHome DestinationKind = "home"
+	// DestinationPath is a path (relative to the working directory, or
+	// absolute).
+	DestinationPath DestinationKind = "path"
+	// DestinationSearchRoot is a path found in one of the search roots.
+	DestinationSearchRoot DestinationKind = "search-root"
+	// DestinationShortcut is a user (or profile) shortcut.
+	DestinationShortcut DestinationKind = "shortcut"
+	// DestinationProjectShortcut is a shortcut defined by the current project.
+	DestinationProjectShortcut DestinationKind = "project-shortcut"
+	// DestinationParent is a parent directory (`d parent`).
+	DestinationParent DestinationKind = "parent"
+	// DestinationPrevious is the previous directory (`d -`).
+	DestinationPrevious DestinationKind = "previous"
+	// DestinationSource is a candidate from one of the sources (see
+	// WithSources).
+	DestinationSource DestinationKind = "source"
+)
+
+// Destination is a resolved `d` destination.
+type Destination struct {
+	// Dir is the absolute destination directory.
+	Dir string
+	// Kind is how the destination was resolved.
+	Kind DestinationKind
+	// Shortcut is the name of the expanded shortcut (for shortcut
+	// destinations).
+	Shortcut string
+	// SubPaths are the sub paths appended to the destination.
+	SubPaths []string
+}
+
+// Resolver resolves `d` arguments to a destination without a shell, so other
+// Go tools can use the same navigation semantics. Arguments are resolved by
+// running the `d` command in print mode (like `d --print`), so flags, paths,
+// sub paths, shortcuts, search roots, sources, `parent`, and `-` (and
+// partially typed arguments) are resolved exactly like the CLI resolves them.
+type Resolver struct {
+	// Dot provides the shortcuts, profiles, search roots, and path mode.
+	Dot *Dot
+	// History is the history used to resolve `-` (the home directory is used
+	// if there is no previous directory).
+	History *History
+}
+
+// NewResolver returns a resolver for the provided configuration.
+func NewResolver(d *Dot) *Resolver {
+	return &Resolver{Dot: d}
+}
+
+// resolvingOS is the operating system used when a Resolver runs the `d`
+// command. The processors record how the destination was resolved in it.
+type resolvingOS struct {
+	command.OS
+	// history is the history used instead of the shell cache.
+	history *History
+	dest    *Destination
+}
+
+// resolving returns the destination to record how the arguments were resolved
+// in (or false if the command isn't being run by a Resolver).
+func resolving(data *command.Data) (*Destination, bool) {
+	ros, ok := data.OS.(*resolvingOS)
+	if !ok {
+		return nil, false
+	}
+	return ros.dest, true
+}
+
+// resolvedAs records how the destination was resolved.
+func resolvedAs(data *command.Data, kind DestinationKind) {
+	if dest, ok := resolving(data); ok {
+		dest.Kind = kind
+	}
+}
+
+// resolvedShortcut records the shortcut that the destination was expanded
+// from.
+func resolvedShortcut(data *command.Data, kind DestinationKind, name string) {
+	if dest, ok := resolving(data); ok {
+		dest.Kind, dest.Shortcut = kind, name
+	}
+}
+
+// shortcutRecorder records the user shortcut (if any) that is about to be
+// expanded by the shortcut node.
+func (d *Dot) shortcutRecorder() command.Processor {
+	return commander.SuperSimpleProcessor(func(i *command.Input, data *command.Data) error {
+		if s, ok := i.Peek(); ok {
+			if _, ok := d.dirShortcuts()[s]; ok {
+				resolvedShortcut(data, DestinationShortcut, s)
+			}
+		}
+		return nil
+	})
+}
+
+// Resolve returns the destination that `d` would change to when run with the
+// provided arguments in the working directory wd. The filesystem lookups stop
+// (and ctx's error is returned) once ctx is done.
+func (r *Resolver) Resolve(ctx context.Context, wd string, args []string) (*Destination, error) {
+	var d Dot
+	if r.Dot != nil {
+		d = *r.Dot
+	}
+	// Only the branches that change directories are run.
+	if len(args) > 0 {
+		if _, ok := d.commandBranches()[args[0]]; ok || args[0] == shortcutsBranchName {
+			return nil, fmt.Errorf("%q isn't a destination", args[0])
+		}
+	}
+	// The command runs in wd (rather than the process's working directory).
+	d.fsys = &wdFS{ctx: ctx, fsys: d.filesystem(), wd: filepath.Clean(wd)}
+
+	h := r.History
+	if h == nil {
+		h = &History{}
+	}
+	ros := &resolvingOS{
+		OS:      sourcerer.CurrentOS,
+		history: h,
+		dest:    &Destination{Kind: DestinationPath},
+	}
+	o := command.NewIgnoreAllOutput()
+	defer o.Close()
+	input := command.NewInput(append([]string{"--" + printFlag.Name()}, args...), nil)
+	_, err := commander.Execute(d.Node(), input, o, ros)
+	// Missing files aren't always errors, so check ctx even if the command
+	// succeeded.
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ros.dest.Dir == "" {
+		return nil, fmt.Errorf("no destination for %q", args)
+	}
+	return ros.dest, nil
+}
+
+// wdFS is a filesystem whose working directory is wd, so relative paths are
+// resolved like they are when `d` runs in wd. Every lookup fails once ctx is
+// done.
+type wdFS struct {
+	ctx  context.Context
+	fsys FS
+	wd   string
+}
+
+func (w *wdFS) abs(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(w.wd, name)
+}
+
+func (w *wdFS) Stat(name string) (fs.FileInfo, error) {
+	if err := w.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return w.fsys.Stat(w.abs(name))
+}
+
+func (w *wdFS) Lstat(name string) (fs.FileInfo, error) {
+	if err := w.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return w.fsys.Lstat(w.abs(name))
+}
+
+func (w *wdFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := w.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return w.fsys.ReadDir(w.abs(name))
+}
+
+func (w *wdFS) Readlink(name string) (string, error) {
+	if err := w.ctx.Err(); err != nil {
+		return "", err
+	}
+	return w.fsys.Readlink(w.abs(name))
+}
+
+func (w *wdFS) ReadFile(name string) ([]byte, error) {
+	if err := w.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return w.fsys.ReadFile(w.abs(name))
+}
+
+func (w *wdFS) Getwd() (string, error) { return w.wd, nil }
+
+func (w *wdFS) Hostname() (string, error)    { return fsHostname(w.fsys) }
+func (w *wdFS) UserHomeDir() (string, error) { return fsUserHomeDir(w.fsys) }
+
+func (w *wdFS) OpenDir(name string) (dirReader, error) {
+	if err := w.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return openDir(w.fsys, w.abs(name))
+}
+
+func (w *wdFS) EvalSymlinks(name string) (string, error) {
+	if err := w.ctx.Err(); err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(name) {
+		// Don't use filepath.Join because `..` is applied after resolving the
+		// symbolic links before it.
+		name = w.wd + string(filepath.Separator) + name
+	}
+	return evalSymlinks(w.fsys, name)
+}
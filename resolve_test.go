@@ -0,0 +1,221 @@
+package cd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestResolver(t *testing.T) {
+	root := listingDir(t, map[string]string{
+		"repo/.dshortcuts.json": `{"web": ["web"]}`,
+		"repo/api/v1/":          "",
+		"repo/web/":             "",
+		"repo/file.txt":         "",
+		"roots/lib/":            "",
+		"home/":                 "",
+	})
+	if err := os.Symlink(filepath.Join(root, "repo"), filepath.Join(root, "link")); err != nil {
+		t.Skipf("failed to create symbolic link: %v", err)
+	}
+	repo := filepath.Join(root, "repo")
+	wd := filepath.Join(repo, "api")
+	home := filepath.Join(root, "home")
+	history := &History{PrevDirs: []string{filepath.Join(root, "roots", "lib"), wd}}
+
+	for _, test := range []struct {
+		name    string
+		d       *Dot
+		args    []string
+		cancel  bool
+		want    *Destination
+		wantErr string
+	}{
+		{
+			name: "resolves home directory",
+			want: &Destination{Dir: home, Kind: DestinationHome},
+		},
+		{
+			name: "resolves up flag",
+			args: []string{"-u", "1"},
+			want: &Destination{Dir: repo, Kind: DestinationPath},
+		},
+		{
+			name: "resolves relative path",
+			args: []string{"v1"},
+			want: &Destination{Dir: filepath.Join(wd, "v1"), Kind: DestinationPath},
+		},
+		{
+			name: "completes partially typed path",
+			args: []string{"v"},
+			want: &Destination{Dir: filepath.Join(wd, "v1"), Kind: DestinationPath},
+		},
+		{
+			name: "resolves sub paths",
+			args: []string{"..", "web"},
+			want: &Destination{Dir: filepath.Join(repo, "web"), Kind: DestinationPath, SubPaths: []string{"web/"}},
+		},
+		{
+			name: "resolves up flag with path",
+			args: []string{"api", "-u", "1"},
+			want: &Destination{Dir: wd, Kind: DestinationPath},
+		},
+		{
+			name: "resolves multi-dot path",
+			args: []string{".../roots"},
+			want: &Destination{Dir: filepath.Join(root, "roots"), Kind: DestinationPath},
+		},
+		{
+			name: "resolves file to its directory",
+			args: []string{"../file.txt"},
+			want: &Destination{Dir: repo, Kind: DestinationPath},
+		},
+		{
+			name: "resolves shortcut with sub path",
+			args: []string{"a", "v1"},
+			want: &Destination{Dir: filepath.Join(wd, "v1"), Kind: DestinationShortcut, Shortcut: "a", SubPaths: []string{"v1/"}},
+		},
+		{
+			name: "resolves namespaced shortcut",
+			args: []string{"docs"},
+			want: &Destination{Dir: filepath.Join(repo, "web"), Kind: DestinationShortcut, Shortcut: "w:docs"},
+		},
+		{
+			name: "resolves profile shortcut",
+			args: []string{"h"},
+			want: &Destination{Dir: filepath.Join(root, "roots"), Kind: DestinationShortcut, Shortcut: "h"},
+		},
+		{
+			name: "resolves project shortcut",
+			args: []string{"web"},
+			want: &Destination{Dir: filepath.Join(repo, "web"), Kind: DestinationProjectShortcut, Shortcut: "web"},
+		},
+		{
+			name: "resolves search root",
+			args: []string{"lib"},
+			want: &Destination{Dir: filepath.Join(root, "roots", "lib"), Kind: DestinationSearchRoot},
+		},
+		{
+			name: "resolves parent directory",
+			args: []string{"parent", "repo"},
+			want: &Destination{Dir: repo, Kind: DestinationParent},
+		},
+		{
+			name: "resolves previous directory",
+			args: []string{"-"},
+			want: &Destination{Dir: filepath.Join(root, "roots", "lib"), Kind: DestinationPrevious},
+		},
+		{
+			name: "keeps symbolic links",
+			args: []string{filepath.Join(root, "link", "web")},
+			want: &Destination{Dir: filepath.Join(root, "link", "web"), Kind: DestinationPath},
+		},
+		{
+			name: "resolves symbolic links with flag",
+			args: []string{filepath.Join(root, "link", "web"), "-P"},
+			want: &Destination{Dir: filepath.Join(repo, "web"), Kind: DestinationPath},
+		},
+		{
+			name: "resolves symbolic links with config",
+			d:    &Dot{PathMode: pathModePhysical},
+			args: []string{filepath.Join(root, "link", "web")},
+			want: &Destination{Dir: filepath.Join(repo, "web"), Kind: DestinationPath},
+		},
+		{
+			name:    "fails for unknown parent directory",
+			args:    []string{"parent", "nope"},
+			wantErr: "PARENT_DIR must be a parent directory",
+		},
+		{
+			name:    "fails for disabled namespace",
+			d:       &Dot{DisabledNamespaces: map[string][]string{"host": {"w"}}},
+			args:    []string{"w:docs"},
+			wantErr: `shortcut namespace "w" is disabled on host "host"`,
+		},
+		{
+			name:    "fails for management commands",
+			args:    []string{"index", "build"},
+			wantErr: `"index" isn't a destination`,
+		},
+		{
+			name:    "stops once the context is done",
+			args:    []string{"v1"},
+			cancel:  true,
+			wantErr: "context canceled",
+		},
+		{
+			name:    "fails for invalid up flag",
+			args:    []string{"-u", "x"},
+			wantErr: `strconv.Atoi: parsing "x": invalid syntax`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.d == nil {
+				test.d = &Dot{}
+			}
+			test.d.Shortcuts = map[string]map[string][]string{
+				dirShortcutName: {
+					"a":      {wd},
+					"w:docs": {filepath.Join(repo, "web")},
+				},
+			}
+			test.d.Profiles = map[string]map[string][]string{
+				"host": {"h": {filepath.Join(root, "roots")}},
+			}
+			test.d.SearchRoots = []string{filepath.Join(root, "roots")}
+			test.d.fsys = &statFS{host: "host", home: home}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancel {
+				cancel()
+			}
+			r := &Resolver{Dot: test.d, History: history}
+			got, err := r.Resolve(ctx, wd, test.args)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != test.wantErr {
+				t.Fatalf("Resolve(%v) returned error %q; want %q", test.args, gotErr, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Resolve(%v) returned incorrect destination (-want, +got):\n%s", test.args, diff)
+			}
+			if test.want == nil {
+				return
+			}
+
+			// The CLI prints the same directory.
+			prev, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("failed to get working directory: %v", err)
+			}
+			if err := os.Chdir(wd); err != nil {
+				t.Fatalf("failed to change directory: %v", err)
+			}
+			t.Cleanup(func() { os.Chdir(prev) })
+			commandtest.StubGetwd(t, wd, nil)
+			sc := cachetest.NewTestCache(t)
+			if err := sc.PutStruct(shellCacheKey, history); err != nil {
+				t.Fatalf("failed to store history: %v", err)
+			}
+			cache.StubShellCache(t, sc)
+			commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+				Node:          test.d.Node(),
+				Args:          append([]string{"--print"}, test.args...),
+				OS:            &commandtest.FakeOS{},
+				WantStdout:    test.want.Dir + "\n",
+				SkipDataCheck: true,
+			})
+		})
+	}
+}
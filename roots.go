@@ -0,0 +1,223 @@
+package cd
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	// cdpathEnvVar is the shell's list of search roots for `cd`.
+	cdpathEnvVar = "CDPATH"
+)
+
+var (
+	rootsArg = commander.ListArg[string]("ROOTS", "Directories searched for relative paths", 1, command.UnboundedList,
+		commander.TransformerList(absTransformer()),
+		dirListCompleter(),
+	)
+)
+
+// searchRoots returns the directories that are searched for relative paths
+// that don't exist relative to the current directory. The configured roots
+// are used if there are any; otherwise, the roots are taken from `$CDPATH`.
+func (d *Dot) searchRoots() []string {
+	roots := d.SearchRoots
+	if len(roots) == 0 {
+		if v, ok := command.OSLookupEnv(cdpathEnvVar); ok {
+			roots = filepath.SplitList(v)
+		}
+	}
+
+	var r []string
+	for _, root := range roots {
+		// An empty (or `.`) entry is the current directory, which is always
+		// checked first anyway.
+		if root == "" || root == "." {
+			continue
+		}
+		r = append(r, filepath.Clean(root))
+	}
+	return r
+}
+
+// searchable returns whether the path can be resolved with the search roots.
+// Like the shell, paths that are absolute or start with `.` aren't searched.
+func searchable(data *command.Data, p string) bool {
+	return p != "" && !filepath.IsAbs(p) && !strings.HasPrefix(p, ".") && upFlag.Get(data) == 0
+}
+
+// searchRoot returns the path relative to the first search root that contains
+// it (or false if the path exists relative to the current directory).
+func (d *Dot) searchRoot(data *command.Data, p string) (string, bool) {
+	if !searchable(data, p) {
+		return "", false
+	}
+	return d.searchRootFor(resolvePath(data, p), p)
+}
+
+// searchRootFor returns the directory for p in the first search root that
+// contains it (or false if resolved, the path relative to the working
+// directory, exists).
+func (d *Dot) searchRootFor(resolved, p string) (string, bool) {
+	fsys := d.filesystem()
+	if _, err := fsys.Stat(resolved); err == nil {
+		return "", false
+	}
+	for _, root := range d.searchRoots() {
+		rp := filepath.Join(root, p)
+		if fi, err := fsys.Stat(rp); err == nil && fi.IsDir() {
+			return rp, true
+		}
+	}
+	return "", false
+}
+
+// rootsCompletion adds the matching directories in the search roots to the
+// completion for the current directory. Like resolution, a name is only
+// suggested from the first place that has it, and the root is in the
+// suggestion's description.
+func (d *Dot) rootsCompletion(s string, data *command.Data, c *command.Completion) (*command.Completion, error) {
+	if !searchable(data, s) && s != "" {
+		return c, nil
+	}
+	roots := d.searchRoots()
+	if len(roots) == 0 {
+		return c, nil
+	}
+
+	// Nested paths are completed in the root that the path resolves to.
+	if first, _, ok := strings.Cut(filepath.ToSlash(s), "/"); ok {
+		if c != nil {
+			return c, nil
+		}
+		rp, ok := d.searchRoot(data, first)
+		if !ok {
+			return nil, nil
+		}
+		return d.dirCompleter(filepath.Dir(rp), s, false).Complete(s, data)
+	}
+
+	// The current directory's completion may be a single (or autofilled)
+	// suggestion, so start over with all of its matching directories.
+	var r []string
+	var truncated bool
+	seen := map[string]bool{}
+	if c != nil {
+		names, t, err := d.dirCompleter(getDirectory(data), s, true).suggestions(s, data)
+		if err != nil {
+			return nil, err
+		}
+		truncated = t
+		for _, name := range names {
+			r, seen[name] = append(r, name), true
+		}
+	}
+	// inRoot is a map from suggestion to the search root it was found in.
+	inRoot := map[string]string{}
+	wd := workingDir(data)
+	for _, root := range roots {
+		if root == wd {
+			continue
+		}
+		names, t, err := d.dirCompleter(root, s, false).suggestions(s, data)
+		if err != nil {
+			// Missing roots are ignored (like the shell does).
+			continue
+		}
+		truncated = truncated || t
+		for _, name := range names {
+			if !seen[name] {
+				r, seen[name], inRoot[name] = append(r, name), true, root
+			}
+		}
+	}
+	if len(inRoot) == 0 {
+		return c, nil
+	}
+
+	if len(r) == 1 && !truncated {
+		// Complete to the plain directory (it is resolved with the roots).
+		return &command.Completion{
+			Suggestions:         r,
+			SpacelessCompletion: true,
+		}, nil
+	}
+	if autofill, ok := autofillLetters(s, r); ok && !truncated {
+		return &command.Completion{
+			Suggestions:         []string{autofill},
+			SpacelessCompletion: true,
+		}, nil
+	}
+	sd := suggestionDir(filesystem(data), getDirectory(data), s)
+	rc := rankSuggestions(data, &command.Completion{
+		Suggestions:  r,
+		DontComplete: true,
+	}, func(name string) string {
+		if root, ok := inRoot[name]; ok {
+			return filepath.Join(root, name)
+		}
+		return filepath.Join(sd, name)
+	})
+	for name, root := range inRoot {
+		prefixDescription(data, name, "in "+root)
+	}
+	return rc, nil
+}
+
+func (d *Dot) rootsNode() command.Node {
+	return &commander.BranchNode{
+		Branches: map[string]command.Node{
+			"add": commander.SerialNodes(
+				commander.Description("Add directories to the search roots"),
+				rootsArg,
+				&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+					for _, root := range rootsArg.Get(data) {
+						if !slices.Contains(d.SearchRoots, root) {
+							d.SearchRoots = append(d.SearchRoots, root)
+						}
+					}
+					d.MarkChanged()
+					return nil
+				}},
+			),
+			"rm": commander.SerialNodes(
+				commander.Description("Remove directories from the search roots"),
+				commander.ListArg[string](rootsArg.Name(), rootsArg.Desc(), 1, command.UnboundedList,
+					commander.CompleterFromFunc(func(sl []string, data *command.Data) (*command.Completion, error) {
+						return &command.Completion{Suggestions: d.SearchRoots, Distinct: true}, nil
+					}),
+				),
+				&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+					rm := data.StringList(rootsArg.Name())
+					for _, root := range rm {
+						if !slices.Contains(d.SearchRoots, root) {
+							return o.Stderrf("%s is not a search root\n", root)
+						}
+					}
+					var roots []string
+					for _, root := range d.SearchRoots {
+						if !slices.Contains(rm, root) {
+							roots = append(roots, root)
+						}
+					}
+					d.SearchRoots = roots
+					d.MarkChanged()
+					return nil
+				}},
+			),
+		},
+		Default: commander.SerialNodes(
+			commander.Description("List the search roots (the configured roots, or $CDPATH if there are none)"),
+			&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+				for _, root := range d.searchRoots() {
+					o.Stdoutln(root)
+				}
+				return nil
+			}},
+		),
+	}
+}
@@ -0,0 +1,258 @@
+package cd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestSearchRoots(t *testing.T) {
+	src := listingDir(t, map[string]string{
+		"api/": "",
+		"web/": "",
+		"cmd/": "",
+	})
+	work := listingDir(t, map[string]string{
+		"api/":        "",
+		"docs/guide/": "",
+	})
+	cdpath := map[string]string{cdpathEnvVar: strings.Join([]string{"", src, work}, string(filepath.ListSeparator))}
+
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		want *Dot
+		env  map[string]string
+		etc  *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "resolves with CDPATH",
+			d:    &Dot{},
+			env:  cdpath,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"docs"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(work, "docs"))},
+				},
+			},
+		},
+		{
+			name: "resolves sub paths with CDPATH",
+			d:    &Dot{},
+			env:  cdpath,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"docs", "guide"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(work, "docs", "guide"))},
+				},
+			},
+		},
+		{
+			name: "uses first root",
+			d:    &Dot{},
+			env:  cdpath,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"api"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(src, "api"))},
+				},
+			},
+		},
+		{
+			name: "prefers current directory",
+			d:    &Dot{},
+			env:  cdpath,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"cmd"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(commandtest.FilepathAbs(t, "cmd"))},
+				},
+			},
+		},
+		{
+			name: "doesn't search dot paths",
+			d:    &Dot{},
+			env:  cdpath,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"./docs"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(commandtest.FilepathAbs(t, "docs"))},
+				},
+			},
+		},
+		{
+			name: "doesn't search with up flag",
+			d:    &Dot{},
+			env:  cdpath,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"docs", "-u", "1"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(filepath.Dir(commandtest.FilepathAbs(t)), "docs"))},
+				},
+			},
+		},
+		{
+			name: "configured roots override CDPATH",
+			d:    &Dot{SearchRoots: []string{work}},
+			env:  cdpath,
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"api"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(work, "api"))},
+				},
+			},
+		},
+		{
+			name: "lists CDPATH roots",
+			d:    &Dot{},
+			env:  cdpath,
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"roots"},
+				WantStdout: fmt.Sprintf("%s\n%s\n", src, work),
+			},
+		},
+		{
+			name: "lists configured roots",
+			d:    &Dot{SearchRoots: []string{work}},
+			env:  cdpath,
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"roots"},
+				WantStdout: fmt.Sprintf("%s\n", work),
+			},
+		},
+		{
+			name: "adds roots",
+			d:    &Dot{SearchRoots: []string{work}},
+			want: &Dot{SearchRoots: []string{work, src}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"roots", "add", src, work},
+			},
+		},
+		{
+			name: "removes roots",
+			d:    &Dot{SearchRoots: []string{work, src}},
+			want: &Dot{SearchRoots: []string{src}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"roots", "rm", work},
+			},
+		},
+		{
+			name: "remove fails for unknown root",
+			d:    &Dot{SearchRoots: []string{work}},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"roots", "rm", src},
+				WantErr:    fmt.Errorf("%s is not a search root", src),
+				WantStderr: fmt.Sprintf("%s is not a search root\n", src),
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, commandtest.FilepathAbs(t), nil)
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			test.etc.Node = test.d.Node()
+			test.etc.Env = test.env
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+		})
+	}
+}
+
+func escapeSpaces(s string) string {
+	return strings.ReplaceAll(s, " ", `\ `)
+}
+
+func TestSearchRootsAutocomplete(t *testing.T) {
+	src := listingDir(t, map[string]string{
+		"api/": "",
+		"cmd/": "",
+	})
+	work := listingDir(t, map[string]string{
+		"api/":        "",
+		"app/":        "",
+		"docs/guide/": "",
+		"docs/ref/":   "",
+	})
+	cdpath := map[string]string{cdpathEnvVar: strings.Join([]string{src, work}, string(filepath.ListSeparator))}
+
+	for _, test := range []struct {
+		name string
+		args string
+		env  map[string]string
+		want *command.Autocompletion
+	}{
+		{
+			name: "completes unique directory in root",
+			args: "cmd do",
+			env:  cdpath,
+			want: &command.Autocompletion{
+				Suggestions:         []string{"docs/"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "autofills directories from multiple roots",
+			args: "cmd a",
+			env:  cdpath,
+			want: &command.Autocompletion{
+				Suggestions:         []string{"ap"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "only suggests the first directory with a name",
+			args: "cmd ap",
+			env:  cdpath,
+			want: &command.Autocompletion{
+				Suggestions: []string{"api/", "app/", " "},
+			},
+		},
+		{
+			name: "prefers current directory",
+			args: "cmd cm",
+			env:  cdpath,
+			want: &command.Autocompletion{
+				Suggestions:         []string{"cmd/"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "completes nested directories in root",
+			args: "cmd docs/",
+			env:  cdpath,
+			want: &command.Autocompletion{
+				Suggestions: []string{
+					"guide/",
+					"ref/",
+					" ",
+				},
+			},
+		},
+		{
+			name: "ignores roots without CDPATH",
+			args: "cmd do",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, commandtest.FilepathAbs(t), nil)
+			commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+				Node:          DotCLI().Node(),
+				Args:          test.args,
+				Env:           test.env,
+				Want:          test.want,
+				SkipDataCheck: true,
+				OS:            &commandtest.FakeOS{},
+			})
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package cd
+
+import (
+	"fmt"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+// Session is a saved working set for a shell: its directory along with its
+// history and directory stack.
+type Session struct {
+	Dir      string
+	PrevDirs []string
+	Stack    []string
+}
+
+var (
+	newSessionArg = commander.Arg[string]("NAME", "Name of the session", commander.MinLength[string, string](1))
+)
+
+func (d *Dot) sessionArg() *commander.Argument[string] {
+	return commander.Arg[string]("NAME", "Name of the session",
+		commander.CompleterFromFunc(func(string, *command.Data) (*command.Completion, error) {
+			return &command.Completion{Suggestions: sortedKeys(d.Sessions)}, nil
+		}),
+	)
+}
+
+func (d *Dot) getSession(name string) (*Session, error) {
+	s, ok := d.Sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("session %q does not exist", name)
+	}
+	return s, nil
+}
+
+func (d *Dot) sessionNode() command.Node {
+	return &commander.BranchNode{
+		Branches: map[string]command.Node{
+			"save":   d.sessionSaveNode(),
+			"open o": d.sessionOpenNode(),
+			"list l": d.sessionListNode(),
+			"rm":     d.sessionRemoveNode(),
+		},
+	}
+}
+
+func (d *Dot) sessionSaveNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Save the current directory, history, and directory stack as a session"),
+		d.getwd(),
+		cache.ShellProcessor(),
+		commander.FlagProcessor(
+			physicalFlag,
+			logicalFlag,
+		),
+		newSessionArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			_, h, err := d.getHistory(data)
+			if err != nil {
+				return o.Err(err)
+			}
+			_, s, err := getStack(data)
+			if err != nil {
+				return o.Err(err)
+			}
+			if d.Sessions == nil {
+				d.Sessions = map[string]*Session{}
+			}
+			d.Sessions[newSessionArg.Get(data)] = &Session{
+				Dir:      workingDir(data),
+				PrevDirs: h.PrevDirs,
+				Stack:    s.Dirs,
+			}
+			d.MarkChanged()
+			return nil
+		}},
+	)
+}
+
+func (d *Dot) sessionOpenNode() command.Node {
+	nameArg := d.sessionArg()
+	return commander.SerialNodes(
+		commander.Description("Restore a saved session in the current shell"),
+		cache.ShellProcessor(),
+		nameArg,
+		commander.ExecutableProcessor(func(o command.Output, data *command.Data) ([]string, error) {
+			s, err := d.getSession(nameArg.Get(data))
+			if err != nil {
+				return nil, o.Err(err)
+			}
+
+			// The session's history replaces this shell's history (rather than
+			// recording the directory being left).
+			if !printMode(data) {
+				c := cache.ShellFromData(data)
+				if err := c.PutStruct(shellCacheKey, &History{PrevDirs: s.PrevDirs}); err != nil {
+					return nil, o.Annotatef(err, "failed to save history")
+				}
+				if err := c.PutStruct(stackCacheKey, &Stack{Dirs: s.Stack}); err != nil {
+					return nil, o.Annotatef(err, "failed to save stack")
+				}
+			}
+			return d.changeDirectory(o, data, s.Dir)
+		}),
+	)
+}
+
+func (d *Dot) sessionListNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("List saved sessions"),
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			for _, k := range sortedKeys(d.Sessions) {
+				s := d.Sessions[k]
+				o.Stdoutf("%s: %s (%d history, %d stack)\n", k, s.Dir, len(s.PrevDirs), len(s.Stack))
+			}
+			return nil
+		}},
+	)
+}
+
+func (d *Dot) sessionRemoveNode() command.Node {
+	nameArg := d.sessionArg()
+	return commander.SerialNodes(
+		commander.Description("Delete a saved session"),
+		nameArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			if _, err := d.getSession(nameArg.Get(data)); err != nil {
+				return o.Err(err)
+			}
+			delete(d.Sessions, nameArg.Get(data))
+			d.MarkChanged()
+			return nil
+		}},
+	)
+}
@@ -0,0 +1,185 @@
+package cd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// linkedWdFS returns a filesystem whose working directory (/cur) is a
+// symbolic link to /data/proj.
+func linkedWdFS(t *testing.T) FS {
+	m := newTestMemFS(t, "/", "/data/proj/", "/cur -> /data/proj")
+	if err := m.Chdir(filepath.FromSlash("/cur")); err != nil {
+		t.Fatalf("failed to change directory: %v", err)
+	}
+	return m
+}
+
+func TestSessions(t *testing.T) {
+	work := &Session{
+		Dir:      "/work",
+		PrevDirs: []string{"/work/a", "/work/b"},
+		Stack:    []string{"/work/c"},
+	}
+	for _, test := range []struct {
+		name        string
+		d           *Dot
+		want        *Dot
+		history     []string
+		stack       []string
+		wantHistory []string
+		wantStack   []string
+		fsys        FS
+		etc         *commandtest.ExecuteTestCase
+	}{
+		{
+			name:        "saves session",
+			d:           &Dot{},
+			want:        &Dot{Sessions: map[string]*Session{"proj": {Dir: "/cur", PrevDirs: []string{"/a"}, Stack: []string{"/b", "/c"}}}},
+			history:     []string{"/a"},
+			stack:       []string{"/b", "/c"},
+			wantHistory: []string{"/a"},
+			wantStack:   []string{"/b", "/c"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"session", "save", "proj"},
+			},
+		},
+		{
+			name: "saves physical working directory",
+			d:    &Dot{},
+			want: &Dot{Sessions: map[string]*Session{"proj": {Dir: filepath.FromSlash("/data/proj")}}},
+			fsys: linkedWdFS(t),
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"session", "save", "proj", "-P"},
+			},
+		},
+		{
+			name: "overwrites session",
+			d:    &Dot{Sessions: map[string]*Session{"work": work}},
+			want: &Dot{Sessions: map[string]*Session{"work": {Dir: "/cur"}}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"session", "save", "work"},
+			},
+		},
+		{
+			name:        "opens session",
+			d:           &Dot{Sessions: map[string]*Session{"work": work}},
+			history:     []string{"/a"},
+			stack:       []string{"/b"},
+			wantHistory: []string{"/work/a", "/work/b"},
+			wantStack:   []string{"/work/c"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"session", "open", "work"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/work")},
+				},
+			},
+		},
+		{
+			name:        "open fails for unknown session",
+			d:           &Dot{Sessions: map[string]*Session{"work": work}},
+			history:     []string{"/a"},
+			wantHistory: []string{"/a"},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"session", "o", "play"},
+				WantErr:    fmt.Errorf(`session "play" does not exist`),
+				WantStderr: "session \"play\" does not exist\n",
+			},
+		},
+		{
+			name: "lists sessions",
+			d: &Dot{Sessions: map[string]*Session{
+				"work": work,
+				"play": {Dir: "/play"},
+			}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"session", "list"},
+				WantStdout: strings.Join([]string{
+					"play: /play (0 history, 0 stack)",
+					"work: /work (2 history, 1 stack)",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "removes session",
+			d: &Dot{Sessions: map[string]*Session{
+				"work": work,
+				"play": {Dir: "/play"},
+			}},
+			want: &Dot{Sessions: map[string]*Session{"work": work}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"session", "rm", "play"},
+			},
+		},
+		{
+			name: "remove fails for unknown session",
+			d:    &Dot{Sessions: map[string]*Session{"work": work}},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"session", "rm", "play"},
+				WantErr:    fmt.Errorf(`session "play" does not exist`),
+				WantStderr: "session \"play\" does not exist\n",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, "/cur", nil)
+			test.d.fsys = test.fsys
+			if test.fsys == nil {
+				test.d.fsys = &statFS{wd: "/cur", stat: dirStat}
+			}
+			c := cachetest.NewTestCache(t)
+			if err := c.PutStruct(shellCacheKey, &History{PrevDirs: test.history}); err != nil {
+				t.Fatalf("failed to initialize history: %v", err)
+			}
+			if err := c.PutStruct(stackCacheKey, &Stack{Dirs: test.stack}); err != nil {
+				t.Fatalf("failed to initialize stack: %v", err)
+			}
+			cache.StubShellCache(t, c)
+
+			test.etc.Node = test.d.Node()
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+
+			gotH := &History{}
+			if _, err := c.GetStruct(shellCacheKey, gotH); err != nil {
+				t.Fatalf("failed to read history: %v", err)
+			}
+			if diff := cmp.Diff(&History{PrevDirs: test.wantHistory}, gotH, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Execute(%v) produced incorrect history (-want, +got):\n%s", test.etc.Args, diff)
+			}
+			gotS := &Stack{}
+			if _, err := c.GetStruct(stackCacheKey, gotS); err != nil {
+				t.Fatalf("failed to read stack: %v", err)
+			}
+			if diff := cmp.Diff(&Stack{Dirs: test.wantStack}, gotS, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Execute(%v) produced incorrect stack (-want, +got):\n%s", test.etc.Args, diff)
+			}
+		})
+	}
+}
+
+func TestSessionAutocomplete(t *testing.T) {
+	cache.StubShellCache(t, cachetest.NewTestCache(t))
+	commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+		Node: (&Dot{Sessions: map[string]*Session{"work": {}, "play": {}}}).Node(),
+		Args: "cmd session open ",
+		Want: &command.Autocompletion{
+			Suggestions: []string{"play", "work"},
+		},
+		SkipDataCheck: true,
+		OS:            &commandtest.FakeOS{},
+	})
+}
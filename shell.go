@@ -0,0 +1,254 @@
+package cd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+)
+
+const (
+	// shellEnvVar is the environment variable that can be used to explicitly
+	// set the shell dialect used for emitted commands.
+	shellEnvVar = "LEEP_CD_SHELL"
+	// zshEnvVar is set by `sourcerer` when sourced in zsh.
+	zshEnvVar = "COMMAND_CLI_ZSH"
+)
+
+// shell is a shell dialect for which executable commands are generated.
+type shell interface {
+	// Name returns the name of the shell.
+	Name() string
+	// Quote returns the provided string as a single, literal shell word.
+	Quote(s string) string
+	// Cd returns the command that changes to the provided directory. If dir is
+	// empty, then the command changes to the home directory.
+	Cd(dir string) string
+	// Exec returns the command that runs args in the provided directory
+	// without changing the current directory.
+	Exec(dir string, args []string) string
+	// OSC returns the command that writes an operating system command escape
+	// sequence (`ESC ] code ; value BEL`) to the terminal.
+	OSC(code int, value string) string
+	// Echo returns the command that prints the provided line.
+	Echo(s string) string
+	// List returns the command that lists the current directory.
+	List() string
+	// AndThen returns the command that runs then only if first succeeds.
+	AndThen(first, then string) string
+	// SetEnv returns the command that exports an environment variable.
+	SetEnv(name, value string) string
+	// UnsetEnv returns the command that removes an environment variable.
+	UnsetEnv(name string) string
+	// Activate returns the command that activates a Python virtual environment.
+	Activate(venv string) string
+	// Background returns the command that runs cmd (a command line of this
+	// CLI) in the background, without printing its output.
+	Background(cmd string) string
+}
+
+var (
+	shells = map[string]shell{
+		"bash":       &posixShell{"bash"},
+		"zsh":        &posixShell{"zsh"},
+		"fish":       &fishShell{},
+		"powershell": &powerShell{},
+	}
+)
+
+// osNamer is implemented by `sourcerer.OS` implementations.
+type osNamer interface {
+	Name() string
+}
+
+// shellFromData returns the shell dialect for the current execution. The
+// dialect is selected (in order) from the `LEEP_CD_SHELL` environment
+// variable, the `sourcerer` operating system (PowerShell on Windows), and the
+// `sourcerer` zsh environment variable, otherwise defaulting to bash.
+func shellFromData(data *command.Data) shell {
+	if v, ok := command.OSLookupEnv(shellEnvVar); ok {
+		if sh, ok := shells[strings.ToLower(v)]; ok {
+			return sh
+		}
+	}
+	if on, ok := data.OS.(osNamer); ok && on.Name() == "windows" {
+		return shells["powershell"]
+	}
+	if _, ok := command.OSLookupEnv(zshEnvVar); ok {
+		return shells["zsh"]
+	}
+	return shells["bash"]
+}
+
+// posixShell is a POSIX-compatible shell (bash and zsh).
+type posixShell struct {
+	name string
+}
+
+func (ps *posixShell) Name() string { return ps.name }
+
+// Quote uses single quotes which preserve every byte literally (including
+// `$`, backticks, and non-UTF-8 bytes). Single quotes themselves can't
+// appear inside single quotes, so they are closed, escaped, and reopened.
+func (ps *posixShell) Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (ps *posixShell) Cd(dir string) string {
+	if dir == "" {
+		return "cd"
+	}
+	return fmt.Sprintf("cd %s", ps.Quote(dir))
+}
+
+// Exec runs the command in a subshell so the current directory is unchanged.
+func (ps *posixShell) Exec(dir string, args []string) string {
+	return fmt.Sprintf("(%s && %s)", ps.Cd(dir), quoteAll(ps, args))
+}
+
+func (ps *posixShell) OSC(code int, value string) string {
+	return fmt.Sprintf(`printf '\033]%d;%%s\007' %s`, code, ps.Quote(value))
+}
+
+func (ps *posixShell) Echo(s string) string {
+	return fmt.Sprintf(`printf '%%s\n' %s`, ps.Quote(s))
+}
+
+func (*posixShell) List() string { return "ls" }
+
+func (*posixShell) AndThen(first, then string) string {
+	return fmt.Sprintf("%s && %s", first, then)
+}
+
+func (ps *posixShell) SetEnv(name, value string) string {
+	return fmt.Sprintf("export %s=%s", name, ps.Quote(value))
+}
+
+func (*posixShell) UnsetEnv(name string) string {
+	return fmt.Sprintf("unset %s", name)
+}
+
+func (ps *posixShell) Activate(venv string) string {
+	return fmt.Sprintf(". %s", ps.Quote(filepath.Join(venv, "bin", "activate")))
+}
+
+// Background runs the command in a subshell so job control messages aren't
+// printed.
+func (*posixShell) Background(cmd string) string {
+	return fmt.Sprintf("(%s > /dev/null 2>&1 &)", cmd)
+}
+
+// fishShell is the fish shell.
+type fishShell struct{}
+
+func (*fishShell) Name() string { return "fish" }
+
+// Quote uses single quotes, inside of which fish only interprets `\\` and `\'`.
+func (*fishShell) Quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func (fs *fishShell) Cd(dir string) string {
+	if dir == "" {
+		return "cd"
+	}
+	return fmt.Sprintf("cd %s", fs.Quote(dir))
+}
+
+// Exec runs the command in a new fish process because fish doesn't have
+// subshells.
+func (fs *fishShell) Exec(dir string, args []string) string {
+	return fmt.Sprintf("fish --no-config -c %s", fs.Quote(fmt.Sprintf("%s; and %s", fs.Cd(dir), quoteAll(fs, args))))
+}
+
+func (fs *fishShell) OSC(code int, value string) string {
+	return fmt.Sprintf(`printf '\033]%d;%%s\007' %s`, code, fs.Quote(value))
+}
+
+func (fs *fishShell) Echo(s string) string {
+	return fmt.Sprintf(`printf '%%s\n' %s`, fs.Quote(s))
+}
+
+func (*fishShell) List() string { return "ls" }
+
+func (*fishShell) AndThen(first, then string) string {
+	return fmt.Sprintf("%s; and %s", first, then)
+}
+
+func (fs *fishShell) SetEnv(name, value string) string {
+	return fmt.Sprintf("set -gx %s %s", name, fs.Quote(value))
+}
+
+func (*fishShell) UnsetEnv(name string) string {
+	return fmt.Sprintf("set -e %s", name)
+}
+
+func (fs *fishShell) Activate(venv string) string {
+	return fmt.Sprintf("source %s", fs.Quote(filepath.Join(venv, "bin", "activate.fish")))
+}
+
+// Background runs the command in a new fish process because fish functions
+// can't be run in the background.
+func (fs *fishShell) Background(cmd string) string {
+	return fmt.Sprintf("fish -c %s > /dev/null 2>&1 &", fs.Quote(cmd))
+}
+
+// powerShell is Windows PowerShell (or pwsh).
+type powerShell struct{}
+
+func (*powerShell) Name() string { return "powershell" }
+
+// Quote uses single quotes (a verbatim string) in which the only special
+// character is the single quote itself, escaped by doubling it.
+func (*powerShell) Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Cd uses -LiteralPath so characters like `[` and `*` aren't treated as
+// wildcards.
+func (ps *powerShell) Cd(dir string) string {
+	if dir == "" {
+		return "Set-Location ~"
+	}
+	return fmt.Sprintf("Set-Location -LiteralPath %s", ps.Quote(dir))
+}
+
+// Exec temporarily pushes the directory onto the location stack and always
+// pops it, even if the command fails.
+func (ps *powerShell) Exec(dir string, args []string) string {
+	return fmt.Sprintf("Push-Location -LiteralPath %s; try { & %s } finally { Pop-Location }", ps.Quote(dir), quoteAll(ps, args))
+}
+
+// OSC uses a format string so the value is inserted literally.
+func (ps *powerShell) OSC(code int, value string) string {
+	return fmt.Sprintf(`[Console]::Write("$([char]27)]%d;{0}$([char]7)" -f %s)`, code, ps.Quote(value))
+}
+
+func (ps *powerShell) Echo(s string) string {
+	return fmt.Sprintf("Write-Output %s", ps.Quote(s))
+}
+
+func (*powerShell) List() string { return "Get-ChildItem" }
+
+// AndThen checks `$?` because `&&` isn't supported by Windows PowerShell.
+func (*powerShell) AndThen(first, then string) string {
+	return fmt.Sprintf("%s; if ($?) { %s }", first, then)
+}
+
+func (ps *powerShell) SetEnv(name, value string) string {
+	return fmt.Sprintf("$env:%s = %s", name, ps.Quote(value))
+}
+
+func (*powerShell) UnsetEnv(name string) string {
+	return fmt.Sprintf("Remove-Item -ErrorAction SilentlyContinue Env:%s", name)
+}
+
+// Activate uses the Windows virtual environment layout.
+func (ps *powerShell) Activate(venv string) string {
+	return fmt.Sprintf(". %s", ps.Quote(filepath.Join(venv, "Scripts", "Activate.ps1")))
+}
+
+func (*powerShell) Background(cmd string) string {
+	return fmt.Sprintf("Start-Job -ScriptBlock { %s } | Out-Null", cmd)
+}
@@ -0,0 +1,276 @@
+package cd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// bashCd returns the bash command for changing to a directory without any
+// single quotes in its path.
+func bashCd(dir string) string {
+	return fmt.Sprintf("cd '%s'", dir)
+}
+
+type fakeNamedOS struct {
+	commandtest.FakeOS
+	name string
+}
+
+func (fno *fakeNamedOS) Name() string { return fno.name }
+
+func TestShellQuoting(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		dir  string
+		want map[string]string
+	}{
+		{
+			name: "home directory",
+			want: map[string]string{
+				"bash":       `cd`,
+				"zsh":        `cd`,
+				"fish":       `cd`,
+				"powershell": `Set-Location ~`,
+			},
+		},
+		{
+			name: "simple path",
+			dir:  "/a/b",
+			want: map[string]string{
+				"bash":       `cd '/a/b'`,
+				"zsh":        `cd '/a/b'`,
+				"fish":       `cd '/a/b'`,
+				"powershell": `Set-Location -LiteralPath '/a/b'`,
+			},
+		},
+		{
+			name: "spaces",
+			dir:  "/a b/c  d",
+			want: map[string]string{
+				"bash":       `cd '/a b/c  d'`,
+				"zsh":        `cd '/a b/c  d'`,
+				"fish":       `cd '/a b/c  d'`,
+				"powershell": `Set-Location -LiteralPath '/a b/c  d'`,
+			},
+		},
+		{
+			name: "dollar signs and variables",
+			dir:  "/a/$HOME/${PATH}/$(whoami)",
+			want: map[string]string{
+				"bash":       `cd '/a/$HOME/${PATH}/$(whoami)'`,
+				"zsh":        `cd '/a/$HOME/${PATH}/$(whoami)'`,
+				"fish":       `cd '/a/$HOME/${PATH}/$(whoami)'`,
+				"powershell": `Set-Location -LiteralPath '/a/$HOME/${PATH}/$(whoami)'`,
+			},
+		},
+		{
+			name: "backticks",
+			dir:  "/a/`rm -rf x`/b",
+			want: map[string]string{
+				"bash":       "cd '/a/`rm -rf x`/b'",
+				"zsh":        "cd '/a/`rm -rf x`/b'",
+				"fish":       "cd '/a/`rm -rf x`/b'",
+				"powershell": "Set-Location -LiteralPath '/a/`rm -rf x`/b'",
+			},
+		},
+		{
+			name: "single quotes",
+			dir:  "/it's/'quoted'",
+			want: map[string]string{
+				"bash":       `cd '/it'\''s/'\''quoted'\'''`,
+				"zsh":        `cd '/it'\''s/'\''quoted'\'''`,
+				"fish":       `cd '/it\'s/\'quoted\''`,
+				"powershell": `Set-Location -LiteralPath '/it''s/''quoted'''`,
+			},
+		},
+		{
+			name: "double quotes and backslashes",
+			dir:  `/a/"b"/c\d\\e`,
+			want: map[string]string{
+				"bash":       `cd '/a/"b"/c\d\\e'`,
+				"zsh":        `cd '/a/"b"/c\d\\e'`,
+				"fish":       `cd '/a/"b"/c\\d\\\\e'`,
+				"powershell": `Set-Location -LiteralPath '/a/"b"/c\d\\e'`,
+			},
+		},
+		{
+			name: "glob characters",
+			dir:  "/a/[b]/*/?",
+			want: map[string]string{
+				"bash":       `cd '/a/[b]/*/?'`,
+				"zsh":        `cd '/a/[b]/*/?'`,
+				"fish":       `cd '/a/[b]/*/?'`,
+				"powershell": `Set-Location -LiteralPath '/a/[b]/*/?'`,
+			},
+		},
+		{
+			name: "newlines and semicolons",
+			dir:  "/a\n;b;&&c",
+			want: map[string]string{
+				"bash":       "cd '/a\n;b;&&c'",
+				"zsh":        "cd '/a\n;b;&&c'",
+				"fish":       "cd '/a\n;b;&&c'",
+				"powershell": "Set-Location -LiteralPath '/a\n;b;&&c'",
+			},
+		},
+		{
+			name: "non-UTF-8 bytes",
+			dir:  "/a/\xff\xfe/b",
+			want: map[string]string{
+				"bash":       "cd '/a/\xff\xfe/b'",
+				"zsh":        "cd '/a/\xff\xfe/b'",
+				"fish":       "cd '/a/\xff\xfe/b'",
+				"powershell": "Set-Location -LiteralPath '/a/\xff\xfe/b'",
+			},
+		},
+	} {
+		for name, sh := range shells {
+			t.Run(fmt.Sprintf("%s/%s", test.name, name), func(t *testing.T) {
+				if got := sh.Cd(test.dir); got != test.want[name] {
+					t.Errorf("%s.Cd(%q) returned %q; want %q", name, test.dir, got, test.want[name])
+				}
+			})
+		}
+	}
+}
+
+func TestShellExec(t *testing.T) {
+	for name, want := range map[string]string{
+		"bash":       `(cd '/it'\''s' && 'go' 'test' '$x')`,
+		"zsh":        `(cd '/it'\''s' && 'go' 'test' '$x')`,
+		"fish":       `fish --no-config -c 'cd \'/it\\\'s\'; and \'go\' \'test\' \'$x\''`,
+		"powershell": `Push-Location -LiteralPath '/it''s'; try { & 'go' 'test' '$x' } finally { Pop-Location }`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := shells[name].Exec("/it's", []string{"go", "test", "$x"}); got != want {
+				t.Errorf("%s.Exec() returned %q; want %q", name, got, want)
+			}
+		})
+	}
+}
+
+func TestShellEnv(t *testing.T) {
+	for name, want := range map[string][]string{
+		"bash":       {`export A='it'\''s'`, "unset A", `. '/p/.venv/bin/activate'`, "(d watch --foreground > /dev/null 2>&1 &)"},
+		"zsh":        {`export A='it'\''s'`, "unset A", `. '/p/.venv/bin/activate'`, "(d watch --foreground > /dev/null 2>&1 &)"},
+		"fish":       {`set -gx A 'it\'s'`, "set -e A", `source '/p/.venv/bin/activate.fish'`, `fish -c 'd watch --foreground' > /dev/null 2>&1 &`},
+		"powershell": {`$env:A = 'it''s'`, "Remove-Item -ErrorAction SilentlyContinue Env:A", `. '/p/.venv/Scripts/Activate.ps1'`, "Start-Job -ScriptBlock { d watch --foreground } | Out-Null"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sh := shells[name]
+			got := []string{sh.SetEnv("A", "it's"), sh.UnsetEnv("A"), sh.Activate("/p/.venv"), sh.Background("d watch --foreground")}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("%s produced incorrect environment commands (-want, +got):\n%s", name, diff)
+			}
+		})
+	}
+}
+
+func TestShellFromData(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		env  map[string]string
+		os   command.OS
+		want string
+	}{
+		{
+			name: "defaults to bash",
+			os:   &commandtest.FakeOS{},
+			want: "bash",
+		},
+		{
+			name: "uses zsh if sourced in zsh",
+			os:   &fakeNamedOS{name: "linux"},
+			env:  map[string]string{zshEnvVar: "1"},
+			want: "zsh",
+		},
+		{
+			name: "uses powershell on windows",
+			os:   &fakeNamedOS{name: "windows"},
+			env:  map[string]string{zshEnvVar: "1"},
+			want: "powershell",
+		},
+		{
+			name: "uses environment variable override",
+			os:   &fakeNamedOS{name: "windows"},
+			env:  map[string]string{shellEnvVar: "Fish"},
+			want: "fish",
+		},
+		{
+			name: "ignores unknown environment variable override",
+			os:   &fakeNamedOS{name: "linux"},
+			env:  map[string]string{shellEnvVar: "tcsh"},
+			want: "bash",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubValue(t, &command.OSLookupEnv, func(k string) (string, bool) {
+				v, ok := test.env[k]
+				return v, ok
+			})
+			if got := shellFromData(&command.Data{OS: test.os}).Name(); got != test.want {
+				t.Errorf("shellFromData() returned %q; want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShellExecute(t *testing.T) {
+	cwd := "/prev/dir"
+	for _, test := range []struct {
+		name string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{
+			name: "emits fish command",
+			env:  map[string]string{shellEnvVar: "fish"},
+			args: []string{"/it's"},
+			want: []string{`cd '/it\'s'`},
+		},
+		{
+			name: "emits powershell command",
+			env:  map[string]string{shellEnvVar: "powershell"},
+			args: []string{"/[a]"},
+			want: []string{`Set-Location -LiteralPath '/[a]'`},
+		},
+		{
+			name: "emits powershell home command",
+			env:  map[string]string{shellEnvVar: "powershell"},
+			want: []string{`Set-Location ~`},
+		},
+		{
+			name: "emits powershell parent command",
+			env:  map[string]string{shellEnvVar: "powershell"},
+			args: []string{"parent", "prev"},
+			want: []string{`Set-Location -LiteralPath '/prev'`},
+		},
+		{
+			name: "emits powershell minus command",
+			env:  map[string]string{shellEnvVar: "powershell"},
+			args: []string{"-"},
+			want: []string{`Set-Location ~`},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, cwd, nil)
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+			commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+				Node:            DotCLI(WithFS(&statFS{wd: cwd, stat: dirStat})).Node(),
+				Args:            test.args,
+				Env:             test.env,
+				OS:              &commandtest.FakeOS{},
+				SkipDataCheck:   true,
+				WantExecuteData: &command.ExecuteData{Executable: test.want},
+			})
+		})
+	}
+}
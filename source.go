@@ -0,0 +1,346 @@
+package cd
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+)
+
+const (
+	// Scores of the candidates from the built-in sources (history candidates
+	// are scored between 0 and 1 by frecency).
+	shortcutSourceScore   = 1
+	worktreeSourceScore   = 0.75
+	searchRootSourceScore = 0.5
+	indexSourceScore      = 0.25
+)
+
+// Candidate is a destination directory contributed by a Source.
+type Candidate struct {
+	// Name is what is typed to refer to the directory.
+	Name string
+	// Dir is the absolute directory.
+	Dir string
+	// Score is how likely the candidate is the intended destination (higher is
+	// better). Scores are compared across sources, so they should be between 0
+	// and 1 like the built-in sources' scores.
+	Score float64
+}
+
+// SourceQuery describes the candidates requested from a Source.
+type SourceQuery struct {
+	// Prefix is the typed prefix of the candidate names (ignoring case).
+	Prefix string
+	// Wd is the working directory.
+	Wd string
+	// FS is the filesystem that destinations are resolved in.
+	FS FS
+
+	dot  *Dot
+	data *command.Data
+}
+
+// Source contributes candidate destination directories (e.g. a service
+// catalog that maps service names to repository paths).
+type Source interface {
+	// Candidates returns the candidates whose names start with the query's
+	// prefix.
+	Candidates(q *SourceQuery) ([]*Candidate, error)
+}
+
+// SourceFunc is a Source implemented by a function.
+type SourceFunc func(q *SourceQuery) ([]*Candidate, error)
+
+func (sf SourceFunc) Candidates(q *SourceQuery) ([]*Candidate, error) { return sf(q) }
+
+// WithSources adds sources of candidate destinations. Sources are only a
+// fallback: paths, shortcuts, and search roots are resolved by the command
+// itself, and only destinations that don't exist (relative to the working
+// directory or in a search root) are resolved to the highest scoring
+// candidate with that name (`NAME/SUB_PATH` continues to a sub path of the
+// candidate). Candidates are suggested (after the directories) when
+// completing. Sources that fail are ignored.
+func WithSources(sources ...Source) Option {
+	return func(d *Dot) { d.sources = append(d.sources, sources...) }
+}
+
+// hasPrefix returns whether the name starts with the prefix (ignoring case).
+func (q *SourceQuery) hasPrefix(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), strings.ToLower(q.Prefix))
+}
+
+// candidates returns the merged candidates from all sources whose names start
+// with the prefix, ordered from highest to lowest score. A directory
+// contributed with the same name by multiple sources is kept once (with its
+// highest score). Sources that fail are skipped (like missing search roots),
+// so a broken source doesn't break changing directories.
+func (d *Dot) candidates(data *command.Data, prefix string) []*Candidate {
+	q := &SourceQuery{
+		Prefix: prefix,
+		Wd:     workingDir(data),
+		FS:     filesystem(data),
+		dot:    d,
+		data:   data,
+	}
+	type key struct{ name, dir string }
+	merged := map[key]*Candidate{}
+	for _, s := range d.sources {
+		cs, err := s.Candidates(q)
+		if err != nil {
+			continue
+		}
+		for _, c := range cs {
+			if c.Name == "" || !q.hasPrefix(c.Name) {
+				continue
+			}
+			k := key{c.Name, filepath.Clean(c.Dir)}
+			if m, ok := merged[k]; !ok || c.Score > m.Score {
+				merged[k] = &Candidate{k.name, k.dir, c.Score}
+			}
+		}
+	}
+
+	var r []*Candidate
+	for _, c := range merged {
+		r = append(r, c)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Score != r[j].Score {
+			return r[i].Score > r[j].Score
+		}
+		if r[i].Name != r[j].Name {
+			return r[i].Name < r[j].Name
+		}
+		return r[i].Dir < r[j].Dir
+	})
+	return r
+}
+
+// sourceDestination returns the directory for p from the highest scoring
+// candidate named after p's first component (or false if resolved, the path
+// relative to the working directory, exists or if there is no candidate).
+func (d *Dot) sourceDestination(data *command.Data, resolved, p string) (string, bool) {
+	if len(d.sources) == 0 || !searchable(data, p) {
+		return "", false
+	}
+	if _, err := filesystem(data).Stat(resolved); err == nil {
+		return "", false
+	}
+	name, rest, _ := strings.Cut(filepath.ToSlash(p), "/")
+	for _, c := range d.candidates(data, name) {
+		if c.Name == name {
+			return filepath.Join(c.Dir, filepath.FromSlash(rest)), true
+		}
+	}
+	return "", false
+}
+
+// sourcesCompletion adds the names of the matching candidates to the
+// completion for the current directory (and completes sub paths of a typed
+// candidate name).
+func (d *Dot) sourcesCompletion(s string, data *command.Data, c *command.Completion) *command.Completion {
+	if len(d.sources) == 0 || (!searchable(data, s) && s != "") {
+		return c
+	}
+
+	// Nested paths are completed in the candidate's directory.
+	if name, rest, ok := strings.Cut(filepath.ToSlash(s), "/"); ok {
+		if c != nil {
+			return c
+		}
+		dir, ok := d.sourceDestination(data, resolvePath(data, name), name)
+		if !ok {
+			return nil
+		}
+		rest = filepath.FromSlash(rest)
+		nc, err := d.dirCompleter(dir, rest, false).Complete(rest, data)
+		if err != nil || nc == nil {
+			return nil
+		}
+		if len(nc.Suggestions) == 1 {
+			// A single suggestion is the full path (relative to the candidate).
+			nc.Suggestions[0] = name + string(filepath.Separator) + nc.Suggestions[0]
+		}
+		return nc
+	}
+
+	cs := d.candidates(data, s)
+	var r []string
+	have := map[string]bool{}
+	if c != nil {
+		for _, sg := range c.Suggestions {
+			if sg != " " {
+				r = append(r, sg)
+				have[sg] = true
+			}
+		}
+	}
+	descs, describe := describing(data)
+	var added bool
+	for _, cand := range cs {
+		sg := cand.Name + string(filepath.Separator)
+		if have[sg] {
+			continue
+		}
+		have[sg] = true
+		r = append(r, sg)
+		added = true
+		if describe {
+			descs[sg] = cand.Dir
+		}
+	}
+	if !added {
+		return c
+	}
+
+	if len(r) == 1 {
+		return &command.Completion{
+			Suggestions:         r,
+			SpacelessCompletion: true,
+		}
+	}
+	return &command.Completion{
+		Suggestions:  r,
+		DontComplete: true,
+	}
+}
+
+// HistorySource returns the source of previously visited directories (named
+// by their base name and scored by frecency relative to the most frecent
+// directory).
+func HistorySource() Source {
+	return SourceFunc(func(q *SourceQuery) ([]*Candidate, error) {
+		_, v, err := getVisits()
+		if err != nil {
+			return nil, err
+		}
+		now := timeNow()
+		var max float64
+		for dir := range v.Dirs {
+			if s := v.score(dir, now); s > max {
+				max = s
+			}
+		}
+		var r []*Candidate
+		for _, dir := range sortedKeys(v.Dirs) {
+			if name := filepath.Base(dir); q.hasPrefix(name) && max > 0 {
+				r = append(r, &Candidate{name, dir, v.score(dir, now) / max})
+			}
+		}
+		return r, nil
+	})
+}
+
+// ShortcutSource returns the source of directory shortcuts.
+func ShortcutSource() Source {
+	return SourceFunc(func(q *SourceQuery) ([]*Candidate, error) {
+		if q.dot == nil {
+			return nil, nil
+		}
+		var r []*Candidate
+		for name, dirs := range q.dot.dirShortcuts() {
+			if len(dirs) > 0 && q.hasPrefix(name) {
+				r = append(r, &Candidate{name, filepath.Join(dirs...), shortcutSourceScore})
+			}
+		}
+		return r, nil
+	})
+}
+
+// SearchRootSource returns the source of the directories in the search roots
+// (the configured roots or `$CDPATH`).
+func SearchRootSource() Source {
+	return SourceFunc(func(q *SourceQuery) ([]*Candidate, error) {
+		if q.dot == nil {
+			return nil, nil
+		}
+		var r []*Candidate
+		for _, root := range q.dot.searchRoots() {
+			names, _, err := readDirs(q.FS, root, q.Prefix)
+			if err != nil {
+				// Missing roots are ignored (like the shell does).
+				continue
+			}
+			for _, n := range names {
+				r = append(r, &Candidate{n, filepath.Join(root, n), searchRootSourceScore})
+			}
+		}
+		return r, nil
+	})
+}
+
+// IndexSource returns the source of the directories in the directory index
+// (see `d index build`).
+func IndexSource() Source {
+	return SourceFunc(func(q *SourceQuery) ([]*Candidate, error) {
+		dirs, err := getIndexDirs()
+		if err != nil {
+			return nil, err
+		}
+		var r []*Candidate
+		for _, dir := range dirs {
+			if name := filepath.Base(dir); q.hasPrefix(name) {
+				r = append(r, &Candidate{name, dir, indexSourceScore})
+			}
+		}
+		return r, nil
+	})
+}
+
+// WorktreeSource returns the source of the git worktrees (including the main
+// worktree) of the repository that contains the working directory.
+func WorktreeSource() Source {
+	return SourceFunc(func(q *SourceQuery) ([]*Candidate, error) {
+		var r []*Candidate
+		for _, dir := range worktrees(q.FS, q.Wd) {
+			if name := filepath.Base(dir); q.hasPrefix(name) {
+				r = append(r, &Candidate{name, dir, worktreeSourceScore})
+			}
+		}
+		return r, nil
+	})
+}
+
+// worktrees returns the worktrees of the git repository that contains the
+// directory.
+func worktrees(fsys FS, dir string) []string {
+	for prev := ""; dir != prev; prev, dir = dir, filepath.Dir(dir) {
+		gitPath := filepath.Join(dir, ".git")
+		fi, err := fsys.Stat(gitPath)
+		if err != nil {
+			continue
+		}
+		// A linked worktree's `.git` file points to its directory in the main
+		// repository's `.git/worktrees`.
+		commonDir := gitPath
+		if !fi.IsDir() {
+			b, err := fsys.ReadFile(gitPath)
+			if err != nil {
+				return nil
+			}
+			gd, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:")
+			if !ok {
+				return nil
+			}
+			if gd = strings.TrimSpace(gd); !filepath.IsAbs(gd) {
+				gd = filepath.Join(dir, gd)
+			}
+			commonDir = filepath.Dir(filepath.Dir(gd))
+		}
+
+		r := []string{filepath.Dir(commonDir)}
+		es, _ := fsys.ReadDir(filepath.Join(commonDir, "worktrees"))
+		for _, e := range es {
+			// Each worktree's `gitdir` file is the path of its `.git` file.
+			b, err := fsys.ReadFile(filepath.Join(commonDir, "worktrees", e.Name(), "gitdir"))
+			if err != nil {
+				continue
+			}
+			r = append(r, filepath.Dir(strings.TrimSpace(string(b))))
+		}
+		return r
+	}
+	return nil
+}
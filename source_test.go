@@ -0,0 +1,355 @@
+package cd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// catalogSource is a Source that maps names to directories (with the same
+// score).
+func catalogSource(score float64, catalog map[string]string) Source {
+	return SourceFunc(func(q *SourceQuery) ([]*Candidate, error) {
+		var r []*Candidate
+		for _, name := range sortedKeys(catalog) {
+			r = append(r, &Candidate{name, filepath.FromSlash(catalog[name]), score})
+		}
+		return r, nil
+	})
+}
+
+// sourcesFS returns the in-memory filesystem for the source tests.
+func sourcesFS(t *testing.T) *MemFS {
+	return newTestMemFS(t, "/repo",
+		"/repo/src/",
+		"/repo/bin/",
+		"/services/billing/api/",
+		"/services/search/",
+		"/other/web/",
+		"/work/reports/",
+		"/work/old/reports/",
+		"/deep/nested/proj/",
+	)
+}
+
+func TestSources(t *testing.T) {
+	catalog := catalogSource(1, map[string]string{
+		"billing": "/services/billing",
+		"search":  "/services/search",
+		"src":     "/other/src",
+	})
+	for _, test := range []struct {
+		name       string
+		sources    []Source
+		args       []string
+		want       string
+		wantStderr string
+		wantErr    error
+	}{
+		{
+			name:    "resolves candidate",
+			sources: []Source{catalog},
+			args:    []string{"billing"},
+			want:    "/services/billing",
+		},
+		{
+			name:    "resolves sub path of candidate",
+			sources: []Source{catalog},
+			args:    []string{"billing/api"},
+			want:    "/services/billing/api",
+		},
+		{
+			name:    "resolves sub path arguments of candidate",
+			sources: []Source{catalog},
+			args:    []string{"billing", "api"},
+			want:    "/services/billing/api",
+		},
+		{
+			name:    "prefers existing directory",
+			sources: []Source{catalog},
+			args:    []string{"src"},
+			want:    "/repo/src",
+		},
+		{
+			name:    "ignores candidates with up flag",
+			sources: []Source{catalog},
+			args:    []string{"billing", "-u", "1"},
+			want:    "/billing",
+		},
+		{
+			name:    "completes partial candidate name",
+			sources: []Source{catalog},
+			args:    []string{"bill"},
+			want:    "/services/billing",
+		},
+		{
+			name:    "ignores candidates for unknown name",
+			sources: []Source{catalog},
+			args:    []string{"nope"},
+			want:    "/repo/nope",
+		},
+		{
+			name: "merges candidates across sources",
+			sources: []Source{
+				catalogSource(0.2, map[string]string{"web": "/services/web"}),
+				catalogSource(0.9, map[string]string{"web": "/other/web"}),
+			},
+			args: []string{"web"},
+			want: "/other/web",
+		},
+		{
+			name:    "resolves history candidate",
+			sources: []Source{HistorySource()},
+			args:    []string{"reports"},
+			want:    "/work/reports",
+		},
+		{
+			name:    "resolves index candidate",
+			sources: []Source{IndexSource()},
+			args:    []string{"proj"},
+			want:    "/deep/nested/proj",
+		},
+		{
+			name: "ignores failing source",
+			sources: []Source{SourceFunc(func(*SourceQuery) ([]*Candidate, error) {
+				return nil, fmt.Errorf("oops")
+			})},
+			args: []string{"billing"},
+			want: "/repo/billing",
+		},
+		{
+			name: "resolves candidate from other sources if a source fails",
+			sources: []Source{
+				SourceFunc(func(*SourceQuery) ([]*Candidate, error) {
+					return nil, fmt.Errorf("oops")
+				}),
+				catalog,
+			},
+			args: []string{"billing"},
+			want: "/services/billing",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stubSourceCaches(t)
+			etc := &commandtest.ExecuteTestCase{
+				Node:          DotCLI(WithFS(sourcesFS(t)), WithSources(test.sources...)).Node(),
+				Args:          test.args,
+				OS:            &commandtest.FakeOS{},
+				WantStderr:    test.wantStderr,
+				WantErr:       test.wantErr,
+				SkipDataCheck: true,
+			}
+			if test.want != "" {
+				etc.WantExecuteData = &command.ExecuteData{Executable: []string{bashCd(filepath.FromSlash(test.want))}}
+			}
+			commandertest.ExecuteTest(t, etc)
+		})
+	}
+}
+
+func TestSourcesAutocomplete(t *testing.T) {
+	catalog := catalogSource(0.5, map[string]string{
+		"billing": "/services/billing",
+		"bin":     "/other/bin",
+		"search":  "/services/search",
+	})
+	for _, test := range []struct {
+		name    string
+		sources []Source
+		args    string
+		want    *command.Autocompletion
+	}{
+		{
+			name:    "suggests directories and candidates",
+			sources: []Source{catalog},
+			args:    "cmd ",
+			want: &command.Autocompletion{
+				// Directories come before candidates (like when resolving).
+				Suggestions: []string{"billing/", "bin/", "search/", "src/", " "},
+			},
+		},
+		{
+			name:    "suggests candidates that match prefix",
+			sources: []Source{catalog},
+			args:    "cmd bi",
+			want: &command.Autocompletion{
+				Suggestions: []string{"billing/", "bin/", " "},
+			},
+		},
+		{
+			name:    "completes single candidate",
+			sources: []Source{catalog},
+			args:    "cmd se",
+			want: &command.Autocompletion{
+				Suggestions:         []string{"search/"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name:    "completes sub paths of candidate",
+			sources: []Source{catalog},
+			args:    "cmd billing/",
+			want: &command.Autocompletion{
+				Suggestions:         []string{"billing/api/"},
+				SpacelessCompletion: true,
+			},
+		},
+		{
+			name: "suggests candidates from multiple sources",
+			sources: []Source{
+				catalog,
+				HistorySource(),
+			},
+			args: "cmd ",
+			want: &command.Autocompletion{
+				Suggestions: []string{"billing/", "bin/", "reports/", "search/", "src/", " "},
+			},
+		},
+		{
+			name: "ignores failing sources",
+			sources: []Source{catalog, SourceFunc(func(*SourceQuery) ([]*Candidate, error) {
+				return nil, fmt.Errorf("oops")
+			})},
+			args: "cmd ",
+			want: &command.Autocompletion{
+				// The other sources' candidates are still suggested.
+				Suggestions: []string{"billing/", "bin/", "search/", "src/", " "},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stubSourceCaches(t)
+			for i, s := range test.want.Suggestions {
+				test.want.Suggestions[i] = filepath.FromSlash(s)
+			}
+			commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+				Node:          DotCLI(WithFS(sourcesFS(t)), WithSources(test.sources...)).Node(),
+				Args:          test.args,
+				OS:            &commandtest.FakeOS{},
+				Want:          test.want,
+				SkipDataCheck: true,
+			})
+		})
+	}
+}
+
+func TestSourcesResolver(t *testing.T) {
+	d := DotCLI(WithFS(sourcesFS(t)), WithSources(catalogSource(1, map[string]string{"billing": "/services/billing"})))
+	got, err := NewResolver(d).Resolve(context.Background(), filepath.FromSlash("/repo"), []string{"billing", "api"})
+	if err != nil {
+		t.Fatalf("Resolve() returned error: %v", err)
+	}
+	want := &Destination{
+		Dir:      filepath.FromSlash("/services/billing/api"),
+		Kind:     DestinationSource,
+		SubPaths: []string{"api/"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Resolve() returned incorrect destination (-want, +got):\n%s", diff)
+	}
+}
+
+func TestWorktrees(t *testing.T) {
+	root := listingDir(t, map[string]string{
+		"repo/src/":    "",
+		"feature/pkg/": "",
+	})
+	repo := filepath.Join(root, "repo")
+	feature := filepath.Join(root, "feature")
+	gitDir := filepath.Join(repo, ".git", "worktrees", "feature")
+	mkdir(t, gitDir)
+	writeFile(t, filepath.Join(gitDir, "gitdir"), filepath.Join(feature, ".git")+"\n")
+	writeFile(t, filepath.Join(feature, ".git"), "gitdir: "+gitDir+"\n")
+
+	for _, test := range []struct {
+		name string
+		dir  string
+		want []string
+	}{
+		{
+			name: "lists worktrees from main worktree",
+			dir:  filepath.Join(repo, "src"),
+			want: []string{repo, feature},
+		},
+		{
+			name: "lists worktrees from linked worktree",
+			dir:  filepath.Join(feature, "pkg"),
+			want: []string{repo, feature},
+		},
+		{
+			name: "lists nothing outside of repository",
+			dir:  root,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, worktrees(osFS{}, test.dir)); diff != "" {
+				t.Errorf("worktrees(%q) returned incorrect worktrees (-want, +got):\n%s", test.dir, diff)
+			}
+		})
+	}
+}
+
+// stubSourceCaches stubs the caches read by the built-in sources: the visits
+// cache has visits to /work/reports and /work/old/reports, and the index
+// contains /deep/nested/proj.
+func stubSourceCaches(t *testing.T) {
+	t.Helper()
+	now := time.Unix(1_000_000_000, 0)
+	commandtest.StubValue(t, &timeNow, func() time.Time { return now })
+	vc := cachetest.NewTestCacheWithData(t, map[string]interface{}{
+		visitsCacheKey: &Visits{Dirs: map[string]*Visit{
+			filepath.FromSlash("/work/reports"):     {Count: 5, Last: now.Unix()},
+			filepath.FromSlash("/work/old/reports"): {Count: 1, Last: now.Unix()},
+		}},
+	})
+	commandtest.StubValue(t, &visitsCache, func() (*cache.Cache, error) { return vc, nil })
+	cache.StubShellCache(t, cachetest.NewTestCache(t))
+	ic := cachetest.NewTestCacheWithData(t, map[string]interface{}{
+		indexCacheKey: &Index{Dirs: map[string]*IndexEntry{
+			filepath.FromSlash("/deep/nested/proj"): {},
+		}},
+	})
+	commandtest.StubValue(t, &indexCache, func() (*cache.Cache, error) { return ic, nil })
+}
+
+func writeFile(t *testing.T, name, contents string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+}
+
+func TestWorktreeSourceFS(t *testing.T) {
+	// The worktrees only exist in the query's filesystem.
+	m := newTestMemFS(t, "/repo/src", "/repo/src/", "/feature/pkg/", "/repo/.git/worktrees/feature/")
+	for name, data := range map[string]string{
+		"/repo/.git/worktrees/feature/gitdir": "/feature/.git\n",
+		"/feature/.git":                       "gitdir: /repo/.git/worktrees/feature\n",
+	} {
+		if err := m.WriteFile(filepath.FromSlash(name), []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write %q: %v", name, err)
+		}
+	}
+
+	got, err := WorktreeSource().Candidates(&SourceQuery{Wd: filepath.FromSlash("/feature/pkg"), FS: m})
+	if err != nil {
+		t.Fatalf("Candidates() returned error: %v", err)
+	}
+	want := []*Candidate{
+		{Name: "repo", Dir: filepath.FromSlash("/repo"), Score: worktreeSourceScore},
+		{Name: "feature", Dir: filepath.FromSlash("/feature"), Score: worktreeSourceScore},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Candidates() returned incorrect candidates (-want, +got):\n%s", diff)
+	}
+}
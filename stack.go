@@ -0,0 +1,190 @@
+package cd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	stackCacheKey = "leep-cd-stack"
+)
+
+var (
+	stackIndexArg = commander.OptionalArg[int]("INDEX", "Index of the stack entry to change to",
+		stackIndexCompleter(),
+		commander.NonNegative[int](),
+	)
+)
+
+// Stack is an explicit directory stack (like `pushd` and `popd`) that is
+// kept separately from the directory history. The top of the stack is the
+// last element.
+type Stack struct {
+	Dirs []string
+}
+
+func getStack(data *command.Data) (*cache.Cache, *Stack, error) {
+	c := cache.ShellFromData(data)
+
+	s := &Stack{}
+	if _, err := c.GetStruct(stackCacheKey, s); err != nil {
+		return nil, nil, fmt.Errorf("failed to get stack data: %v", err)
+	}
+	return c, s, nil
+}
+
+func (s *Stack) save(c *cache.Cache, data *command.Data) error {
+	// Printing the destination doesn't change directories.
+	if printMode(data) {
+		return nil
+	}
+	if err := c.PutStruct(stackCacheKey, s); err != nil {
+		return fmt.Errorf("failed to save stack: %v", err)
+	}
+	return nil
+}
+
+// entry returns the directory at the provided index (where 0 is the top of the stack).
+func (s *Stack) entry(idx int) (string, error) {
+	if idx >= len(s.Dirs) {
+		return "", fmt.Errorf("stack index %d is out of range (stack has %d entries)", idx, len(s.Dirs))
+	}
+	return s.Dirs[len(s.Dirs)-1-idx], nil
+}
+
+// stackExecutable returns a processor that runs f with the stack and then
+// changes to the returned directory.
+func (d *Dot) stackExecutable(f func(*Stack, *command.Data) (string, error)) command.Processor {
+	return commander.ExecutableProcessor(func(o command.Output, data *command.Data) ([]string, error) {
+		c, s, err := getStack(data)
+		if err != nil {
+			return nil, o.Err(err)
+		}
+		dir, err := f(s, data)
+		if err != nil {
+			return nil, o.Err(err)
+		}
+		if err := s.save(c, data); err != nil {
+			return nil, o.Err(err)
+		}
+		return d.changeDirectory(o, data, dir)
+	})
+}
+
+func (d *Dot) pushNode() command.Node {
+	push := d.stackExecutable(func(s *Stack, data *command.Data) (string, error) {
+		s.Dirs = append(s.Dirs, workingDir(data))
+		return data.String(targetDirKey), nil
+	})
+	return prependProcessors(
+		d.targetNode(push, &commander.ExecutorProcessor{F: d.updateHistory}),
+		commander.Description("Push the current directory onto the directory stack and change to the target"),
+	)
+}
+
+func (d *Dot) popNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Pop the top of the directory stack and change to it"),
+		d.getwd(),
+		cache.ShellProcessor(),
+		d.stackExecutable(func(s *Stack, data *command.Data) (string, error) {
+			if len(s.Dirs) == 0 {
+				return "", fmt.Errorf("directory stack is empty")
+			}
+			dir := s.Dirs[len(s.Dirs)-1]
+			s.Dirs = s.Dirs[:len(s.Dirs)-1]
+			return dir, nil
+		}),
+		&commander.ExecutorProcessor{F: d.updateHistory},
+	)
+}
+
+func (d *Dot) swapTopNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Swap the current directory with the top of the directory stack"),
+		d.getwd(),
+		cache.ShellProcessor(),
+		d.stackExecutable(func(s *Stack, data *command.Data) (string, error) {
+			if len(s.Dirs) == 0 {
+				return "", fmt.Errorf("directory stack is empty")
+			}
+			dir := s.Dirs[len(s.Dirs)-1]
+			s.Dirs[len(s.Dirs)-1] = workingDir(data)
+			return dir, nil
+		}),
+		&commander.ExecutorProcessor{F: d.updateHistory},
+	)
+}
+
+// stackIndexCompleter suggests stack entries as `INDEX:DIR`.
+func stackIndexCompleter() commander.Completer[int] {
+	return commander.CompleterFromFunc(func(_ int, data *command.Data) (*command.Completion, error) {
+		_, s, err := getStack(data)
+		if err != nil {
+			return nil, err
+		}
+		var r []string
+		for i := range s.Dirs {
+			dir, _ := s.entry(i)
+			r = append(r, fmt.Sprintf("%d:%s", i, dir))
+		}
+		return &command.Completion{Suggestions: r}, nil
+	})
+}
+
+// stackIndexProcessor strips the directory from an `INDEX:DIR` argument (as
+// produced by stackIndexCompleter) so only the index is parsed.
+func stackIndexProcessor() command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		v, ok := i.Peek()
+		if !ok {
+			return nil
+		}
+		if idx, _, ok := strings.Cut(v, ":"); ok {
+			if _, err := strconv.Atoi(idx); err == nil {
+				i.Pop(data)
+				i.PushFront(idx)
+			}
+		}
+		return nil
+	}, nil)
+}
+
+func (d *Dot) stackNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("List the directory stack or change to the entry at INDEX"),
+		d.getwd(),
+		cache.ShellProcessor(),
+		stackIndexProcessor(),
+		stackIndexArg,
+		commander.ExecutableProcessor(func(o command.Output, data *command.Data) ([]string, error) {
+			_, s, err := getStack(data)
+			if err != nil {
+				return nil, o.Err(err)
+			}
+			if !data.Has(stackIndexArg.Name()) {
+				for i := range s.Dirs {
+					dir, _ := s.entry(i)
+					o.Stdoutf("%d  %s\n", i, dir)
+				}
+				return nil, nil
+			}
+			dir, err := s.entry(stackIndexArg.Get(data))
+			if err != nil {
+				return nil, o.Err(err)
+			}
+			return d.changeDirectory(o, data, dir)
+		}),
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			if !data.Has(stackIndexArg.Name()) {
+				return nil
+			}
+			return d.updateHistory(o, data)
+		}},
+	)
+}
@@ -0,0 +1,207 @@
+package cd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestStack(t *testing.T) {
+	cwd := "/cur"
+	for _, test := range []struct {
+		name        string
+		d           *Dot
+		stack       []string
+		wantStack   []string
+		wantHistory []string
+		etc         *commandtest.ExecuteTestCase
+	}{
+		{
+			name:        "pushes directory",
+			d:           DotCLI(),
+			stack:       []string{"/a"},
+			wantStack:   []string{"/a", "/cur"},
+			wantHistory: []string{"/cur"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"push", "/x", "y"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/x/y")},
+				},
+			},
+		},
+		{
+			name:        "pushes shortcut",
+			d:           shortcutDot(map[string][]string{"api": {"/work/api"}}),
+			wantStack:   []string{"/cur"},
+			wantHistory: []string{"/cur"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"push", "api"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/work/api")},
+				},
+			},
+		},
+		{
+			name:      "push in print mode doesn't change stack",
+			d:         DotCLI(),
+			stack:     []string{"/a"},
+			wantStack: []string{"/a"},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"--print", "push", "/x"},
+				WantStdout: "/x\n",
+			},
+		},
+		{
+			name:        "pops directory",
+			d:           DotCLI(),
+			stack:       []string{"/a", "/b"},
+			wantStack:   []string{"/a"},
+			wantHistory: []string{"/cur"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"pop"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/b")},
+				},
+			},
+		},
+		{
+			name: "pop fails for empty stack",
+			d:    DotCLI(),
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"pop"},
+				WantErr:    fmt.Errorf("directory stack is empty"),
+				WantStderr: "directory stack is empty\n",
+			},
+		},
+		{
+			name:        "swaps top",
+			d:           DotCLI(),
+			stack:       []string{"/a", "/b"},
+			wantStack:   []string{"/a", "/cur"},
+			wantHistory: []string{"/cur"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"swap-top"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/b")},
+				},
+			},
+		},
+		{
+			name: "swap fails for empty stack",
+			d:    DotCLI(),
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"swap-top"},
+				WantErr:    fmt.Errorf("directory stack is empty"),
+				WantStderr: "directory stack is empty\n",
+			},
+		},
+		{
+			name:      "lists stack",
+			d:         DotCLI(),
+			stack:     []string{"/a", "/b", "/c"},
+			wantStack: []string{"/a", "/b", "/c"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"stack"},
+				WantStdout: strings.Join([]string{
+					"0  /c",
+					"1  /b",
+					"2  /a",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name:        "jumps to stack entry",
+			d:           DotCLI(),
+			stack:       []string{"/a", "/b", "/c"},
+			wantStack:   []string{"/a", "/b", "/c"},
+			wantHistory: []string{"/cur"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"stack", "2"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/a")},
+				},
+			},
+		},
+		{
+			name:        "jumps to completed stack entry",
+			d:           DotCLI(),
+			stack:       []string{"/a", "/b", "/c"},
+			wantStack:   []string{"/a", "/b", "/c"},
+			wantHistory: []string{"/cur"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"stack", "1:/b"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/b")},
+				},
+			},
+		},
+		{
+			name:      "jump fails for out of range index",
+			d:         DotCLI(),
+			stack:     []string{"/a"},
+			wantStack: []string{"/a"},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"stack", "1"},
+				WantErr:    fmt.Errorf("stack index 1 is out of range (stack has 1 entries)"),
+				WantStderr: "stack index 1 is out of range (stack has 1 entries)\n",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, cwd, nil)
+			test.d.fsys = &statFS{wd: cwd, stat: dirStat, host: "laptop"}
+			c := cachetest.NewTestCache(t)
+			if test.stack != nil {
+				if err := c.PutStruct(stackCacheKey, &Stack{Dirs: test.stack}); err != nil {
+					t.Fatalf("failed to initialize stack: %v", err)
+				}
+			}
+			cache.StubShellCache(t, c)
+
+			test.etc.Node = test.d.Node()
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+
+			gotS := &Stack{}
+			if _, err := c.GetStruct(stackCacheKey, gotS); err != nil {
+				t.Fatalf("failed to read stack: %v", err)
+			}
+			if diff := cmp.Diff(&Stack{Dirs: test.wantStack}, gotS); diff != "" {
+				t.Errorf("Execute(%v) produced incorrect stack (-want, +got):\n%s", test.etc.Args, diff)
+			}
+			gotH := &History{}
+			if _, err := c.GetStruct(shellCacheKey, gotH); err != nil {
+				t.Fatalf("failed to read history: %v", err)
+			}
+			if diff := cmp.Diff(&History{PrevDirs: test.wantHistory}, gotH); diff != "" {
+				t.Errorf("Execute(%v) produced incorrect history (-want, +got):\n%s", test.etc.Args, diff)
+			}
+		})
+	}
+}
+
+func TestStackAutocomplete(t *testing.T) {
+	c := cachetest.NewTestCache(t)
+	if err := c.PutStruct(stackCacheKey, &Stack{Dirs: []string{"/a", "/b"}}); err != nil {
+		t.Fatalf("failed to initialize stack: %v", err)
+	}
+	cache.StubShellCache(t, c)
+	commandertest.AutocompleteTest(t, &commandtest.CompleteTestCase{
+		Node: DotCLI().Node(),
+		Args: "cmd stack ",
+		Want: &command.Autocompletion{
+			Suggestions: []string{"0:/b", "1:/a"},
+		},
+		SkipDataCheck: true,
+		OS:            &commandtest.FakeOS{},
+	})
+}
@@ -0,0 +1,106 @@
+package cd
+
+import (
+	"path/filepath"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	pathModeLogical  = "logical"
+	pathModePhysical = "physical"
+)
+
+var (
+	pathModes = []string{pathModeLogical, pathModePhysical}
+
+	physicalFlag = commander.BoolFlag("physical", 'P', "Resolve symbolic links in the destination (like `cd -P`)")
+	logicalFlag  = commander.BoolFlag("logical", 'L', "Keep symbolic links in the destination (like `cd -L`)")
+	pathModeArg  = commander.OptionalArg[string]("MODE", "Whether symbolic links are kept (logical) or resolved (physical) by default",
+		commander.SimpleCompleter[string](pathModes...),
+		commander.InList(pathModes...),
+	)
+)
+
+// pathModeProcessor applies the configured default path mode. The `-P` and
+// `-L` flags (processed later) override it.
+func (d *Dot) pathModeProcessor() command.Processor {
+	apply := func(data *command.Data) {
+		if d.PathMode == pathModePhysical {
+			data.Set(physicalFlag.Name(), true)
+		}
+	}
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		apply(data)
+		return nil
+	}, func(i *command.Input, data *command.Data) (*command.Completion, error) {
+		apply(data)
+		return nil, nil
+	})
+}
+
+// physical returns whether symbolic links should be resolved.
+func physical(data *command.Data) bool {
+	return data.Bool(physicalFlag.Name()) && !data.Bool(logicalFlag.Name())
+}
+
+// workingDir returns the current directory, with its symbolic links resolved
+// in physical mode.
+func workingDir(data *command.Data) string {
+	wd := commander.Getwd.Get(data)
+	if !physical(data) {
+		return wd
+	}
+	if r, err := evalSymlinks(filesystem(data), wd); err == nil {
+		return r
+	}
+	return wd
+}
+
+// resolvePath returns the absolute path for p (relative to the working
+// directory). In logical mode, the path is cleaned lexically (so `..` removes
+// the previous component, like `cd -L`). In physical mode, symbolic links are
+// resolved before each `..` is applied (like `cd -P`).
+func resolvePath(data *command.Data, p string) string {
+	if !physical(data) {
+		// os.Getwd uses `$PWD` (when valid), so symbolic links are kept.
+		if abs, err := absPath(filesystem(data), p); err == nil {
+			return abs
+		}
+		return filepath.Clean(p)
+	}
+
+	if !filepath.IsAbs(p) {
+		// Don't use filepath.Join because it would apply `..` lexically.
+		p = workingDir(data) + string(filepath.Separator) + p
+	}
+	if r, err := evalSymlinks(filesystem(data), p); err == nil {
+		return r
+	}
+	return filepath.Clean(p)
+}
+
+func (d *Dot) pathModeNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Set whether symbolic links are resolved by default (or print the current mode)"),
+		pathModeArg,
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			if !data.Has(pathModeArg.Name()) {
+				mode := d.PathMode
+				if mode == "" {
+					mode = pathModeLogical
+				}
+				o.Stdoutln(mode)
+				return nil
+			}
+
+			d.PathMode = pathModeArg.Get(data)
+			if d.PathMode == pathModeLogical {
+				d.PathMode = ""
+			}
+			d.MarkChanged()
+			return nil
+		}},
+	)
+}
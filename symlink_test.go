@@ -0,0 +1,192 @@
+package cd
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestSymlinks(t *testing.T) {
+	// testing/links/alias is a symbolic link to testing/links/real/inner.
+	links := commandtest.FilepathAbs(t, "testing", "links")
+	alias := filepath.Join(links, "alias")
+	inner := filepath.Join(links, "real", "inner")
+
+	for _, test := range []struct {
+		name        string
+		d           *Dot
+		want        *Dot
+		cwd         string
+		wantHistory []string
+		etc         *commandtest.ExecuteTestCase
+	}{
+		{
+			name:        "keeps symbolic links by default",
+			d:           &Dot{},
+			cwd:         links,
+			wantHistory: []string{links},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{alias},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(alias)},
+				},
+			},
+		},
+		{
+			name:        "resolves symbolic links with flag",
+			d:           &Dot{},
+			cwd:         links,
+			wantHistory: []string{links},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{alias, "-P"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(inner)},
+				},
+			},
+		},
+		{
+			name:        "resolves symbolic links with config",
+			d:           &Dot{PathMode: pathModePhysical},
+			cwd:         links,
+			wantHistory: []string{links},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{alias},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(inner)},
+				},
+			},
+		},
+		{
+			name:        "logical flag overrides config",
+			d:           &Dot{PathMode: pathModePhysical},
+			cwd:         links,
+			wantHistory: []string{links},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{alias, "-L"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(alias)},
+				},
+			},
+		},
+		{
+			name:        "up flag is logical by default",
+			d:           &Dot{},
+			cwd:         alias,
+			wantHistory: []string{alias},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-u", "1"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("..")},
+				},
+			},
+		},
+		{
+			name:        "up flag is physical",
+			d:           &Dot{},
+			cwd:         alias,
+			wantHistory: []string{inner},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"-u", "1", "-P"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(links, "real"))},
+				},
+			},
+		},
+		{
+			name:        "relative sub paths are physical",
+			d:           &Dot{PathMode: pathModePhysical},
+			cwd:         alias,
+			wantHistory: []string{inner},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{alias, ".."},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(links, "real"))},
+				},
+			},
+		},
+		{
+			name:        "prints physical directory",
+			d:           &Dot{},
+			cwd:         links,
+			wantHistory: []string{},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"--print", alias, "-P"},
+				WantStdout: inner + "\n",
+			},
+		},
+		{
+			name: "parent is logical by default",
+			d:    &Dot{},
+			cwd:  alias,
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"parent", "real"},
+				WantErr:    fmt.Errorf("PARENT_DIR must be a parent directory"),
+				WantStderr: "PARENT_DIR must be a parent directory\n",
+			},
+		},
+		{
+			name:        "parent is physical",
+			d:           &Dot{},
+			cwd:         alias,
+			wantHistory: []string{inner},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"parent", "real", "-P"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd(filepath.Join(links, "real"))},
+				},
+			},
+		},
+		{
+			name: "prints path mode",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"symlinks"},
+				WantStdout: "logical\n",
+			},
+		},
+		{
+			name: "sets path mode",
+			d:    &Dot{},
+			want: &Dot{PathMode: pathModePhysical},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"symlinks", "physical"},
+			},
+		},
+		{
+			name: "resets path mode",
+			d:    &Dot{PathMode: pathModePhysical},
+			want: &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"symlinks", "logical"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, test.cwd, nil)
+			c := cachetest.NewTestCache(t)
+			cache.StubShellCache(t, c)
+
+			test.etc.Node = test.d.Node()
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+
+			h := &History{}
+			if _, err := c.GetStruct(shellCacheKey, h); err != nil {
+				t.Fatalf("failed to read history: %v", err)
+			}
+			if diff := cmp.Diff(&History{PrevDirs: test.wantHistory}, h, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Execute(%v) produced incorrect history (-want, +got):\n%s", test.etc.Args, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package cd
+
+import (
+	"fmt"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	targetArg    = "TARGET"
+	targetDirKey = "TARGET_DIR"
+)
+
+// targetNode returns a node that resolves a target directory (and sub paths)
+// with the same shortcut and up-flag logic as the default node, sets the
+// resolved directory at targetDirKey, and then runs the provided processors.
+func (d *Dot) targetNode(ps ...command.Processor) command.Node {
+	opts := append([]commander.ArgumentOption[string]{
+		commander.ShortcutOpt[string](dirShortcutName, d),
+		// `-` is the previous directory (like `d -`).
+		&commander.Transformer[string]{F: func(v string, data *command.Data) (string, error) {
+			if v != "-" {
+				return v, nil
+			}
+			_, h, err := d.getHistory(data)
+			if err != nil {
+				return "", err
+			}
+			if pd := h.previous(workingDir(data)); pd != "" {
+				return pd, nil
+			}
+			return "", fmt.Errorf("no previous directory")
+		}},
+	}, d.pathOpts()...)
+
+	subOpts := []commander.ArgumentOption[[]string]{
+		&commander.Complexecute[[]string]{Lenient: true},
+		d.subPathFetcher(targetArg),
+	}
+
+	return prependProcessors(commander.SerialNodes(append([]command.Processor{
+		d.getwd(),
+		d.projectShortcutTransformer(),
+		cache.ShellProcessor(),
+		commander.FlagProcessor(
+			upFlag,
+			physicalFlag,
+			logicalFlag,
+		),
+		commander.Arg(targetArg, "Target directory (a path or shortcut)", opts...),
+		commander.ListArg(subPathArg, "subdirectories to continue to", 0, command.UnboundedList, subOpts...),
+		commander.SuperSimpleProcessor(func(i *command.Input, data *command.Data) error {
+			data.Set(targetDirKey, destination(data, data.String(targetArg), data.StringList(subPathArg)))
+			return nil
+		}),
+	}, ps...)...), d.fsProcessor(), d.profileProcessor(), d.namespaceTransformer())
+}
@@ -0,0 +1,215 @@
+package cd
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+const (
+	oscCwd   = 7
+	oscTitle = 2
+
+	// tmuxEnvVar is set when running inside of tmux.
+	tmuxEnvVar = "TMUX"
+
+	titleComponents = "components"
+	titleProject    = "project"
+	titleShortcut   = "shortcut"
+
+	defaultTitleComponents = 2
+)
+
+var (
+	titleFormats = []string{titleComponents, titleProject, titleShortcut}
+
+	osc7Flag            = commander.Flag[bool]("osc7", commander.FlagNoShortName, "Whether to report the directory to the terminal with an OSC 7 escape")
+	titleFlag           = commander.Flag[bool]("title", 't', "Whether to set the terminal (and tmux window) title to the directory")
+	titleFormatFlag     = commander.MenuFlag("title-format", 'f', "How the title is shortened", titleFormats...)
+	titleComponentsFlag = commander.Flag[int]("title-components", 'n', "Number of trailing path components in the title", commander.NonNegative[int]())
+
+	// projectRootMarkers are the files (or directories) that indicate the root
+	// of a project for project-relative titles.
+	projectRootMarkers = []string{".git", projectShortcutsFile}
+)
+
+// Terminal configures the terminal integration commands that are emitted
+// along with the `cd` command.
+type Terminal struct {
+	// OSC7 is whether to report the directory with an OSC 7 escape so new tabs
+	// open in the same directory.
+	OSC7 bool
+	// Title is whether to set the terminal title (and tmux window name).
+	Title bool
+	// TitleFormat is one of "components" (the default), "project", or "shortcut".
+	TitleFormat string
+	// TitleComponents is the number of trailing path components used by the
+	// "components" format (and as a fallback for the others).
+	TitleComponents int
+}
+
+// terminalCommands returns the configured terminal integration commands for
+// changing to the provided directory.
+func (d *Dot) terminalCommands(sh shell, data *command.Data, dir string) []string {
+	t := d.Terminal
+	if t == nil || (!t.OSC7 && !t.Title) {
+		return nil
+	}
+	abs, err := absoluteDir(data, dir)
+	if err != nil {
+		return nil
+	}
+
+	var r []string
+	if t.OSC7 {
+		host, _ := fsHostname(filesystem(data))
+		r = append(r, sh.OSC(oscCwd, fileURL(host, abs)))
+	}
+	if t.Title {
+		title := d.title(filesystem(data), abs)
+		r = append(r, sh.OSC(oscTitle, title))
+		if _, ok := command.OSLookupEnv(tmuxEnvVar); ok {
+			r = append(r, fmt.Sprintf("tmux rename-window -- %s", sh.Quote(title)))
+		}
+	}
+	return r
+}
+
+// fileURL returns the `file://host/path` URL for the directory.
+func fileURL(host, dir string) string {
+	p := filepath.ToSlash(dir)
+	if !strings.HasPrefix(p, "/") {
+		// Windows paths (e.g. `C:/Users`)
+		p = "/" + p
+	}
+	u := &url.URL{Scheme: "file", Host: host, Path: p}
+	return u.String()
+}
+
+// title returns the shortened title for the directory.
+func (d *Dot) title(fsys FS, dir string) string {
+	switch d.Terminal.TitleFormat {
+	case titleProject:
+		if t, ok := projectTitle(fsys, dir); ok {
+			return t
+		}
+	case titleShortcut:
+		if t, ok := d.shortcutTitle(dir); ok {
+			return t
+		}
+	}
+	return componentsTitle(fsys, dir, d.Terminal.TitleComponents)
+}
+
+// componentsTitle returns the last n components of the directory.
+func componentsTitle(fsys FS, dir string, n int) string {
+	if n <= 0 {
+		n = defaultTitleComponents
+	}
+	if home, err := fsUserHomeDir(fsys); err == nil && dir == home {
+		return "~"
+	}
+	parts := strings.Split(strings.Trim(filepath.ToSlash(dir), "/"), "/")
+	if len(parts) > n {
+		parts = parts[len(parts)-n:]
+	}
+	if t := strings.Join(parts, "/"); t != "" {
+		return t
+	}
+	return "/"
+}
+
+// projectTitle returns the directory relative to (and including) the root of
+// the project that contains it.
+func projectTitle(fsys FS, dir string) (string, bool) {
+	for root, prev := dir, ""; root != prev; prev, root = root, filepath.Dir(root) {
+		for _, m := range projectRootMarkers {
+			if _, err := fsys.Stat(filepath.Join(root, m)); err != nil {
+				continue
+			}
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return "", false
+			}
+			return filepath.ToSlash(filepath.Join(filepath.Base(root), rel)), true
+		}
+	}
+	return "", false
+}
+
+// shortcutTitle returns the name of the shortcut with the longest path that
+// contains the directory (followed by the relative path within it).
+func (d *Dot) shortcutTitle(dir string) (string, bool) {
+	var best, bestPath string
+	for _, k := range sortedKeys(d.dirShortcuts()) {
+		p := filepath.Join(d.dirShortcuts()[k]...)
+		rel, err := filepath.Rel(p, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(p) > len(bestPath) {
+			best, bestPath = k, p
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	if rel, _ := filepath.Rel(bestPath, dir); rel != "." {
+		return filepath.ToSlash(filepath.Join(best, rel)), true
+	}
+	return best, true
+}
+
+func (d *Dot) terminalNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Configure terminal directory reporting and titles (or print the configuration)"),
+		commander.FlagProcessor(
+			osc7Flag,
+			titleFlag,
+			titleFormatFlag,
+			titleComponentsFlag,
+		),
+		&commander.ExecutorProcessor{F: func(o command.Output, data *command.Data) error {
+			t := d.Terminal
+			if t == nil {
+				t = &Terminal{}
+			}
+			var changed bool
+			if data.Has(osc7Flag.Name()) {
+				t.OSC7, changed = osc7Flag.Get(data), true
+			}
+			if data.Has(titleFlag.Name()) {
+				t.Title, changed = titleFlag.Get(data), true
+			}
+			if data.Has(titleFormatFlag.Name()) {
+				t.TitleFormat, changed = titleFormatFlag.Get(data), true
+			}
+			if data.Has(titleComponentsFlag.Name()) {
+				t.TitleComponents, changed = titleComponentsFlag.Get(data), true
+			}
+
+			if !changed {
+				format := t.TitleFormat
+				if format == "" {
+					format = titleComponents
+				}
+				n := t.TitleComponents
+				if n <= 0 {
+					n = defaultTitleComponents
+				}
+				o.Stdoutf("osc7: %v\n", t.OSC7)
+				o.Stdoutf("title: %v\n", t.Title)
+				o.Stdoutf("title-format: %s\n", format)
+				o.Stdoutf("title-components: %d\n", n)
+				return nil
+			}
+			d.Terminal = t
+			d.MarkChanged()
+			return nil
+		}},
+	)
+}
@@ -0,0 +1,237 @@
+package cd
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestTerminal(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		want *Dot
+		env  map[string]string
+		// projectRoot is the directory that contains a `.git` directory.
+		projectRoot string
+		etc         *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "emits only cd by default",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"/a b/c"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{bashCd("/a b/c")},
+				},
+			},
+		},
+		{
+			name: "emits OSC 7",
+			d:    &Dot{Terminal: &Terminal{OSC7: true}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"/a b/c"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("/a b/c") + ` && printf '\033]7;%s\007' 'file://laptop/a%20b/c'`,
+					},
+				},
+			},
+		},
+		{
+			name: "emits OSC 7 for home directory",
+			d:    &Dot{Terminal: &Terminal{OSC7: true}},
+			etc: &commandtest.ExecuteTestCase{
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						`cd && printf '\033]7;%s\007' 'file://laptop/home/user'`,
+					},
+				},
+			},
+		},
+		{
+			name: "emits title with last components",
+			d:    &Dot{Terminal: &Terminal{Title: true}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"/a/b/c/d"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("/a/b/c/d") + ` && printf '\033]2;%s\007' 'c/d'`,
+					},
+				},
+			},
+		},
+		{
+			name: "emits title with configured number of components",
+			d:    &Dot{Terminal: &Terminal{Title: true, TitleComponents: 3}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"/a/b/c/d"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("/a/b/c/d") + ` && printf '\033]2;%s\007' 'b/c/d'`,
+					},
+				},
+			},
+		},
+		{
+			name: "emits home title",
+			d:    &Dot{Terminal: &Terminal{Title: true}},
+			etc: &commandtest.ExecuteTestCase{
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						`cd && printf '\033]2;%s\007' '~'`,
+					},
+				},
+			},
+		},
+		{
+			name:        "emits project-relative title",
+			d:           &Dot{Terminal: &Terminal{Title: true, TitleFormat: titleProject}},
+			projectRoot: "/src/proj",
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"/src/proj/pkg/util"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("/src/proj/pkg/util") + ` && printf '\033]2;%s\007' 'proj/pkg/util'`,
+					},
+				},
+			},
+		},
+		{
+			name: "project title falls back to components",
+			d:    &Dot{Terminal: &Terminal{Title: true, TitleFormat: titleProject}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"/src/proj/pkg/util"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("/src/proj/pkg/util") + ` && printf '\033]2;%s\007' 'pkg/util'`,
+					},
+				},
+			},
+		},
+		{
+			name: "emits shortcut title",
+			d: &Dot{
+				Terminal: &Terminal{Title: true, TitleFormat: titleShortcut},
+				Shortcuts: map[string]map[string][]string{dirShortcutName: {
+					"src": {"/src"},
+					"api": {"/src/api"},
+				}},
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"api", "v1"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("/src/api/v1") + ` && printf '\033]2;%s\007' 'api/v1'`,
+					},
+				},
+			},
+		},
+		{
+			name: "emits tmux window name",
+			d:    &Dot{Terminal: &Terminal{Title: true}},
+			env:  map[string]string{tmuxEnvVar: "/tmp/tmux"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"/a/it's"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						`cd '/a/it'\''s' && printf '\033]2;%s\007' 'a/it'\''s' && tmux rename-window -- 'a/it'\''s'`,
+					},
+				},
+			},
+		},
+		{
+			name: "emits powershell commands",
+			d:    &Dot{Terminal: &Terminal{OSC7: true, Title: true}},
+			env:  map[string]string{shellEnvVar: "powershell"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"/a/b"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						`Set-Location -LiteralPath '/a/b'; if ($?) { [Console]::Write("$([char]27)]7;{0}$([char]7)" -f 'file://laptop/a/b'); if ($?) { [Console]::Write("$([char]27)]2;{0}$([char]7)" -f 'a/b') } }`,
+					},
+				},
+			},
+		},
+		{
+			name: "chains listing after terminal commands",
+			d:    &Dot{Terminal: &Terminal{Title: true}, ListFormat: listingLs},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"/a/b"},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{
+						bashCd("/a/b") + ` && printf '\033]2;%s\007' 'a/b' && ls`,
+					},
+				},
+			},
+		},
+		{
+			name: "print mode doesn't emit commands",
+			d:    &Dot{Terminal: &Terminal{OSC7: true, Title: true}},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"--print", "/a/b"},
+				WantStdout: "/a/b\n",
+			},
+		},
+		{
+			name: "prints default configuration",
+			d:    &Dot{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"terminal"},
+				WantStdout: strings.Join([]string{
+					"osc7: false",
+					"title: false",
+					"title-format: components",
+					"title-components: 2",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "sets configuration",
+			d:    &Dot{Terminal: &Terminal{TitleComponents: 3}},
+			want: &Dot{Terminal: &Terminal{OSC7: true, Title: true, TitleFormat: titleShortcut, TitleComponents: 3}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"terminal", "--osc7", "true", "-t", "true", "-f", "shortcut"},
+			},
+		},
+		{
+			name: "disables configuration",
+			d:    &Dot{Terminal: &Terminal{OSC7: true, Title: true}},
+			want: &Dot{Terminal: &Terminal{Title: true, TitleComponents: 1}},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"terminal", "--osc7", "false", "-n", "1"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubGetwd(t, "/cur", nil)
+			test.d.fsys = &statFS{wd: "/cur", stat: func(path string) (fs.FileInfo, error) {
+				if test.projectRoot != "" && path == filepath.Join(test.projectRoot, ".git") {
+					return dirType, nil
+				}
+				if filepath.Base(path) == ".git" || filepath.Base(path) == projectShortcutsFile {
+					return nil, os.ErrNotExist
+				}
+				return dirType, nil
+			}, host: "laptop", home: "/home/user"}
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+
+			test.etc.Node = test.d.Node()
+			test.etc.Env = test.env
+			test.etc.OS = &commandtest.FakeOS{}
+			test.etc.SkipDataCheck = true
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package cd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+// watchOp is the type of a directory change.
+type watchOp int
+
+const (
+	watchCreate watchOp = iota
+	watchRemove
+	watchRename
+	// watchOverflow is sent when changes were dropped (so the whole index
+	// needs to be updated).
+	watchOverflow
+)
+
+const (
+	// pendingRenamePrefix is the prefix of the environment cache keys of the
+	// renames that `d watch` saw and that aren't applied to the configuration
+	// yet.
+	pendingRenamePrefix = "leep-cd-rename-"
+	// watchLockFile is the file (in the environment cache directory) that the
+	// running `d watch` locks.
+	watchLockFile = "leep-cd-watch.lock"
+)
+
+// watchEvent is a change to a directory.
+type watchEvent struct {
+	op   watchOp
+	path string
+	// oldPath is the directory's previous path (for renames).
+	oldPath string
+}
+
+// dirWatcher watches directories for subdirectories that are created,
+// removed, or renamed.
+type dirWatcher interface {
+	// Add watches the directory (but not its subdirectories).
+	Add(dir string) error
+	// Events returns the channel of changes. The channel is closed when the
+	// watcher fails or is closed.
+	Events() <-chan *watchEvent
+	// Err returns the error that closed the events channel (if any).
+	Err() error
+	Close() error
+}
+
+var (
+	// newDirWatcher returns a watcher for the current platform.
+	newDirWatcher = newWatcher
+	// watchContext returns the context that stops `d watch`.
+	watchContext = func() (context.Context, context.CancelFunc) {
+		return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	}
+	// lockWatcher keeps more than one `d watch` from running at once. It
+	// returns the function that releases the lock.
+	lockWatcher = func() (func() error, error) {
+		c, err := envCache()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get environment cache: %v", err)
+		}
+		return lockFile(filepath.Join(c.Dir, watchLockFile))
+	}
+	// errWatching is returned by lockFile when another process holds the lock.
+	errWatching = errors.New("directories are already being watched (by another `d watch`)")
+
+	foregroundFlag = commander.BoolFlag("foreground", commander.FlagNoShortName, "Watch in the foreground (until interrupted) instead of in the background")
+)
+
+// renamedPath returns the path with the old directory prefix replaced by the
+// new one (or false if the path isn't in the old directory).
+func renamedPath(p, oldDir, newDir string) (string, bool) {
+	if p == oldDir {
+		return newDir, true
+	}
+	if rest, ok := strings.CutPrefix(p, oldDir+string(filepath.Separator)); ok {
+		return filepath.Join(newDir, rest), true
+	}
+	return p, false
+}
+
+// renamePaths rewrites the paths that are a renamed directory (or are in it)
+// and returns whether any were rewritten.
+func renamePaths(ps []string, oldDir, newDir string) bool {
+	var changed bool
+	for i, p := range ps {
+		if np, ok := renamedPath(p, oldDir, newDir); ok {
+			ps[i], changed = np, true
+		}
+	}
+	return changed
+}
+
+// renameDir rewrites the shortcuts, sessions, and search roots that refer to
+// a renamed directory (or one of its subdirectories) and returns whether any
+// were rewritten.
+func (d *Dot) renameDir(oldDir, newDir string) bool {
+	var changed bool
+	rename := func(ps []string) {
+		changed = renamePaths(ps, oldDir, newDir) || changed
+	}
+
+	for _, scs := range []map[string]map[string][]string{d.Shortcuts, d.Profiles} {
+		for _, m := range scs {
+			for _, v := range m {
+				rename(v)
+			}
+		}
+	}
+	for _, s := range d.Sessions {
+		if np, ok := renamedPath(s.Dir, oldDir, newDir); ok {
+			s.Dir, changed = np, true
+		}
+		rename(s.PrevDirs)
+		rename(s.Stack)
+	}
+	rename(d.SearchRoots)
+	return changed
+}
+
+// PendingRename is a directory rename that isn't applied to the configuration
+// yet.
+type PendingRename struct {
+	Old string
+	New string
+}
+
+// saveRename saves a rename for the next `d` command to apply to the
+// configuration (see applyRenames). The watcher doesn't save the
+// configuration itself because `sourcerer` saves it (and other shells change
+// it while the watcher runs). n orders renames that happen at the same time.
+func saveRename(n int, oldDir, newDir string) error {
+	c, err := envCache()
+	if err != nil {
+		return fmt.Errorf("failed to get environment cache: %v", err)
+	}
+	key := fmt.Sprintf("%s%020d-%06d", pendingRenamePrefix, timeNow().UnixNano(), n)
+	if err := c.PutStruct(key, &PendingRename{Old: oldDir, New: newDir}); err != nil {
+		return fmt.Errorf("failed to save rename: %v", err)
+	}
+	return nil
+}
+
+// applyRenames rewrites the configuration for the renames saved by `d watch`
+// (in the order they happened) and removes them.
+func (d *Dot) applyRenames() error {
+	c, err := envCache()
+	if err != nil {
+		return fmt.Errorf("failed to get environment cache: %v", err)
+	}
+	keys, err := c.List()
+	if err != nil {
+		return fmt.Errorf("failed to list pending renames: %v", err)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, pendingRenamePrefix) {
+			continue
+		}
+		r := &PendingRename{}
+		if _, err := c.GetStruct(k, r); err != nil {
+			return fmt.Errorf("failed to load pending rename: %v", err)
+		}
+		if d.renameDir(r.Old, r.New) {
+			d.MarkChanged()
+		}
+		if err := c.Delete(k); err != nil {
+			return fmt.Errorf("failed to delete pending rename: %v", err)
+		}
+	}
+	return nil
+}
+
+// renameProcessor applies the pending renames before every command (and
+// `sourcerer` saves the configuration when the command is done).
+func (d *Dot) renameProcessor() command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, data *command.Data, ed *command.ExecuteData) error {
+		// Resolving uses a copy of the configuration (which isn't saved).
+		if _, ok := resolving(data); ok {
+			return nil
+		}
+		if err := d.applyRenames(); err != nil {
+			// The renames are applied by a later command, so a broken cache doesn't
+			// stop this one.
+			o.Stderrf("Not applying directory renames: %v\n", err)
+		}
+		return nil
+	}, func(i *command.Input, data *command.Data) (*command.Completion, error) {
+		return nil, nil
+	})
+}
+
+// renameVisited rewrites the directories in the shell's `d -` history and
+// directory stack, and the visits, that refer to a renamed directory.
+func (d *Dot) renameVisited(data *command.Data, oldDir, newDir string) error {
+	c, h, err := d.getHistory(data)
+	if err != nil {
+		return err
+	}
+	if renamePaths(h.PrevDirs, oldDir, newDir) {
+		if err := c.PutStruct(shellCacheKey, h); err != nil {
+			return fmt.Errorf("failed to save history: %v", err)
+		}
+	}
+
+	c, s, err := getStack(data)
+	if err != nil {
+		return err
+	}
+	if renamePaths(s.Dirs, oldDir, newDir) {
+		if err := c.PutStruct(stackCacheKey, s); err != nil {
+			return fmt.Errorf("failed to save stack: %v", err)
+		}
+	}
+
+	c, v, err := getVisits()
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, dir := range sortedKeys(v.Dirs) {
+		if nd, ok := renamedPath(dir, oldDir, newDir); ok {
+			v.Dirs[nd] = v.Dirs[dir]
+			delete(v.Dirs, dir)
+			changed = true
+		}
+	}
+	if changed {
+		if err := c.PutStruct(visitsCacheKey, v); err != nil {
+			return fmt.Errorf("failed to save visits: %v", err)
+		}
+	}
+	return nil
+}
+
+// indexedUnder returns the indexed directories that are the directory or are
+// in it.
+func indexedUnder(ix *Index, dir string) []string {
+	var r []string
+	for p := range ix.Dirs {
+		if _, ok := renamedPath(p, dir, dir); ok {
+			r = append(r, p)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// setChild adds (or removes) the directory from its parent's indexed
+// children.
+func (d *Dot) setChild(ix *Index, dir string, add bool) {
+	parent, ok := ix.Dirs[filepath.Dir(dir)]
+	if !ok {
+		return
+	}
+	name := filepath.Base(dir)
+	var children []string
+	for _, c := range parent.Children {
+		if c != name {
+			children = append(children, c)
+		}
+	}
+	if add {
+		children = append(children, name)
+		sort.Strings(children)
+	}
+	parent.Children = children
+	if fi, err := d.filesystem().Lstat(filepath.Dir(dir)); err == nil {
+		parent.ModTime = fi.ModTime().UnixNano()
+	}
+}
+
+// applyWatchEvent updates the index and returns the directories that are
+// newly indexed (and need to be watched).
+func (d *Dot) applyWatchEvent(ix *Index, ev *watchEvent) []string {
+	switch ev.op {
+	case watchCreate:
+		if _, ok := ix.Dirs[filepath.Dir(ev.path)]; !ok || d.indexSkip(filepath.Base(ev.path)) {
+			return nil
+		}
+		d.walk(ix, ev.path, nil, &indexStats{})
+		d.setChild(ix, ev.path, true)
+		return indexedUnder(ix, ev.path)
+	case watchRemove:
+		for _, p := range indexedUnder(ix, ev.path) {
+			delete(ix.Dirs, p)
+		}
+		d.setChild(ix, ev.path, false)
+	case watchRename:
+		for _, p := range indexedUnder(ix, ev.oldPath) {
+			np, _ := renamedPath(p, ev.oldPath, ev.path)
+			ix.Dirs[np] = ix.Dirs[p]
+			delete(ix.Dirs, p)
+		}
+		d.setChild(ix, ev.oldPath, false)
+		d.setChild(ix, ev.path, true)
+	case watchOverflow:
+		prev := map[string]bool{}
+		for p := range ix.Dirs {
+			prev[p] = true
+		}
+		d.update(ix, ix.Dirs)
+		var added []string
+		for p := range ix.Dirs {
+			if !prev[p] {
+				added = append(added, p)
+			}
+		}
+		sort.Strings(added)
+		return added
+	}
+	return nil
+}
+
+// watch applies the watcher's events until the context is done or the
+// watcher fails. Renames are also applied to the configuration and the
+// shell's directory caches.
+func (d *Dot) watch(ctx context.Context, o command.Output, data *command.Data, w dirWatcher, c *cache.Cache, ix *Index) error {
+	var renames int
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events():
+			if !ok {
+				return w.Err()
+			}
+			for _, dir := range d.applyWatchEvent(ix, ev) {
+				if err := w.Add(dir); err != nil {
+					o.Stderrf("failed to watch %s: %v\n", dir, err)
+				}
+			}
+			switch ev.op {
+			case watchCreate:
+				o.Stdoutf("created %s\n", ev.path)
+			case watchRemove:
+				o.Stdoutf("removed %s\n", ev.path)
+			case watchRename:
+				o.Stdoutf("renamed %s to %s\n", ev.oldPath, ev.path)
+				if err := saveRename(renames, ev.oldPath, ev.path); err != nil {
+					o.Stderrf("failed to update configuration: %v\n", err)
+				}
+				renames++
+				if err := d.renameVisited(data, ev.oldPath, ev.path); err != nil {
+					o.Stderrf("failed to update visited directories: %v\n", err)
+				}
+			case watchOverflow:
+				o.Stdoutln("updated index (too many changes)")
+			}
+			ix.Updated = timeNow().Unix()
+			if err := putIndex(c, ix); err != nil {
+				return o.Annotatef(err, "failed to save directory index")
+			}
+		}
+	}
+}
+
+func (d *Dot) watchNode() command.Node {
+	return commander.SerialNodes(
+		commander.Description("Keep the directory index, shortcuts, sessions, and visited directories up to date as directories are created, removed, and renamed (in the background)"),
+		cache.ShellProcessor(),
+		commander.FlagProcessor(foregroundFlag),
+		commander.ExecutableProcessor(func(o command.Output, data *command.Data) ([]string, error) {
+			c, ix, err := getIndex()
+			if err != nil {
+				return nil, o.Err(err)
+			}
+			if len(ix.Roots) == 0 {
+				return nil, o.Stderrln("no directory index (run `d index build` to build one)")
+			}
+			unlock, err := lockWatcher()
+			if err != nil {
+				return nil, o.Err(err)
+			}
+			if !foregroundFlag.Get(data) {
+				// The lock is only checked here (the background watcher takes it).
+				unlock()
+				return []string{shellFromData(data).Background(fmt.Sprintf("%s watch --%s", d.Name(), foregroundFlag.Name()))}, nil
+			}
+			defer unlock()
+
+			w, err := newDirWatcher()
+			if err != nil {
+				return nil, o.Annotatef(err, "failed to create directory watcher")
+			}
+			defer w.Close()
+
+			// Catch up on changes made while nothing was watching.
+			d.update(ix, ix.Dirs)
+			if err := putIndex(c, ix); err != nil {
+				return nil, o.Annotatef(err, "failed to save directory index")
+			}
+			for _, dir := range sortedKeys(ix.Dirs) {
+				if err := w.Add(dir); err != nil {
+					o.Stderrf("failed to watch %s: %v\n", dir, err)
+				}
+			}
+			o.Stdoutf("Watching %d directories\n", len(ix.Dirs))
+
+			ctx, cancel := watchContext()
+			defer cancel()
+			return nil, o.Err(d.watch(ctx, o, data, w, c, ix))
+		}),
+	)
+}
@@ -0,0 +1,209 @@
+package cd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+	// moveTimeout is how long a moved-from event waits for its moved-to event
+	// before it is sent as a remove.
+	moveTimeout = 100 * time.Millisecond
+)
+
+// inotifyWatcher is a dirWatcher that uses inotify.
+type inotifyWatcher struct {
+	// fd is the inotify file descriptor (f.Fd isn't used because it makes the
+	// file blocking).
+	fd     int
+	f      *os.File
+	events chan *watchEvent
+	done   chan struct{}
+	err    error
+
+	mu sync.Mutex
+	// dirs is a map from watch descriptor to watched directory.
+	dirs map[int32]string
+	// movedFrom is a map from cookie to the moved-from events that are waiting
+	// for their moved-to events (which can be in a later read).
+	movedFrom map[uint32]*watchEvent
+}
+
+func newWatcher() (dirWatcher, error) {
+	// The file is non-blocking so that Close interrupts a pending read.
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %v", err)
+	}
+	w := &inotifyWatcher{
+		fd:        fd,
+		f:         os.NewFile(uintptr(fd), "inotify"),
+		events:    make(chan *watchEvent),
+		done:      make(chan struct{}),
+		dirs:      map[int32]string{},
+		movedFrom: map[uint32]*watchEvent{},
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dirs[int32(wd)] = dir
+	return nil
+}
+
+func (w *inotifyWatcher) Events() <-chan *watchEvent { return w.events }
+func (w *inotifyWatcher) Err() error                 { return w.err }
+
+func (w *inotifyWatcher) Close() error {
+	close(w.done)
+	return w.f.Close()
+}
+
+// read sends the events read from inotify until the file is closed.
+func (w *inotifyWatcher) read() {
+	defer close(w.events)
+	buf := make([]byte, 64*1024)
+	for {
+		// Stop waiting for moved-to events after a while (the directory was
+		// moved out of the watched directories).
+		deadline := time.Time{}
+		if w.waiting() {
+			deadline = time.Now().Add(moveTimeout)
+		}
+		if err := w.f.SetReadDeadline(deadline); err != nil {
+			w.err = fmt.Errorf("failed to set inotify read deadline: %v", err)
+			return
+		}
+
+		var evs []*watchEvent
+		n, err := w.f.Read(buf)
+		switch {
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			evs = w.flushMoves()
+		case err != nil:
+			if !errors.Is(err, os.ErrClosed) {
+				w.err = fmt.Errorf("failed to read inotify events: %v", err)
+			}
+			return
+		default:
+			evs = w.parse(buf[:n])
+		}
+		for _, ev := range evs {
+			select {
+			case w.events <- ev:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// waiting returns whether any moved-from events are waiting for their moved-to
+// events.
+func (w *inotifyWatcher) waiting() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.movedFrom) > 0
+}
+
+// flushMoves returns the moved-from events that are still waiting (as
+// removes).
+func (w *inotifyWatcher) flushMoves() []*watchEvent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var r []*watchEvent
+	for cookie, ev := range w.movedFrom {
+		r = append(r, ev)
+		delete(w.movedFrom, cookie)
+	}
+	return r
+}
+
+// parse converts the raw inotify events into watch events. Renames are
+// reported as a moved-from event followed by a moved-to event with the same
+// cookie (possibly in a later read); moves into (or out of) the watched
+// directories are creates (or removes).
+func (w *inotifyWatcher) parse(b []byte) []*watchEvent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var r []*watchEvent
+	for len(b) >= syscall.SizeofInotifyEvent {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&b[0]))
+		end := syscall.SizeofInotifyEvent + int(raw.Len)
+		name := string(bytes.TrimRight(b[syscall.SizeofInotifyEvent:end], "\x00"))
+		b = b[end:]
+
+		if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			r = append(r, &watchEvent{op: watchOverflow})
+			continue
+		}
+		if raw.Mask&syscall.IN_IGNORED != 0 {
+			delete(w.dirs, raw.Wd)
+			continue
+		}
+		dir, ok := w.dirs[raw.Wd]
+		if !ok || raw.Mask&syscall.IN_ISDIR == 0 {
+			continue
+		}
+		p := filepath.Join(dir, name)
+
+		switch {
+		case raw.Mask&syscall.IN_CREATE != 0:
+			r = append(r, &watchEvent{op: watchCreate, path: p})
+		case raw.Mask&syscall.IN_DELETE != 0:
+			r = append(r, &watchEvent{op: watchRemove, path: p})
+		case raw.Mask&syscall.IN_MOVED_FROM != 0:
+			w.movedFrom[raw.Cookie] = &watchEvent{op: watchRemove, path: p}
+		case raw.Mask&syscall.IN_MOVED_TO != 0:
+			if ev, ok := w.movedFrom[raw.Cookie]; ok {
+				// The watch descriptors of the moved directories are unchanged,
+				// so update their paths.
+				ev.op, ev.oldPath, ev.path = watchRename, ev.path, p
+				for wd, d := range w.dirs {
+					if np, ok := renamedPath(d, ev.oldPath, p); ok {
+						w.dirs[wd] = np
+					}
+				}
+				delete(w.movedFrom, raw.Cookie)
+				r = append(r, ev)
+				continue
+			}
+			r = append(r, &watchEvent{op: watchCreate, path: p})
+		}
+	}
+	return r
+}
+
+// lockFile locks the file (creating it if needed) and returns the function
+// that unlocks it. The lock is released when the process exits, so it can't
+// be left behind by a killed watcher.
+func lockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errWatching
+		}
+		return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+	}
+	return f.Close, nil
+}
@@ -0,0 +1,143 @@
+package cd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInotifyWatcher(t *testing.T) {
+	root := t.TempDir()
+	mkdir(t, filepath.Join(root, "a"))
+
+	w, err := newWatcher()
+	if err != nil {
+		t.Fatalf("newWatcher() returned error: %v", err)
+	}
+	defer w.Close()
+	for _, dir := range []string{root, filepath.Join(root, "a")} {
+		if err := w.Add(dir); err != nil {
+			t.Fatalf("Add(%q) returned error: %v", dir, err)
+		}
+	}
+
+	mkdir(t, filepath.Join(root, "b"))
+	rename(t, filepath.Join(root, "a"), filepath.Join(root, "c"))
+	// The watch on the renamed directory reports its new path.
+	mkdir(t, filepath.Join(root, "c", "d"))
+	remove(t, filepath.Join(root, "b"))
+
+	want := []watchEvent{
+		{op: watchCreate, path: filepath.Join(root, "b")},
+		{op: watchRename, oldPath: filepath.Join(root, "a"), path: filepath.Join(root, "c")},
+		{op: watchCreate, path: filepath.Join(root, "c", "d")},
+		{op: watchRemove, path: filepath.Join(root, "b")},
+	}
+	var got []watchEvent
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case ev, ok := <-w.Events():
+			if !ok {
+				t.Fatalf("events closed early: %v", w.Err())
+			}
+			got = append(got, *ev)
+		case <-timeout:
+			t.Fatalf("timed out waiting for events; got %v", got)
+		}
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(watchEvent{})); diff != "" {
+		t.Errorf("inotify watcher produced incorrect events (-want, +got):\n%s", diff)
+	}
+}
+
+func TestInotifyWatcherMoveOut(t *testing.T) {
+	root, other := t.TempDir(), t.TempDir()
+	mkdir(t, filepath.Join(root, "a"))
+
+	w, err := newWatcher()
+	if err != nil {
+		t.Fatalf("newWatcher() returned error: %v", err)
+	}
+	defer w.Close()
+	if err := w.Add(root); err != nil {
+		t.Fatalf("Add(%q) returned error: %v", root, err)
+	}
+
+	// The moved-from event is sent as a remove once its moved-to event doesn't
+	// arrive.
+	rename(t, filepath.Join(root, "a"), filepath.Join(other, "a"))
+
+	select {
+	case ev, ok := <-w.Events():
+		if !ok {
+			t.Fatalf("events closed early: %v", w.Err())
+		}
+		want := watchEvent{op: watchRemove, path: filepath.Join(root, "a")}
+		if diff := cmp.Diff(want, *ev, cmp.AllowUnexported(watchEvent{})); diff != "" {
+			t.Errorf("inotify watcher produced incorrect event (-want, +got):\n%s", diff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for event")
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	f := filepath.Join(t.TempDir(), watchLockFile)
+	unlock, err := lockFile(f)
+	if err != nil {
+		t.Fatalf("lockFile() returned error: %v", err)
+	}
+	// Each lock is for a separate open file, so a second watcher in the same
+	// process is also rejected.
+	if _, err := lockFile(f); err != errWatching {
+		t.Errorf("lockFile() of a locked file returned error %v; want %v", err, errWatching)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock() returned error: %v", err)
+	}
+	unlock, err = lockFile(f)
+	if err != nil {
+		t.Fatalf("lockFile() of an unlocked file returned error: %v", err)
+	}
+	unlock()
+}
+
+func TestInotifyParse(t *testing.T) {
+	w := &inotifyWatcher{
+		dirs:      map[int32]string{1: "/root", 2: "/root/a"},
+		movedFrom: map[uint32]*watchEvent{},
+	}
+
+	// The moved-from and moved-to events of a rename are in different reads.
+	if got := w.parse(inotifyEvent(1, syscall.IN_MOVED_FROM|syscall.IN_ISDIR, 7, "a")); len(got) != 0 {
+		t.Errorf("parse(moved-from) returned %v; want no events", got)
+	}
+	got := w.parse(inotifyEvent(1, syscall.IN_MOVED_TO|syscall.IN_ISDIR, 7, "b"))
+	want := []*watchEvent{{op: watchRename, oldPath: "/root/a", path: "/root/b"}}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(watchEvent{})); diff != "" {
+		t.Errorf("parse(moved-to) returned incorrect events (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[int32]string{1: "/root", 2: "/root/b"}, w.dirs); diff != "" {
+		t.Errorf("parse(moved-to) produced incorrect watched directories (-want, +got):\n%s", diff)
+	}
+	if w.waiting() {
+		t.Errorf("waiting() returned true after the rename; want false")
+	}
+}
+
+// inotifyEvent returns the raw bytes of an inotify event.
+func inotifyEvent(wd int32, mask, cookie uint32, name string) []byte {
+	// The name is null-padded (like inotify does).
+	n := make([]byte, 16)
+	copy(n, name)
+	var b bytes.Buffer
+	binary.Write(&b, binary.NativeEndian, syscall.InotifyEvent{Wd: wd, Mask: mask, Cookie: cookie, Len: uint32(len(n))})
+	b.Write(n)
+	return b.Bytes()
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package cd
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func newWatcher() (dirWatcher, error) {
+	return nil, fmt.Errorf("watching directories isn't supported on %s", runtime.GOOS)
+}
+
+func lockFile(path string) (func() error, error) {
+	return nil, fmt.Errorf("watching directories isn't supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,603 @@
+package cd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/cache"
+	"github.com/leep-frog/command/cache/cachetest"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// fakeWatcher is a dirWatcher that makes each change (and sends its event)
+// once the changes are being watched.
+type fakeWatcher struct {
+	changes []func() *watchEvent
+	err     error
+
+	once    sync.Once
+	events  chan *watchEvent
+	watched []string
+}
+
+func (fw *fakeWatcher) Add(dir string) error {
+	fw.watched = append(fw.watched, dir)
+	return nil
+}
+
+func (fw *fakeWatcher) Events() <-chan *watchEvent {
+	fw.once.Do(func() {
+		fw.events = make(chan *watchEvent)
+		go func() {
+			defer close(fw.events)
+			for _, c := range fw.changes {
+				fw.events <- c()
+			}
+		}()
+	})
+	return fw.events
+}
+
+func (fw *fakeWatcher) Err() error   { return fw.err }
+func (fw *fakeWatcher) Close() error { return nil }
+
+func TestWatch(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		d    *Dot
+		// background is whether to run `d watch` without --foreground.
+		background bool
+		// lockErr is the error returned when locking the watcher.
+		lockErr error
+		// noIndex is whether to skip building the index before watching.
+		noIndex bool
+		// prevDirs, stack, and visited are the shell's `d -` history, the
+		// directory stack, and the visited directories.
+		prevDirs, stack, visited             []string
+		wantPrevDirs, wantStack, wantVisited []string
+		wantExecutable                       []string
+		// wantRenames are the renames saved for the next command to apply to the
+		// configuration.
+		wantRenames []*PendingRename
+		// changes returns the changes made (in the root) while watching.
+		changes     func(root string) []func() *watchEvent
+		watcherErr  error
+		wantStdout  func(root string) string
+		wantStderr  string
+		wantErr     error
+		wantIndex   []string
+		wantWatched []string
+	}{
+		{
+			name:       "fails without index",
+			noIndex:    true,
+			wantStderr: "no directory index (run `d index build` to build one)\n",
+			wantErr:    fmt.Errorf("no directory index (run `d index build` to build one)"),
+		},
+		{
+			name:       "runs in the background",
+			background: true,
+			wantExecutable: []string{
+				"(d watch --foreground > /dev/null 2>&1 &)",
+			},
+			wantIndex: []string{
+				"",
+				"docs",
+				"src",
+				"src/api",
+				"src/api/v1",
+				"src/web",
+			},
+		},
+		{
+			name:       "fails if already watching",
+			lockErr:    errWatching,
+			wantStderr: "directories are already being watched (by another `d watch`)\n",
+			wantErr:    errWatching,
+			wantIndex: []string{
+				"",
+				"docs",
+				"src",
+				"src/api",
+				"src/api/v1",
+				"src/web",
+			},
+		},
+		{
+			name:       "fails in the background if already watching",
+			background: true,
+			lockErr:    errWatching,
+			wantStderr: "directories are already being watched (by another `d watch`)\n",
+			wantErr:    errWatching,
+			wantIndex: []string{
+				"",
+				"docs",
+				"src",
+				"src/api",
+				"src/api/v1",
+				"src/web",
+			},
+		},
+		{
+			name:       "fails in the background without index",
+			background: true,
+			noIndex:    true,
+			wantStderr: "no directory index (run `d index build` to build one)\n",
+			wantErr:    fmt.Errorf("no directory index (run `d index build` to build one)"),
+		},
+		{
+			name: "updates index and saves renames",
+			wantRenames: []*PendingRename{
+				{Old: "ROOT/src/api", New: "ROOT/src/service"},
+			},
+			prevDirs:     []string{"ROOT/src/api/v1", "ROOT/docs"},
+			stack:        []string{"ROOT/src/web", "ROOT/src/api"},
+			visited:      []string{"ROOT/docs", "ROOT/src/api", "ROOT/src/api/v1"},
+			wantPrevDirs: []string{"ROOT/src/service/v1", "ROOT/docs"},
+			wantStack:    []string{"ROOT/src/web", "ROOT/src/service"},
+			wantVisited:  []string{"ROOT/docs", "ROOT/src/service", "ROOT/src/service/v1"},
+			changes: func(root string) []func() *watchEvent {
+				return []func() *watchEvent{
+					func() *watchEvent {
+						mkdir(t, filepath.Join(root, "src", "new", "inner"))
+						return &watchEvent{op: watchCreate, path: filepath.Join(root, "src", "new")}
+					},
+					func() *watchEvent {
+						rename(t, filepath.Join(root, "src", "api"), filepath.Join(root, "src", "service"))
+						return &watchEvent{op: watchRename, oldPath: filepath.Join(root, "src", "api"), path: filepath.Join(root, "src", "service")}
+					},
+					func() *watchEvent {
+						remove(t, filepath.Join(root, "docs"))
+						return &watchEvent{op: watchRemove, path: filepath.Join(root, "docs")}
+					},
+				}
+			},
+			wantStdout: func(root string) string {
+				return "Watching 6 directories\n" +
+					fmt.Sprintf("created %s\n", filepath.Join(root, "src", "new")) +
+					fmt.Sprintf("renamed %s to %s\n", filepath.Join(root, "src", "api"), filepath.Join(root, "src", "service")) +
+					fmt.Sprintf("removed %s\n", filepath.Join(root, "docs"))
+			},
+			wantIndex: []string{
+				"",
+				"src",
+				"src/new",
+				"src/new/inner",
+				"src/service",
+				"src/service/v1",
+				"src/web",
+			},
+			wantWatched: []string{
+				"",
+				"docs",
+				"src",
+				"src/api",
+				"src/api/v1",
+				"src/web",
+				"src/new",
+				"src/new/inner",
+			},
+		},
+		{
+			name: "saves renames in order",
+			wantRenames: []*PendingRename{
+				{Old: "ROOT/src/api", New: "ROOT/src/service"},
+				{Old: "ROOT/src/service", New: "ROOT/src/svc"},
+			},
+			changes: func(root string) []func() *watchEvent {
+				return []func() *watchEvent{
+					func() *watchEvent {
+						rename(t, filepath.Join(root, "src", "api"), filepath.Join(root, "src", "service"))
+						return &watchEvent{op: watchRename, oldPath: filepath.Join(root, "src", "api"), path: filepath.Join(root, "src", "service")}
+					},
+					func() *watchEvent {
+						rename(t, filepath.Join(root, "src", "service"), filepath.Join(root, "src", "svc"))
+						return &watchEvent{op: watchRename, oldPath: filepath.Join(root, "src", "service"), path: filepath.Join(root, "src", "svc")}
+					},
+				}
+			},
+			wantStdout: func(root string) string {
+				return "Watching 6 directories\n" +
+					fmt.Sprintf("renamed %s to %s\n", filepath.Join(root, "src", "api"), filepath.Join(root, "src", "service")) +
+					fmt.Sprintf("renamed %s to %s\n", filepath.Join(root, "src", "service"), filepath.Join(root, "src", "svc"))
+			},
+			wantIndex: []string{
+				"",
+				"docs",
+				"src",
+				"src/svc",
+				"src/svc/v1",
+				"src/web",
+			},
+			wantWatched: []string{
+				"",
+				"docs",
+				"src",
+				"src/api",
+				"src/api/v1",
+				"src/web",
+			},
+		},
+		{
+			name: "updates index after overflow",
+			changes: func(root string) []func() *watchEvent {
+				return []func() *watchEvent{
+					func() *watchEvent {
+						mkdir(t, filepath.Join(root, "src", "web", "components"))
+						remove(t, filepath.Join(root, "src", "api"))
+						return &watchEvent{op: watchOverflow}
+					},
+				}
+			},
+			wantStdout: func(root string) string {
+				return "Watching 6 directories\n" +
+					"updated index (too many changes)\n"
+			},
+			wantIndex: []string{
+				"",
+				"docs",
+				"src",
+				"src/web",
+				"src/web/components",
+			},
+			wantWatched: []string{
+				"",
+				"docs",
+				"src",
+				"src/api",
+				"src/api/v1",
+				"src/web",
+				"src/web/components",
+			},
+		},
+		{
+			name:       "fails if watcher fails",
+			watcherErr: fmt.Errorf("oops"),
+			wantStdout: func(root string) string {
+				return "Watching 6 directories\n"
+			},
+			wantStderr: "oops\n",
+			wantErr:    fmt.Errorf("oops"),
+			wantIndex: []string{
+				"",
+				"docs",
+				"src",
+				"src/api",
+				"src/api/v1",
+				"src/web",
+			},
+			wantWatched: []string{
+				"",
+				"docs",
+				"src",
+				"src/api",
+				"src/api/v1",
+				"src/web",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			root := listingDir(t, map[string]string{
+				"src/api/v1/": "",
+				"src/web/":    "",
+				"docs/":       "",
+			})
+			if test.d == nil {
+				test.d = &Dot{}
+			}
+			replaceRoot(test.d, root)
+			ec := cachetest.NewTestCache(t)
+
+			sc := cachetest.NewTestCache(t)
+			if err := sc.PutStruct(shellCacheKey, &History{PrevDirs: rootPaths(root, test.prevDirs)}); err != nil {
+				t.Fatalf("failed to save history: %v", err)
+			}
+			if err := sc.PutStruct(stackCacheKey, &Stack{Dirs: rootPaths(root, test.stack)}); err != nil {
+				t.Fatalf("failed to save stack: %v", err)
+			}
+			v := &Visits{Dirs: map[string]*Visit{}}
+			for _, dir := range rootPaths(root, test.visited) {
+				v.Dirs[dir] = &Visit{Count: 1}
+			}
+			vc := cachetest.NewTestCache(t)
+			if err := vc.PutStruct(visitsCacheKey, v); err != nil {
+				t.Fatalf("failed to save visits: %v", err)
+			}
+
+			ic := cachetest.NewTestCache(t)
+			if !test.noIndex {
+				ix := &Index{Roots: []string{root}}
+				test.d.update(ix, nil)
+				if err := ic.PutStruct(indexCacheKey, ix); err != nil {
+					t.Fatalf("failed to store index: %v", err)
+				}
+			}
+			fw := &fakeWatcher{err: test.watcherErr}
+			if test.changes != nil {
+				fw.changes = test.changes(root)
+			}
+			commandtest.StubValue(t, &indexCache, func() (*cache.Cache, error) { return ic, nil })
+			commandtest.StubValue(t, &envCache, func() (*cache.Cache, error) { return ec, nil })
+			commandtest.StubValue(t, &lockWatcher, func() (func() error, error) {
+				if test.lockErr != nil {
+					return nil, test.lockErr
+				}
+				return func() error { return nil }, nil
+			})
+			commandtest.StubValue(t, &visitsCache, func() (*cache.Cache, error) { return vc, nil })
+			cache.StubShellCache(t, sc)
+			commandtest.StubValue(t, &newDirWatcher, func() (dirWatcher, error) { return fw, nil })
+			commandtest.StubValue(t, &watchContext, func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			})
+			commandtest.StubValue(t, &timeNow, func() time.Time { return time.Unix(1_000_000_000, 0) })
+
+			args := []string{"watch", "--foreground"}
+			if test.background {
+				args = args[:1]
+			}
+			etc := &commandtest.ExecuteTestCase{
+				Node:          test.d.Node(),
+				Args:          args,
+				OS:            &commandtest.FakeOS{},
+				WantStderr:    test.wantStderr,
+				WantErr:       test.wantErr,
+				SkipDataCheck: true,
+			}
+			if test.wantStdout != nil {
+				etc.WantStdout = test.wantStdout(root)
+			}
+			if test.wantExecutable != nil {
+				etc.WantExecuteData = &command.ExecuteData{Executable: test.wantExecutable}
+			}
+			commandertest.ExecuteTest(t, etc)
+			// The watcher's copy of the configuration isn't saved (the renames are
+			// applied by the next command).
+			commandertest.ChangeTest(t, nil, test.d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+			for _, r := range test.wantRenames {
+				r.Old, r.New = rootPaths(root, []string{r.Old})[0], rootPaths(root, []string{r.New})[0]
+			}
+			if diff := cmp.Diff(test.wantRenames, pendingRenames(t, ec), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("watch saved incorrect renames (-want, +got):\n%s", diff)
+			}
+
+			h := &History{}
+			if _, err := sc.GetStruct(shellCacheKey, h); err != nil {
+				t.Fatalf("failed to read history: %v", err)
+			}
+			if diff := cmp.Diff(rootPaths(root, test.wantPrevDirs), h.PrevDirs, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("watch produced incorrect history (-want, +got):\n%s", diff)
+			}
+			st := &Stack{}
+			if _, err := sc.GetStruct(stackCacheKey, st); err != nil {
+				t.Fatalf("failed to read stack: %v", err)
+			}
+			if diff := cmp.Diff(rootPaths(root, test.wantStack), st.Dirs, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("watch produced incorrect stack (-want, +got):\n%s", diff)
+			}
+			v = &Visits{}
+			if _, err := vc.GetStruct(visitsCacheKey, v); err != nil {
+				t.Fatalf("failed to read visits: %v", err)
+			}
+			if diff := cmp.Diff(rootPaths(root, test.wantVisited), sortedKeys(v.Dirs), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("watch produced incorrect visits (-want, +got):\n%s", diff)
+			}
+
+			ix := &Index{}
+			if _, err := ic.GetStruct(indexCacheKey, ix); err != nil {
+				t.Fatalf("failed to read index: %v", err)
+			}
+			var got []string
+			for _, dir := range sortedKeys(ix.Dirs) {
+				got = append(got, relSlash(t, root, dir))
+			}
+			if diff := cmp.Diff(test.wantIndex, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("watch produced incorrect index (-want, +got):\n%s", diff)
+			}
+			var watched []string
+			for _, dir := range fw.watched {
+				watched = append(watched, relSlash(t, root, dir))
+			}
+			if diff := cmp.Diff(test.wantWatched, watched, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("watch watched incorrect directories (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApplyRenames(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		args    []string
+		renames []*PendingRename
+		// wantPending is whether the renames are still pending.
+		wantPending bool
+		want        *Dot
+		wantStdout  string
+		wantStderr  string
+		wantErr     error
+	}{
+		{
+			name:       "does nothing without renames",
+			args:       []string{"env"},
+			wantStdout: "false\n",
+		},
+		{
+			name: "applies renames in order",
+			args: []string{"env"},
+			renames: []*PendingRename{
+				{Old: "/src/api", New: "/src/service"},
+				{Old: "/src/service", New: "/src/svc"},
+				{Old: "/docs", New: "/documentation"},
+			},
+			want: &Dot{
+				Shortcuts: map[string]map[string][]string{
+					dirShortcutName: {
+						"a": {"/src/svc"},
+						"v": {"/src/svc/v1"},
+						"w": {"/src/web"},
+					},
+				},
+				Sessions: map[string]*Session{
+					"s": {Dir: "/src/svc", PrevDirs: []string{"/documentation"}, Stack: []string{"/src"}},
+				},
+			},
+			wantStdout: "false\n",
+		},
+		{
+			name: "applies renames before changing directories",
+			args: []string{"--print", "/"},
+			renames: []*PendingRename{
+				{Old: "/src/api", New: "/src/svc"},
+			},
+			want: &Dot{
+				Shortcuts: map[string]map[string][]string{
+					dirShortcutName: {
+						"a": {"/src/svc"},
+						"v": {"/src/svc/v1"},
+						"w": {"/src/web"},
+					},
+				},
+				Sessions: map[string]*Session{
+					"s": {Dir: "/src/svc", PrevDirs: []string{"/docs"}, Stack: []string{"/src"}},
+				},
+			},
+			wantStdout: filepath.FromSlash("/") + "\n",
+		},
+		{
+			name: "doesn't apply renames when watching",
+			args: []string{"watch"},
+			renames: []*PendingRename{
+				{Old: "/src/api", New: "/src/svc"},
+			},
+			wantPending: true,
+			wantStderr:  "no directory index (run `d index build` to build one)\n",
+			wantErr:     fmt.Errorf("no directory index (run `d index build` to build one)"),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ec := cachetest.NewTestCache(t)
+			commandtest.StubValue(t, &envCache, func() (*cache.Cache, error) { return ec, nil })
+			commandtest.StubValue(t, &indexCache, func() (*cache.Cache, error) { return cachetest.NewTestCache(t), nil })
+			cache.StubShellCache(t, cachetest.NewTestCache(t))
+			commandtest.StubGetwd(t, filepath.FromSlash("/"), nil)
+			for i, r := range test.renames {
+				commandtest.StubValue(t, &timeNow, func() time.Time { return time.Unix(1_000_000_000+int64(i), 0) })
+				if err := saveRename(0, r.Old, r.New); err != nil {
+					t.Fatalf("saveRename() returned error: %v", err)
+				}
+			}
+
+			d := &Dot{
+				Shortcuts: map[string]map[string][]string{
+					dirShortcutName: {
+						"a": {"/src/api"},
+						"v": {"/src/api/v1"},
+						"w": {"/src/web"},
+					},
+				},
+				Sessions: map[string]*Session{
+					"s": {Dir: "/src/api", PrevDirs: []string{"/docs"}, Stack: []string{"/src"}},
+				},
+			}
+			commandertest.ExecuteTest(t, &commandtest.ExecuteTestCase{
+				Node:          d.Node(),
+				Args:          test.args,
+				OS:            &commandtest.FakeOS{},
+				WantStdout:    test.wantStdout,
+				WantStderr:    test.wantStderr,
+				WantErr:       test.wantErr,
+				SkipDataCheck: true,
+			})
+			commandertest.ChangeTest(t, test.want, d, cmpopts.IgnoreUnexported(Dot{}), cmpopts.EquateEmpty())
+
+			var wantPending []*PendingRename
+			if test.wantPending {
+				wantPending = test.renames
+			}
+			if diff := cmp.Diff(wantPending, pendingRenames(t, ec), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Execute(%v) left incorrect pending renames (-want, +got):\n%s", test.args, diff)
+			}
+		})
+	}
+}
+
+// pendingRenames returns the renames saved in the cache (in order).
+func pendingRenames(t *testing.T, c *cache.Cache) []*PendingRename {
+	t.Helper()
+	keys, err := c.List()
+	if err != nil {
+		t.Fatalf("failed to list cache keys: %v", err)
+	}
+	sort.Strings(keys)
+	var r []*PendingRename
+	for _, k := range keys {
+		if !strings.HasPrefix(k, pendingRenamePrefix) {
+			continue
+		}
+		pr := &PendingRename{}
+		if _, err := c.GetStruct(k, pr); err != nil {
+			t.Fatalf("failed to read pending rename: %v", err)
+		}
+		r = append(r, pr)
+	}
+	return r
+}
+
+// replaceRoot replaces the ROOT prefix of the shortcut and session paths.
+func replaceRoot(d *Dot, root string) {
+	d.renameDir("ROOT", root)
+}
+
+// rootPaths returns the paths with the ROOT prefix replaced.
+func rootPaths(root string, ps []string) []string {
+	r := append([]string{}, ps...)
+	renamePaths(r, "ROOT", root)
+	return r
+}
+
+// relSlash returns the path relative to the root (with forward slashes), or
+// an empty string for the root itself.
+func relSlash(t *testing.T, root, p string) string {
+	t.Helper()
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		t.Fatalf("failed to get relative path: %v", err)
+	}
+	if rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func mkdir(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+}
+
+func rename(t *testing.T, from, to string) {
+	t.Helper()
+	if err := os.Rename(from, to); err != nil {
+		t.Fatalf("failed to rename directory: %v", err)
+	}
+}
+
+func remove(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("failed to remove directory: %v", err)
+	}
+}